@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidCertificate = errors.New("client certificate is not valid")
+
+// CertificateAuthenticator finds the identity a client certificate, already verified
+// against the server's client CAs, belongs to.
+type CertificateAuthenticator interface {
+	AuthenticateCertificate(certificate *x509.Certificate) (Identity, error)
+}
+
+// NewSubjectMapper makes a CertificateAuthenticator giving certificates the role roles
+// maps their subject's common name to, or defaultRole when it maps it to none.
+func NewSubjectMapper(roles map[string]Role, defaultRole Role) CertificateAuthenticator {
+	return &subjectMapper{roles: roles, defaultRole: defaultRole}
+}
+
+type subjectMapper struct {
+	roles       map[string]Role
+	defaultRole Role
+}
+
+func (mapper *subjectMapper) AuthenticateCertificate(certificate *x509.Certificate) (Identity, error) {
+	if certificate == nil || len(certificate.Subject.CommonName) == 0 {
+		return Identity{}, fmt.Errorf("%w: the subject has no common name", ErrInvalidCertificate)
+	}
+
+	role, ok := mapper.roles[certificate.Subject.CommonName]
+
+	if !ok {
+		role = mapper.defaultRole
+	}
+
+	return Identity{Subject: certificate.Subject.CommonName, Role: role, Method: "client-certificate"}, nil
+}
+
+// ParseSubjectRoles reads a list of names, such as the common names of client
+// certificates or the values of a JWT role claim, and the roles they map to, as in
+// "ops-bot=admin, inventory=editor".
+func ParseSubjectRoles(text string) (map[string]Role, error) {
+	roles := make(map[string]Role)
+
+	for _, entry := range strings.Split(text, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+
+		name, roleText, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+
+		if !ok || len(name) == 0 {
+			return nil, fmt.Errorf("expected name=role, not %q", strings.TrimSpace(entry))
+		}
+
+		role, err := ParseRole(roleText)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		roles[name] = role
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestMappingCertificateSubjectsToRoles(t *testing.T) {
+	roles, err := ParseSubjectRoles(" ops-bot=admin, inventory = Editor ,")
+
+	if err != nil || len(roles) != 2 || roles["ops-bot"] != Admin || roles["inventory"] != Editor {
+		t.Fatalf("unexpected roles %v %v", roles, err)
+	}
+
+	for _, text := range []string{"ops-bot", "=admin", "ops-bot=owner"} {
+		if _, err := ParseSubjectRoles(text); err == nil {
+			t.Errorf("expected %q to be refused", text)
+		}
+	}
+
+	mapper := NewSubjectMapper(roles, Reader)
+
+	identity, err := mapper.AuthenticateCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "ops-bot"}})
+
+	if err != nil || identity != (Identity{Subject: "ops-bot", Role: Admin, Method: "client-certificate"}) {
+		t.Errorf("unexpected identity %+v %v", identity, err)
+	}
+
+	if identity, _ := mapper.AuthenticateCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "kiosk"}}); identity.Role != Reader {
+		t.Errorf("expected an unmapped subject to get the default role, got %+v", identity)
+	}
+
+	if _, err := mapper.AuthenticateCertificate(&x509.Certificate{}); err == nil {
+		t.Errorf("expected a certificate without a common name to be refused")
+	}
+}
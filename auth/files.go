@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// watchedFile reads a file again only when it has changed since it was last read, so
+// that changes made by other processes are picked up without rereading it on every
+// request.
+type watchedFile struct {
+	filePath string
+	known    bool
+	missing  bool
+	modTime  time.Time
+	size     int64
+}
+
+// read returns the file's contents and true when it changed since the last read, or
+// false when it did not. A missing file reads as empty.
+func (file *watchedFile) read() ([]byte, bool, error) {
+	info, err := os.Stat(file.filePath)
+
+	if os.IsNotExist(err) {
+		changed := !file.known || !file.missing
+		file.known, file.missing = true, true
+
+		return nil, changed, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if file.known && !file.missing && info.ModTime().Equal(file.modTime) && info.Size() == file.size {
+		return nil, false, nil
+	}
+
+	fileData, err := ioutil.ReadFile(file.filePath)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	file.known, file.missing = true, false
+	file.modTime = info.ModTime()
+	file.size = info.Size()
+
+	return fileData, true, nil
+}
+
+// forget makes the next read read the file whether it changed or not.
+func (file *watchedFile) forget() {
+	file.known = false
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// jsonWebKey is one key of a JWKS file (RFC 7517). Symmetric keys have kty "oct" and
+// the secret in k; RSA keys have n and e; EC keys, on curve P-256 only, have x and y.
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	K         string `json:"k"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// verificationKey is a key from the JWKS file ready to check signatures with.
+type verificationKey struct {
+	id        string
+	algorithm string
+	secret    []byte
+	rsaKey    *rsa.PublicKey
+	ecdsaKey  *ecdsa.PublicKey
+}
+
+// parseJWKS reads the keys of a JWKS file that can check HS256, RS256 or ES256
+// signatures. Keys meant for encryption rather than signatures are left out.
+func parseJWKS(fileData []byte) ([]verificationKey, error) {
+	var keySet jsonWebKeySet
+
+	if err := json.Unmarshal(fileData, &keySet); err != nil {
+		return nil, err
+	}
+
+	keys := []verificationKey{}
+
+	for index, webKey := range keySet.Keys {
+		if webKey.Use == "enc" {
+			continue
+		}
+
+		key, err := parseJSONWebKey(webKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%q): %w", index, webKey.KeyID, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func parseJSONWebKey(webKey jsonWebKey) (verificationKey, error) {
+	key := verificationKey{id: webKey.KeyID}
+
+	switch webKey.KeyType {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(webKey.K)
+
+		if err != nil || len(secret) < 32 {
+			return key, fmt.Errorf("k must be a secret of at least 32 bytes in base64url")
+		}
+
+		key.algorithm, key.secret = "HS256", secret
+	case "RSA":
+		modulus, err := decodeBigInt(webKey.N)
+
+		if err != nil {
+			return key, fmt.Errorf("n: %w", err)
+		}
+
+		exponent, err := decodeBigInt(webKey.E)
+
+		if err != nil || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 || exponent.Int64()%2 == 0 {
+			return key, fmt.Errorf("e must be a small odd number in base64url")
+		}
+
+		if modulus.BitLen() < 2048 {
+			return key, fmt.Errorf("RSA keys must have at least 2048 bits, not %d", modulus.BitLen())
+		}
+
+		key.algorithm, key.rsaKey = "RS256", &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}
+	case "EC":
+		if webKey.Curve != "P-256" {
+			return key, fmt.Errorf("EC keys must be on curve P-256, not %q", webKey.Curve)
+		}
+
+		x, err := decodeBigInt(webKey.X)
+
+		if err != nil {
+			return key, fmt.Errorf("x: %w", err)
+		}
+
+		y, err := decodeBigInt(webKey.Y)
+
+		if err != nil {
+			return key, fmt.Errorf("y: %w", err)
+		}
+
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return key, fmt.Errorf("the point is not on curve P-256")
+		}
+
+		key.algorithm, key.ecdsaKey = "ES256", &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	default:
+		return key, fmt.Errorf("unsupported key type %q", webKey.KeyType)
+	}
+
+	if len(webKey.Algorithm) > 0 && webKey.Algorithm != key.algorithm {
+		return key, fmt.Errorf("a %s key cannot be used for %s", webKey.KeyType, webKey.Algorithm)
+	}
+
+	return key, nil
+}
+
+func decodeBigInt(text string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(text)
+
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("expected a number in base64url")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
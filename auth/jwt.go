@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is wrapped by every reason a JWT is refused.
+var ErrInvalidToken = errors.New("token is not valid")
+
+// JWTConfig says which JWTs a JWTValidator accepts and what roles their claims give.
+type JWTConfig struct {
+	// Issuer, when set, must be the token's iss claim.
+	Issuer string
+	// Audience, when set, must be, or be one of, the token's aud claim.
+	Audience string
+	// ClockSkew is how far exp and nbf may be off, allowing for clocks that disagree.
+	ClockSkew time.Duration
+	// RoleClaim names the claim holding the caller's roles, a string, a list of strings
+	// or a space-separated list as in the scope claim. It is "role" when empty.
+	RoleClaim string
+	// Roles maps values of the role claim to roles. Without it, values are role names.
+	// A token with several roles gets the most powerful one.
+	Roles map[string]Role
+	// Now tells the time, time.Now when nil.
+	Now func() time.Time
+}
+
+// JWTValidator accepts JWTs signed with HS256, RS256 or ES256 by a key in a JWKS file.
+// The file is read again whenever it changes, or on Reload.
+type JWTValidator interface {
+	// Authenticate returns the identity of the token's subject, or an error wrapping
+	// ErrInvalidToken.
+	Authenticator
+	Reload() error
+}
+
+func NewJWTValidator(jwksFilePath string, config JWTConfig) (JWTValidator, error) {
+	if len(jwksFilePath) == 0 {
+		return nil, fmt.Errorf("jwksFilePath may not be empty")
+	}
+
+	if len(config.RoleClaim) == 0 {
+		config.RoleClaim = "role"
+	}
+
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	validator := &jwtValidator{config: config, file: watchedFile{filePath: jwksFilePath}}
+
+	return validator, validator.Reload()
+}
+
+type jwtValidator struct {
+	config JWTConfig
+	file   watchedFile
+	keys   []verificationKey
+	lock   sync.Mutex
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *json.Number    `json:"exp"`
+	NotBefore *json.Number    `json:"nbf"`
+}
+
+func (validator *jwtValidator) Reload() error {
+	validator.lock.Lock()
+	defer validator.lock.Unlock()
+
+	validator.file.forget()
+
+	return validator.reload()
+}
+
+// reload reads the JWKS file again if it changed. A file that cannot be read leaves the
+// keys read before in place until it changes again.
+func (validator *jwtValidator) reload() error {
+	fileData, changed, err := validator.file.read()
+
+	if err != nil || !changed {
+		return err
+	}
+
+	keys := []verificationKey{}
+
+	if len(fileData) > 0 {
+		if keys, err = parseJWKS(fileData); err != nil {
+			return fmt.Errorf("reading JWKS file %s: %w", validator.file.filePath, err)
+		}
+	}
+
+	validator.keys = keys
+
+	return nil
+}
+
+func (validator *jwtValidator) Authenticate(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return Identity{}, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: signature is not base64url", ErrInvalidToken)
+	}
+
+	if err := validator.verify(header, parts[0]+"."+parts[1], signature); err != nil {
+		return Identity{}, err
+	}
+
+	var claims jwtClaims
+	var allClaims map[string]interface{}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	if err := decodeJWTPart(parts[1], &allClaims); err != nil {
+		return Identity{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	if err := validator.check(claims); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{Subject: claims.Subject, Role: validator.roleOf(allClaims[validator.config.RoleClaim]), Method: "jwt"}, nil
+}
+
+// verify checks the signature with the keys for the token's algorithm, only the one
+// named by kid when the token names one.
+func (validator *jwtValidator) verify(header jwtHeader, signed string, signature []byte) error {
+	switch header.Algorithm {
+	case "HS256", "RS256", "ES256":
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Algorithm)
+	}
+
+	validator.lock.Lock()
+
+	if err := validator.reload(); err != nil {
+		validator.lock.Unlock()
+		return err
+	}
+
+	keys := validator.keys
+	validator.lock.Unlock()
+
+	digest := sha256.Sum256([]byte(signed))
+	found := false
+
+	for _, key := range keys {
+		if key.algorithm != header.Algorithm || (len(header.KeyID) > 0 && key.id != header.KeyID) {
+			continue
+		}
+
+		found = true
+
+		if key.verifies(digest[:], []byte(signed), signature) {
+			return nil
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w: no %s key %q", ErrInvalidToken, header.Algorithm, header.KeyID)
+	}
+
+	return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+}
+
+func (key verificationKey) verifies(digest []byte, signed []byte, signature []byte) bool {
+	switch key.algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write(signed)
+
+		return hmac.Equal(mac.Sum(nil), signature)
+	case "RS256":
+		return rsa.VerifyPKCS1v15(key.rsaKey, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		if len(signature) != 64 {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+
+		return ecdsa.Verify(key.ecdsaKey, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// check makes sure the token is in date, allowing for clock skew, and was issued by and
+// for whom the configuration says. Tokens must expire.
+func (validator *jwtValidator) check(claims jwtClaims) error {
+	now := validator.config.Now()
+	skew := validator.config.ClockSkew
+
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: exp is missing", ErrInvalidToken)
+	}
+
+	expiresAt, err := numericDate(*claims.ExpiresAt)
+
+	if err != nil {
+		return fmt.Errorf("%w: exp: %v", ErrInvalidToken, err)
+	}
+
+	if !now.Before(expiresAt.Add(skew)) {
+		return fmt.Errorf("%w: expired at %s", ErrInvalidToken, expiresAt.UTC().Format(time.RFC3339))
+	}
+
+	if claims.NotBefore != nil {
+		notBefore, err := numericDate(*claims.NotBefore)
+
+		if err != nil {
+			return fmt.Errorf("%w: nbf: %v", ErrInvalidToken, err)
+		}
+
+		if now.Add(skew).Before(notBefore) {
+			return fmt.Errorf("%w: not valid before %s", ErrInvalidToken, notBefore.UTC().Format(time.RFC3339))
+		}
+	}
+
+	if len(validator.config.Issuer) > 0 && claims.Issuer != validator.config.Issuer {
+		return fmt.Errorf("%w: issued by %q, not %q", ErrInvalidToken, claims.Issuer, validator.config.Issuer)
+	}
+
+	if len(validator.config.Audience) > 0 && !containsAudience(claims.Audience, validator.config.Audience) {
+		return fmt.Errorf("%w: not meant for %q", ErrInvalidToken, validator.config.Audience)
+	}
+
+	if len(claims.Subject) == 0 {
+		return fmt.Errorf("%w: sub is missing", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+// roleOf returns the most powerful role the role claim gives.
+func (validator *jwtValidator) roleOf(claim interface{}) Role {
+	values := []string{}
+
+	switch claim := claim.(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []interface{}:
+		for _, value := range claim {
+			if text, ok := value.(string); ok {
+				values = append(values, text)
+			}
+		}
+	}
+
+	best := NoRole
+
+	for _, value := range values {
+		role, ok := validator.config.Roles[value]
+
+		if validator.config.Roles == nil {
+			parsed, err := ParseRole(value)
+			role, ok = parsed, err == nil
+		}
+
+		if ok && role.Allows(best) {
+			best = role
+		}
+	}
+
+	return best
+}
+
+func decodeJWTPart(part string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+
+	if err != nil {
+		return fmt.Errorf("not base64url")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+
+	return decoder.Decode(value)
+}
+
+// maxNumericDate is the last second of the year 9999, beyond which dates are refused
+// rather than risk their seconds overflowing.
+const maxNumericDate = 253402300799
+
+func numericDate(number json.Number) (time.Time, error) {
+	seconds, err := number.Float64()
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected seconds since the epoch, got %q", number)
+	}
+
+	if seconds < 0 || seconds > maxNumericDate {
+		return time.Time{}, fmt.Errorf("expected seconds since the epoch up to the year 9999, got %q", number)
+	}
+
+	whole, fraction := math.Modf(seconds)
+
+	return time.Unix(int64(whole), int64(fraction*1e9)), nil
+}
+
+func containsAudience(audience json.RawMessage, expected string) bool {
+	var single string
+
+	if err := json.Unmarshal(audience, &single); err == nil {
+		return single == expected
+	}
+
+	var list []string
+
+	if err := json.Unmarshal(audience, &list); err == nil {
+		for _, value := range list {
+			if value == expected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
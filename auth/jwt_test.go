@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC)
+
+func encodePart(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken makes a JWT with claims signed by key, a []byte secret, *rsa.PrivateKey or
+// *ecdsa.PrivateKey.
+func signToken(t *testing.T, algorithm string, keyID string, key interface{}, claims map[string]interface{}) string {
+	signed := encodePart(t, map[string]string{"alg": algorithm, "kid": keyID, "typ": "JWT"}) + "." + encodePart(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func claimsFor(subject string, extra map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{"sub": subject, "iss": "accounts", "aud": []string{"petServer", "billing"}, "exp": testNow.Add(time.Hour).Unix(), "role": "editor"}
+
+	for name, value := range extra {
+		claims[name] = value
+	}
+
+	return claims
+}
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func TestValidatingJWTs(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestValidatingJWTs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	secret := []byte("a secret of at least thirty-two bytes")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "shared", "k": base64.RawURLEncoding.EncodeToString(secret)},
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeBigInt(ecdsaKey.X), "y": encodeBigInt(ecdsaKey.Y)},
+	}}
+
+	jwksFilePath := filepath.Join(directory, "jwks.json")
+	jwksData, _ := json.Marshal(jwks)
+
+	if err := ioutil.WriteFile(jwksFilePath, jwksData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	validator, err := NewJWTValidator(jwksFilePath, JWTConfig{
+		Issuer:    "accounts",
+		Audience:  "petServer",
+		ClockSkew: time.Minute,
+		Roles:     map[string]Role{"editor": Editor, "viewer": Reader, "root": Admin},
+		Now:       func() time.Time { return testNow },
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherSecret := []byte("another secret of thirty-two bytes or more")
+
+	tests := []struct {
+		name  string
+		token string
+		role  Role
+	}{
+		{"HS256", signToken(t, "HS256", "shared", secret, claimsFor("alice", nil)), Editor},
+		{"RS256", signToken(t, "RS256", "rsa", rsaKey, claimsFor("alice", nil)), Editor},
+		{"ES256 without kid", signToken(t, "ES256", "", ecdsaKey, claimsFor("alice", nil)), Editor},
+		{"roles list", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"role": []string{"viewer", "root"}})), Admin},
+		{"unknown role", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"role": "owner"})), NoRole},
+		{"expired within skew", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"exp": testNow.Add(-30 * time.Second).Unix()})), Editor},
+		{"not yet valid within skew", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"nbf": testNow.Add(30 * time.Second).Unix()})), Editor},
+		{"single audience", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"aud": "petServer"})), Editor},
+		{"exp centuries away", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"exp": 1e10})), Editor},
+		{"exp beyond any date", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"exp": 1e19})), ""},
+		{"nbf beyond any date", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"nbf": 1e19})), ""},
+		{"expired", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"exp": testNow.Add(-2 * time.Minute).Unix()})), ""},
+		{"not yet valid", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"nbf": testNow.Add(2 * time.Minute).Unix()})), ""},
+		{"no exp", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"exp": nil})), ""},
+		{"other audience", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"aud": "billing"})), ""},
+		{"other issuer", signToken(t, "HS256", "shared", secret, claimsFor("alice", map[string]interface{}{"iss": "mallory"})), ""},
+		{"no subject", signToken(t, "HS256", "shared", secret, claimsFor("", nil)), ""},
+		{"other secret", signToken(t, "HS256", "shared", otherSecret, claimsFor("alice", nil)), ""},
+		{"unknown kid", signToken(t, "RS256", "old", rsaKey, claimsFor("alice", nil)), ""},
+		{"algorithm of another key", signToken(t, "HS256", "rsa", secret, claimsFor("alice", nil)), ""},
+		{"none", encodePart(t, map[string]string{"alg": "none"}) + "." + encodePart(t, claimsFor("alice", nil)) + ".", ""},
+		{"not a JWT", "pet_1234_abcd", ""},
+	}
+
+	for _, test := range tests {
+		identity, err := validator.Authenticate(test.token)
+
+		if len(test.role) == 0 && test.name != "unknown role" {
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("%s: expected ErrInvalidToken, got %+v %v", test.name, identity, err)
+			}
+
+			continue
+		}
+
+		if err != nil || identity != (Identity{Subject: "alice", Role: test.role, Method: "jwt"}) {
+			t.Errorf("%s: expected alice with role %q, got %+v %v", test.name, test.role, identity, err)
+		}
+	}
+
+	// Rotating the shared secret out of the file makes its tokens invalid straight away.
+	jwks["keys"] = jwks["keys"].([]map[string]string)[1:]
+	jwksData, _ = json.Marshal(jwks)
+
+	if err := ioutil.WriteFile(jwksFilePath, jwksData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validator.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := validator.Authenticate(tests[0].token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected a token signed with a removed key to be refused, got %v", err)
+	}
+
+	if _, err := validator.Authenticate(tests[1].token); err != nil {
+		t.Errorf("expected a token signed with a kept key to be accepted, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(jwksFilePath, []byte(`{"keys":[{"kty":"oct","k":"c2hvcnQ"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validator.Reload(); err == nil {
+		t.Errorf("expected a JWKS file with a short secret to be refused")
+	}
+
+	if _, err := validator.Authenticate(tests[1].token); err != nil {
+		t.Errorf("expected a bad JWKS file to leave the keys read before in place, got %v", err)
+	}
+}
+
+func TestRSAKeysNeedAnOddExponent(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for exponent, valid := range map[int64]bool{65537: true, 3: true, 65536: false, 4: false, 1: false} {
+		_, err := parseJSONWebKey(jsonWebKey{KeyType: "RSA", N: encodeBigInt(rsaKey.N), E: encodeBigInt(big.NewInt(exponent))})
+
+		if valid != (err == nil) {
+			t.Errorf("expected exponent %d to be valid: %v, got %v", exponent, valid, err)
+		}
+	}
+}
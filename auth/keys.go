@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("API key not found")
+var ErrInvalidKey = errors.New("API key is not valid")
+
+// keyPrefix starts every API key, so that keys are easy to recognise in configuration
+// and logs, and easy to tell from other bearer tokens.
+const keyPrefix = "pet_"
+
+// APIKey describes a key without the key itself, of which only a hash is kept.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type keyFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// KeyStore keeps API keys in a key file. Keys are long random strings, so an unsalted
+// SHA-256 hash is enough to keep them safe at rest. Changes made to the file by another
+// process, such as the key commands, are picked up on the next Authenticate.
+type KeyStore interface {
+	// Create makes a new key for name with role, returning the key, which cannot be
+	// recovered later, and its description.
+	Create(name string, role Role) (string, APIKey, error)
+	Revoke(id string) error
+	Keys() ([]APIKey, error)
+	// Authenticate returns the identity an API key belongs to, or ErrInvalidKey.
+	Authenticator
+}
+
+func NewKeyStore(filePath string) (KeyStore, error) {
+	if len(filePath) == 0 {
+		return nil, fmt.Errorf("filePath may not be empty")
+	}
+
+	return &keyStore{filePath: filePath, file: watchedFile{filePath: filePath}}, nil
+}
+
+type keyStore struct {
+	filePath string
+	file     watchedFile
+	keys     keyFile
+	lock     sync.Mutex
+}
+
+func (store *keyStore) Create(name string, role Role) (string, APIKey, error) {
+	if len(strings.TrimSpace(name)) == 0 {
+		return "", APIKey{}, fmt.Errorf("name may not be empty")
+	}
+
+	if _, err := ParseRole(string(role)); err != nil {
+		return "", APIKey{}, err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.reload(); err != nil {
+		return "", APIKey{}, err
+	}
+
+	id, err := randomHex(4)
+
+	if err != nil {
+		return "", APIKey{}, err
+	}
+
+	secret, err := randomHex(24)
+
+	if err != nil {
+		return "", APIKey{}, err
+	}
+
+	key := keyPrefix + id + "_" + secret
+	apiKey := APIKey{ID: id, Name: name, Role: role, Hash: hashKey(key), CreatedAt: time.Now().UTC()}
+
+	store.keys.Keys = append(store.keys.Keys, apiKey)
+
+	return key, apiKey, store.write()
+}
+
+func (store *keyStore) Revoke(id string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.reload(); err != nil {
+		return err
+	}
+
+	for index, apiKey := range store.keys.Keys {
+		if apiKey.ID == id {
+			store.keys.Keys = append(store.keys.Keys[:index], store.keys.Keys[index+1:]...)
+			return store.write()
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+}
+
+// Keys lists the keys oldest first.
+func (store *keyStore) Keys() ([]APIKey, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+
+	keys := append([]APIKey{}, store.keys.Keys...)
+
+	sort.SliceStable(keys, func(i int, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// Authenticate compares the hash of key with that of every key in constant time, so
+// the time it takes says nothing about which keys exist.
+func (store *keyStore) Authenticate(key string) (Identity, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.reload(); err != nil {
+		return Identity{}, err
+	}
+
+	hash := []byte(hashKey(key))
+	found := -1
+
+	for index, apiKey := range store.keys.Keys {
+		if subtle.ConstantTimeCompare(hash, []byte(apiKey.Hash)) == 1 {
+			found = index
+		}
+	}
+
+	if found < 0 || !strings.HasPrefix(key, keyPrefix) {
+		return Identity{}, ErrInvalidKey
+	}
+
+	apiKey := store.keys.Keys[found]
+
+	return Identity{Subject: apiKey.Name, Role: apiKey.Role, Method: "api-key"}, nil
+}
+
+// reload reads the key file again if it changed since it was last read. A missing file
+// holds no keys, and one that cannot be read leaves the keys read before in place until
+// it changes again.
+func (store *keyStore) reload() error {
+	fileData, changed, err := store.file.read()
+
+	if err != nil || !changed {
+		return err
+	}
+
+	var keys keyFile
+
+	if len(fileData) > 0 {
+		if err := json.Unmarshal(fileData, &keys); err != nil {
+			return fmt.Errorf("reading key file %s: %w", store.filePath, err)
+		}
+	}
+
+	store.keys = keys
+
+	return nil
+}
+
+// write replaces the key file through a temporary file, so that a server reading it
+// never sees half of it, and keeps it readable by its owner only.
+func (store *keyStore) write() error {
+	serializedKeys, err := json.MarshalIndent(store.keys, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	temporaryFile, err := ioutil.TempFile(filepath.Dir(store.filePath), filepath.Base(store.filePath)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temporaryFile.Name())
+
+	if _, err := temporaryFile.Write(serializedKeys); err != nil {
+		_ = temporaryFile.Close()
+		return err
+	}
+
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temporaryFile.Name(), store.filePath); err != nil {
+		return err
+	}
+
+	store.file.forget()
+
+	return nil
+}
+
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(size int) (string, error) {
+	random := make([]byte, size)
+
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(random), nil
+}
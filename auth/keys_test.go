@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreatingAuthenticatingAndRevokingKeys(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestCreatingAuthenticatingAndRevokingKeys")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "keys.json")
+	store, err := NewKeyStore(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.Create("ci", Role("owner")); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+
+	key, apiKey, err := store.Create("ci", Editor)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileData, err := ioutil.ReadFile(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(fileData), key) || !strings.Contains(string(fileData), apiKey.Hash) {
+		t.Errorf("expected the key file to hold the hash of the key and not the key: %s", fileData)
+	}
+
+	if info, err := os.Stat(filePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the key file to be readable by its owner only, got %v %v", info.Mode(), err)
+	}
+
+	// A second store stands in for the server while the first one is the key command.
+	server, _ := NewKeyStore(filePath)
+
+	identity, err := server.Authenticate(key)
+
+	if err != nil || identity != (Identity{Subject: "ci", Role: Editor, Method: "api-key"}) {
+		t.Errorf("expected the key to authenticate as ci, got %+v %v", identity, err)
+	}
+
+	if _, err := server.Authenticate(key + "x"); err != ErrInvalidKey {
+		t.Errorf("expected ErrInvalidKey for a wrong key, got %v", err)
+	}
+
+	if err := store.Revoke(apiKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := server.Authenticate(key); err != ErrInvalidKey {
+		t.Errorf("expected a revoked key to be refused, got %v", err)
+	}
+
+	if err := store.Revoke(apiKey.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound revoking twice, got %v", err)
+	}
+
+	if keys, err := server.Keys(); err != nil || len(keys) != 0 {
+		t.Errorf("expected no keys, got %+v %v", keys, err)
+	}
+}
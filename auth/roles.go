@@ -0,0 +1,146 @@
+// Package auth decides who is making a request and what they may do: API keys kept
+// hashed in a local key file, the roles they carry, and the policy that says which role
+// each route and method needs.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidRole = errors.New("role must be reader, editor or admin")
+
+// Role says what a caller may do. Each role may do everything the roles below it may.
+type Role string
+
+const (
+	// NoRole is needed by routes anyone may use, credentials or not.
+	NoRole Role = ""
+	Reader Role = "reader"
+	Editor Role = "editor"
+	Admin  Role = "admin"
+)
+
+var roleRanks = map[Role]int{NoRole: 0, Reader: 1, Editor: 2, Admin: 3}
+
+func ParseRole(text string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(text)))
+
+	if _, ok := roleRanks[role]; !ok || role == NoRole {
+		return NoRole, fmt.Errorf("%w, not %q", ErrInvalidRole, text)
+	}
+
+	return role, nil
+}
+
+// Allows reports whether a caller with role may do what needs required.
+func (role Role) Allows(required Role) bool {
+	rank, ok := roleRanks[role]
+
+	return ok && rank >= roleRanks[required]
+}
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	// Subject names the caller, such as the name of an API key.
+	Subject string
+	Role    Role
+	// Method says how the caller was authenticated, such as "api-key".
+	Method string
+}
+
+// Authenticator finds the identity a credential, such as an API key, belongs to.
+type Authenticator interface {
+	Authenticate(credential string) (Identity, error)
+}
+
+// rule requires role for requests with method, or any method when it is empty, to
+// paths under path, or only to path itself when exact.
+type rule struct {
+	method string
+	path   string
+	exact  bool
+	role   Role
+}
+
+// Policy says which role each route and method needs. The most specific rule wins: a
+// rule for an exact path over one for a prefix, a longer prefix over a shorter one, and
+// a rule for the method over one for any method. Requests no rule covers need the
+// default role.
+type Policy struct {
+	rules       []rule
+	defaultRole Role
+}
+
+// NewPolicy makes a policy needing defaultRole wherever no rule says otherwise.
+func NewPolicy(defaultRole Role) *Policy {
+	return &Policy{defaultRole: defaultRole}
+}
+
+// DefaultPolicy lets readers read, editors change pets and everything about them, and
+// only admins close the server.
+func DefaultPolicy() *Policy {
+	policy := NewPolicy(Editor)
+
+	for _, method := range []string{"GET", "HEAD"} {
+		policy.Require(method, "/", Reader)
+	}
+
+	policy.Require("", "/close", Admin)
+
+	return policy
+}
+
+// Require makes requests with method, or any method when it is "", to path need role.
+// A path ending in "/" covers every path under it, as with http.ServeMux.
+func (policy *Policy) Require(method string, path string, role Role) {
+	policy.rules = append(policy.rules, rule{
+		method: strings.ToUpper(method),
+		path:   path,
+		exact:  !strings.HasSuffix(path, "/"),
+		role:   role,
+	})
+
+	sort.SliceStable(policy.rules, func(i int, j int) bool {
+		return policy.rules[i].specificity() > policy.rules[j].specificity()
+	})
+}
+
+func (rule rule) specificity() int {
+	specificity := len(rule.path) * 4
+
+	if rule.exact {
+		specificity += 2
+	}
+
+	if len(rule.method) > 0 {
+		specificity++
+	}
+
+	return specificity
+}
+
+func (rule rule) matches(method string, path string) bool {
+	if len(rule.method) > 0 && rule.method != method {
+		return false
+	}
+
+	if rule.exact {
+		return path == rule.path
+	}
+
+	return strings.HasPrefix(path, rule.path)
+}
+
+// RoleFor returns the role a request with method to path needs.
+func (policy *Policy) RoleFor(method string, path string) Role {
+	for _, rule := range policy.rules {
+		if rule.matches(method, path) {
+			return rule.role
+		}
+	}
+
+	return policy.defaultRole
+}
@@ -0,0 +1,41 @@
+package auth
+
+import "testing"
+
+func TestRoles(t *testing.T) {
+	if !Admin.Allows(Editor) || !Editor.Allows(Reader) || Reader.Allows(Editor) || !Reader.Allows(NoRole) || Role("owner").Allows(NoRole) {
+		t.Errorf("roles do not rank admin over editor over reader")
+	}
+
+	if role, err := ParseRole(" Editor "); role != Editor || err != nil {
+		t.Errorf("expected editor, got %q %v", role, err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Require("", "/calendar.ics", NoRole)
+	policy.Require("DELETE", "/pets/", Admin)
+
+	tests := []struct {
+		method string
+		path   string
+		role   Role
+	}{
+		{"GET", "/pet", Reader},
+		{"HEAD", "/pets/Shasta/photos", Reader},
+		{"PUT", "/pet", Editor},
+		{"POST", "/pets/import", Editor},
+		{"DELETE", "/pet", Editor},
+		{"DELETE", "/pets/Shasta/photos/1", Admin},
+		{"GET", "/close", Admin},
+		{"PUT", "/close", Admin},
+		{"GET", "/calendar.ics", NoRole},
+	}
+
+	for _, test := range tests {
+		if role := policy.RoleFor(test.method, test.path); role != test.role {
+			t.Errorf("%s %s: expected %q, got %q", test.method, test.path, test.role, role)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package codecs encodes and decodes request and response bodies in the formats the
+// server speaks, and picks the format from Accept and Content-Type headers.
+package codecs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec reads and writes one media type. Aliases are other media types, such as
+// text/xml for application/xml, that name the same format.
+type Codec struct {
+	MediaType string
+	Aliases   []string
+	Encode    func(writer io.Writer, value interface{}) error
+	Decode    func(reader io.Reader, value interface{}) error
+}
+
+func (codec Codec) mediaTypes() []string {
+	return append([]string{codec.MediaType}, codec.Aliases...)
+}
+
+// Registry holds the codecs a server offers, the first being the default for clients
+// that accept anything.
+type Registry struct {
+	codecs []Codec
+}
+
+func NewRegistry(codecs ...Codec) *Registry {
+	return &Registry{codecs: codecs}
+}
+
+// NewDefaultRegistry offers JSON, XML, YAML, CSV and MessagePack, preferring JSON.
+func NewDefaultRegistry() *Registry {
+	return NewRegistry(JSON, XML, YAML, CSV, MessagePack)
+}
+
+// Register adds codec, replacing any codec for the same media type.
+func (registry *Registry) Register(codec Codec) {
+	for index, existingCodec := range registry.codecs {
+		if existingCodec.MediaType == codec.MediaType {
+			registry.codecs[index] = codec
+			return
+		}
+	}
+
+	registry.codecs = append(registry.codecs, codec)
+}
+
+// MediaTypes lists the media types of the registered codecs, default first.
+func (registry *Registry) MediaTypes() []string {
+	mediaTypes := []string{}
+
+	for _, codec := range registry.codecs {
+		mediaTypes = append(mediaTypes, codec.MediaType)
+	}
+
+	return mediaTypes
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+	position  int
+}
+
+// specificity ranks type/subtype above type/* above */*.
+func (mediaRange mediaRange) specificity() int {
+	switch {
+	case mediaRange.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange.mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (mediaRange mediaRange) matches(mediaType string) bool {
+	switch mediaRange.specificity() {
+	case 0:
+		return true
+	case 1:
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange.mediaType, "*"))
+	default:
+		return mediaRange.mediaType == mediaType
+	}
+}
+
+func parseAccept(accept string) []mediaRange {
+	mediaRanges := []mediaRange{}
+
+	for position, part := range strings.Split(accept, ",") {
+		mediaType, parameters, err := mime.ParseMediaType(strings.TrimSpace(part))
+
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+
+		if q, ok := parameters["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		mediaRanges = append(mediaRanges, mediaRange{mediaType: mediaType, quality: quality, position: position})
+	}
+
+	return mediaRanges
+}
+
+// ForAccept picks the codec an Accept header prefers. Each codec gets the quality of
+// the most specific range that matches it; the best quality wins, then the range the
+// client listed first, then the registry's order. An empty header accepts the default.
+func (registry *Registry) ForAccept(accept string) (Codec, bool) {
+	if len(registry.codecs) == 0 {
+		return Codec{}, false
+	}
+
+	if len(strings.TrimSpace(accept)) == 0 {
+		return registry.codecs[0], true
+	}
+
+	mediaRanges := parseAccept(accept)
+
+	type candidate struct {
+		codec      Codec
+		mediaRange mediaRange
+	}
+
+	candidates := []candidate{}
+
+	for _, codec := range registry.codecs {
+		best := mediaRange{position: -1}
+
+		for _, mediaRange := range mediaRanges {
+			for _, mediaType := range codec.mediaTypes() {
+				if mediaRange.matches(mediaType) && (best.position < 0 || mediaRange.specificity() > best.specificity()) {
+					best = mediaRange
+				}
+			}
+		}
+
+		if best.position >= 0 && best.quality > 0 {
+			candidates = append(candidates, candidate{codec: codec, mediaRange: best})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Codec{}, false
+	}
+
+	sort.SliceStable(candidates, func(i int, j int) bool {
+		if candidates[i].mediaRange.quality != candidates[j].mediaRange.quality {
+			return candidates[i].mediaRange.quality > candidates[j].mediaRange.quality
+		}
+
+		return candidates[i].mediaRange.position < candidates[j].mediaRange.position
+	})
+
+	return candidates[0].codec, true
+}
+
+// ForContentType picks the codec for a request body. Bodies without a Content-Type are
+// taken to be in the default format.
+func (registry *Registry) ForContentType(contentType string) (Codec, bool) {
+	if len(registry.codecs) == 0 {
+		return Codec{}, false
+	}
+
+	if len(strings.TrimSpace(contentType)) == 0 {
+		return registry.codecs[0], true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return Codec{}, false
+	}
+
+	for _, codec := range registry.codecs {
+		for _, codecMediaType := range codec.mediaTypes() {
+			if codecMediaType == mediaType {
+				return codec, true
+			}
+		}
+	}
+
+	return Codec{}, false
+}
+
+// ErrTrailingData is returned when a body holds more than the one value decoded from it.
+var ErrTrailingData = errors.New("codecs: unexpected data after the value")
+
+// JSON is encoding/json, except that decoding streams from the reader and refuses
+// fields the value has no place for and anything after the value.
+var JSON = Codec{
+	MediaType: "application/json",
+	Encode: func(writer io.Writer, value interface{}) error {
+		encoded, err := json.Marshal(value)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = writer.Write(encoded)
+
+		return err
+	},
+	Decode: func(reader io.Reader, value interface{}) error {
+		decoder := json.NewDecoder(reader)
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(value); err != nil {
+			return err
+		}
+
+		if _, err := decoder.Token(); err != io.EOF {
+			if err != nil {
+				return err
+			}
+
+			return ErrTrailingData
+		}
+
+		return nil
+	},
+}
+
+// treeCodec makes a codec for a format written from and read into a tree.
+func treeCodec(mediaType string, aliases []string, write func(writer io.Writer, tree interface{}) error, read func(reader io.Reader) (interface{}, error)) Codec {
+	return Codec{
+		MediaType: mediaType,
+		Aliases:   aliases,
+		Encode: func(writer io.Writer, value interface{}) error {
+			tree, err := toTree(value)
+
+			if err != nil {
+				return err
+			}
+
+			return write(writer, tree)
+		},
+		Decode: func(reader io.Reader, value interface{}) error {
+			tree, err := read(reader)
+
+			if err != nil {
+				return err
+			}
+
+			return fromTree(tree, value)
+		},
+	}
+}
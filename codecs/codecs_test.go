@@ -0,0 +1,222 @@
+package codecs
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPet struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Age      int       `json:"age"`
+	WeightKg float64   `json:"weight_kg,omitempty"`
+	Neutered bool      `json:"neutered,omitempty"`
+	Notes    string    `json:"notes,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Seen     time.Time `json:"seen"`
+}
+
+type testPets struct {
+	Collection map[string]testPet `json:"pets_collection"`
+}
+
+func testCollection() testPets {
+	seen := time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC)
+
+	return testPets{Collection: map[string]testPet{
+		"01A": {ID: "01A", Name: "Shasta", Age: 9, WeightKg: 7.5, Neutered: true, Notes: "Bath, trim: \"nails\"\n# not a comment", Tags: []string{"fluffy", "- loud"}, Seen: seen},
+		"01B": {ID: "01B", Name: "123", Age: -1, Tags: []string{}, Seen: seen},
+	}}
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSON, XML, YAML, CSV, MessagePack} {
+		t.Run(codec.MediaType, func(t *testing.T) {
+			var encoded bytes.Buffer
+
+			if err := codec.Encode(&encoded, testCollection()); err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded testPets
+
+			if err := codec.Decode(bytes.NewReader(encoded.Bytes()), &decoded); err != nil {
+				t.Fatalf("decoding failed: %v\n%s", err, encoded.String())
+			}
+
+			expected := testCollection()
+
+			// Empty and missing lists cannot be told apart in every format.
+			for id, pet := range decoded.Collection {
+				if len(pet.Tags) == 0 {
+					pet.Tags = expected.Collection[id].Tags
+					decoded.Collection[id] = pet
+				}
+			}
+
+			if !reflect.DeepEqual(decoded, expected) {
+				t.Errorf("expected %+v, got %+v\n%s", expected, decoded, encoded.String())
+			}
+		})
+	}
+}
+
+func TestChoosingCodecForAccept(t *testing.T) {
+	registry := NewDefaultRegistry()
+
+	for accept, expected := range map[string]string{
+		"":                             "application/json",
+		"*/*":                          "application/json",
+		"text/csv":                     "text/csv",
+		"text/*;q=0.5, text/csv;q=0.9": "text/csv",
+		"application/xml;q=0.5, application/yaml":     "application/yaml",
+		"application/x-msgpack, application/json":     "application/msgpack",
+		"application/json;q=0, */*;q=0.1":             "application/xml",
+		"text/html, application/xhtml+xml, */*;q=0.8": "application/json",
+	} {
+		codec, ok := registry.ForAccept(accept)
+
+		if !ok || codec.MediaType != expected {
+			t.Errorf("Accept %q: expected %s, got %s", accept, expected, codec.MediaType)
+		}
+	}
+
+	if _, ok := registry.ForAccept("text/html, image/*"); ok {
+		t.Error("expected nothing to match text/html, image/*")
+	}
+
+	if codec, ok := registry.ForContentType("text/yaml; charset=utf-8"); !ok || codec.MediaType != "application/yaml" {
+		t.Errorf("expected YAML for text/yaml, got %s", codec.MediaType)
+	}
+
+	if _, ok := registry.ForContentType("text/plain"); ok {
+		t.Error("expected nothing to match text/plain")
+	}
+}
+
+func TestReadingHandWrittenYAML(t *testing.T) {
+	document := `
+# pets to add
+pets_collection:
+  Buttons:
+    name: Buttons   # the small one
+    age: 2
+    tags:
+    - "terrier"
+    - 'it''s a dog'
+  Gracie: {name: Gracie, age: 9}
+`
+	var decoded testPets
+
+	if err := YAML.Decode(strings.NewReader(document), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	buttons := decoded.Collection["Buttons"]
+
+	if buttons.Name != "Buttons" || buttons.Age != 2 || !reflect.DeepEqual(buttons.Tags, []string{"terrier", "it's a dog"}) {
+		t.Errorf("unexpected Buttons: %+v", buttons)
+	}
+
+	if decoded.Collection["Gracie"].Age != 9 {
+		t.Errorf("unexpected Gracie: %+v", decoded.Collection["Gracie"])
+	}
+}
+
+func TestReadingYAMLScalars(t *testing.T) {
+	document := `server:
+  address: ":8080"   # everywhere
+  drain_timeout: 30s
+log:
+  file:
+  max_bytes: 1024
+`
+	scalars, err := ReadYAMLScalars(strings.NewReader(document))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []YAMLScalar{{"server.address", ":8080", 2}, {"server.drain_timeout", "30s", 3}, {"log.file", "", 5}, {"log.max_bytes", "1024", 6}}
+
+	if !reflect.DeepEqual(scalars, expected) {
+		t.Errorf("expected %v, got %v", expected, scalars)
+	}
+
+	if _, err := ReadYAMLScalars(strings.NewReader("server:\n  addresses:\n  - :8080\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected a list to be refused, got %v", err)
+	}
+}
+
+func TestWritingCSV(t *testing.T) {
+	var encoded bytes.Buffer
+
+	pets := testPets{Collection: map[string]testPet{"01A": {ID: "01A", Name: "Shasta", Age: 9}}}
+
+	if err := CSV.Encode(&encoded, pets); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "id,name,age,seen\n01A,Shasta,9,0001-01-01T00:00:00Z\n"; encoded.String() != expected {
+		t.Errorf("expected %q, got %q", expected, encoded.String())
+	}
+}
+
+func TestDecodingRefusesUnknownFieldsAndTrailingData(t *testing.T) {
+	tests := []struct {
+		codec Codec
+		body  string
+	}{
+		{JSON, `{"pets_collection":{},"owner":"alice"}`},
+		{JSON, `{"pets_collection":{}} {"pets_collection":{}}`},
+		{JSON, `{"pets_collection":{}}garbage`},
+		{XML, `<response><pets_collection></pets_collection><owner>alice</owner></response>`},
+		{XML, `<response></response><response></response>`},
+		{YAML, "pets_collection:\n  01A:\n    nickname: Shasta\n"},
+		{CSV, "id,name,nickname\n01A,Shasta,Shasta\n"},
+		{MessagePack, "\x81\xa5owner\xa5alice"},
+		{MessagePack, "\x80\xc0"},
+	}
+
+	for _, test := range tests {
+		var decoded testPets
+
+		if err := test.codec.Decode(strings.NewReader(test.body), &decoded); err == nil {
+			t.Errorf("%s: expected an error decoding %q", test.codec.MediaType, test.body)
+		}
+	}
+
+	var decoded testPets
+
+	if err := JSON.Decode(strings.NewReader("{\"pets_collection\":{}}\n\n"), &decoded); err != nil {
+		t.Errorf("expected trailing whitespace to be allowed, got %v", err)
+	}
+
+	if err := XML.Decode(strings.NewReader("<response></response>\n<!-- done -->\n"), &decoded); err != nil {
+		t.Errorf("expected a trailing comment to be allowed, got %v", err)
+	}
+}
+
+func TestShortMessagePackStringsAllocateLittle(t *testing.T) {
+	// A 32 bit string header declaring nearly the largest length allowed, then two bytes.
+	body := "\x81\xafpets_collection\xdb\x00\xff\xff\xffab"
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	var decoded testPets
+
+	if err := MessagePack.Decode(strings.NewReader(body), &decoded); err == nil {
+		t.Error("expected a string shorter than declared to be refused")
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected a short body to allocate little, allocated %d bytes", allocated)
+	}
+}
@@ -0,0 +1,211 @@
+package codecs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// CSV writes a table with a row per element of the collection a value holds: a list,
+// an object whose values are all objects (such as pets keyed by ID), or either of
+// those wrapped in an object with a single key. Anything else is a single row.
+// Nested objects become columns named "outer.inner" and lists are written as JSON.
+// Reading gives a list of rows, each an object of text, which fills a map keyed by
+// each row's id, or else name, column.
+var CSV = treeCodec("text/csv", []string{"application/csv"}, writeCSV, readCSV)
+
+func writeCSV(writer io.Writer, tree interface{}) error {
+	rows := csvRows(tree)
+	columns := []string{}
+	seen := make(map[string]bool)
+	flatRows := []map[string]string{}
+
+	for _, row := range rows {
+		flatRow := make(map[string]string)
+		flattenCSV(row, "", flatRow, func(column string) {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		})
+		flatRows = append(flatRows, flatRow)
+	}
+
+	csvWriter := csv.NewWriter(writer)
+
+	if err := csvWriter.Write(columns); err != nil {
+		return err
+	}
+
+	for _, flatRow := range flatRows {
+		record := make([]string, len(columns))
+
+		for index, column := range columns {
+			record[index] = flatRow[column]
+		}
+
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+// csvRows finds the collection in tree that makes up the table.
+func csvRows(tree interface{}) []interface{} {
+	if wrapper, ok := tree.(object); ok && len(wrapper) == 1 && !isScalar(wrapper[0].value) {
+		tree = wrapper[0].value
+	}
+
+	switch tree := tree.(type) {
+	case []interface{}:
+		return tree
+	case object:
+		rows := []interface{}{}
+
+		for _, field := range tree {
+			if _, ok := field.value.(object); !ok {
+				return []interface{}{tree}
+			}
+
+			rows = append(rows, field.value)
+		}
+
+		return rows
+	default:
+		return []interface{}{tree}
+	}
+}
+
+func flattenCSV(tree interface{}, prefix string, row map[string]string, addColumn func(column string)) {
+	switch tree := tree.(type) {
+	case object:
+		for _, field := range tree {
+			flattenCSV(field.value, prefix+field.key+".", row, addColumn)
+		}
+	case []interface{}:
+		encoded, _ := json.Marshal(plain(tree))
+		setCSVCell(row, prefix, string(encoded), addColumn)
+	case nil:
+		setCSVCell(row, prefix, "", addColumn)
+	default:
+		text, _ := scalarText(tree)
+		setCSVCell(row, prefix, text, addColumn)
+	}
+}
+
+func setCSVCell(row map[string]string, prefix string, text string, addColumn func(column string)) {
+	column := strings.TrimSuffix(prefix, ".")
+
+	if len(column) == 0 {
+		column = "value"
+	}
+
+	addColumn(column)
+	row[column] = text
+}
+
+func readCSV(reader io.Reader) (interface{}, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+
+	if err == io.EOF {
+		return []interface{}{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []interface{}{}
+
+	for {
+		record, err := csvReader.Read()
+
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, csvRow(header, record))
+	}
+}
+
+// csvRow reads a record as an object, leaving out empty cells and columns without a
+// name.
+func csvRow(header []string, record []string) object {
+	row := object{}
+
+	for index, column := range header {
+		if index < len(record) && len(record[index]) > 0 && len(column) > 0 {
+			row = setCSVField(row, strings.Split(column, "."), csvCell(record[index]))
+		}
+	}
+
+	return row
+}
+
+// csvCell reads a cell, taking cells that hold a JSON list to be that list.
+func csvCell(text string) interface{} {
+	if strings.HasPrefix(text, "[") {
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+
+		if list, err := readTree(decoder); err == nil {
+			return list
+		}
+	}
+
+	return text
+}
+
+func setCSVField(row object, path []string, value interface{}) object {
+	if len(path) == 1 {
+		return append(row, field{key: path[0], value: value})
+	}
+
+	for index, existing := range row {
+		if nested, ok := existing.value.(object); ok && existing.key == path[0] {
+			row[index].value = setCSVField(nested, path[1:], value)
+			return row
+		}
+	}
+
+	return append(row, field{key: path[0], value: setCSVField(object{}, path[1:], value)})
+}
+
+// DecodeRecord stores one CSV record, read under header, in the value target points
+// to, the way CSV.Decode stores each row.
+func DecodeRecord(header []string, record []string, target interface{}) error {
+	return fromTree(csvRow(header, record), target)
+}
+
+// EncodeRecord writes value as one CSV record with the given columns, the way
+// CSV.Encode writes each row.
+func EncodeRecord(header []string, value interface{}) ([]string, error) {
+	tree, err := toTree(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]string)
+	flattenCSV(tree, "", row, func(column string) {})
+
+	record := make([]string, len(header))
+
+	for index, column := range header {
+		record[index] = row[column]
+	}
+
+	return record, nil
+}
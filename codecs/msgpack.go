@@ -0,0 +1,306 @@
+package codecs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// maxMessagePackLength bounds the length of strings and collections MessagePack input
+// may declare, so a short malicious message cannot make the decoder allocate much.
+const maxMessagePackLength = 1 << 24
+
+var errMessagePackTooLong = errors.New("msgpack: declared length too long")
+
+// MessagePack writes integers in their smallest encoding, other numbers as float64
+// and objects as maps with string keys. Reading accepts any MessagePack except
+// extension types; binary values read as strings.
+var MessagePack = treeCodec("application/msgpack", []string{"application/x-msgpack", "application/vnd.msgpack"}, writeMessagePack, readMessagePack)
+
+func writeMessagePack(writer io.Writer, tree interface{}) error {
+	buffered := bufio.NewWriter(writer)
+
+	if err := writeMessagePackValue(buffered, tree); err != nil {
+		return err
+	}
+
+	return buffered.Flush()
+}
+
+func writeMessagePackValue(writer *bufio.Writer, tree interface{}) error {
+	switch tree := tree.(type) {
+	case nil:
+		return writer.WriteByte(0xc0)
+	case bool:
+		if tree {
+			return writer.WriteByte(0xc3)
+		}
+
+		return writer.WriteByte(0xc2)
+	case json.Number:
+		return writeMessagePackNumber(writer, tree)
+	case string:
+		writeMessagePackHeader(writer, len(tree), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		_, err := writer.WriteString(tree)
+
+		return err
+	case []interface{}:
+		writeMessagePackHeader(writer, len(tree), 0x90, 15, 0, 0xdc, 0xdd)
+
+		for _, element := range tree {
+			if err := writeMessagePackValue(writer, element); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case object:
+		writeMessagePackHeader(writer, len(tree), 0x80, 15, 0, 0xde, 0xdf)
+
+		for _, field := range tree {
+			if err := writeMessagePackValue(writer, field.key); err != nil {
+				return err
+			}
+
+			if err := writeMessagePackValue(writer, field.value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("msgpack: cannot encode %T", tree)
+	}
+}
+
+// writeMessagePackHeader writes the type and length of a string, list or map, using
+// the fix format when length fits, else the 8 (when there is one), 16 or 32 bit one.
+func writeMessagePackHeader(writer *bufio.Writer, length int, fix byte, fixMax int, code8 byte, code16 byte, code32 byte) {
+	switch {
+	case length <= fixMax:
+		_ = writer.WriteByte(fix | byte(length))
+	case code8 != 0 && length <= math.MaxUint8:
+		_, _ = writer.Write([]byte{code8, byte(length)})
+	case length <= math.MaxUint16:
+		_ = writer.WriteByte(code16)
+		_ = binary.Write(writer, binary.BigEndian, uint16(length))
+	default:
+		_ = writer.WriteByte(code32)
+		_ = binary.Write(writer, binary.BigEndian, uint32(length))
+	}
+}
+
+func writeMessagePackNumber(writer *bufio.Writer, number json.Number) error {
+	if value, err := strconv.ParseInt(number.String(), 10, 64); err == nil {
+		switch {
+		case value >= 0 && value <= 127:
+			return writer.WriteByte(byte(value))
+		case value < 0 && value >= -32:
+			return writer.WriteByte(byte(int8(value)))
+		case value >= math.MinInt8 && value <= math.MaxInt8:
+			_, err := writer.Write([]byte{0xd0, byte(int8(value))})
+			return err
+		case value >= math.MinInt16 && value <= math.MaxInt16:
+			_ = writer.WriteByte(0xd1)
+			return binary.Write(writer, binary.BigEndian, int16(value))
+		case value >= math.MinInt32 && value <= math.MaxInt32:
+			_ = writer.WriteByte(0xd2)
+			return binary.Write(writer, binary.BigEndian, int32(value))
+		default:
+			_ = writer.WriteByte(0xd3)
+			return binary.Write(writer, binary.BigEndian, value)
+		}
+	}
+
+	if value, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+		_ = writer.WriteByte(0xcf)
+		return binary.Write(writer, binary.BigEndian, value)
+	}
+
+	value, err := number.Float64()
+
+	if err != nil {
+		return err
+	}
+
+	_ = writer.WriteByte(0xcb)
+
+	return binary.Write(writer, binary.BigEndian, value)
+}
+
+func readMessagePack(reader io.Reader) (interface{}, error) {
+	buffered := bufio.NewReader(reader)
+	tree, err := readMessagePackValue(buffered)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := buffered.ReadByte(); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrTrailingData
+	}
+
+	return tree, nil
+}
+
+func readMessagePackValue(reader *bufio.Reader) (interface{}, error) {
+	code, err := reader.ReadByte()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		return json.Number(strconv.Itoa(int(code))), nil
+	case code >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(code)))), nil
+	case code&0xf0 == 0x80:
+		return readMessagePackMap(reader, int(code&0x0f))
+	case code&0xf0 == 0x90:
+		return readMessagePackList(reader, int(code&0x0f))
+	case code&0xe0 == 0xa0:
+		return readMessagePackString(reader, int(code&0x1f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		return readMessagePackString(reader, int(readMessagePackUint(reader, 1)))
+	case 0xc5, 0xda:
+		return readMessagePackString(reader, int(readMessagePackUint(reader, 2)))
+	case 0xc6, 0xdb:
+		return readMessagePackString(reader, int(readMessagePackUint(reader, 4)))
+	case 0xca:
+		bits := uint32(readMessagePackUint(reader, 4))
+		return json.Number(strconv.FormatFloat(float64(math.Float32frombits(bits)), 'g', -1, 32)), nil
+	case 0xcb:
+		bits := readMessagePackUint(reader, 8)
+		return json.Number(strconv.FormatFloat(math.Float64frombits(bits), 'g', -1, 64)), nil
+	case 0xcc:
+		return json.Number(strconv.FormatUint(readMessagePackUint(reader, 1), 10)), nil
+	case 0xcd:
+		return json.Number(strconv.FormatUint(readMessagePackUint(reader, 2), 10)), nil
+	case 0xce:
+		return json.Number(strconv.FormatUint(readMessagePackUint(reader, 4), 10)), nil
+	case 0xcf:
+		return json.Number(strconv.FormatUint(readMessagePackUint(reader, 8), 10)), nil
+	case 0xd0:
+		return json.Number(strconv.FormatInt(int64(int8(readMessagePackUint(reader, 1))), 10)), nil
+	case 0xd1:
+		return json.Number(strconv.FormatInt(int64(int16(readMessagePackUint(reader, 2))), 10)), nil
+	case 0xd2:
+		return json.Number(strconv.FormatInt(int64(int32(readMessagePackUint(reader, 4))), 10)), nil
+	case 0xd3:
+		return json.Number(strconv.FormatInt(int64(readMessagePackUint(reader, 8)), 10)), nil
+	case 0xdc:
+		return readMessagePackList(reader, int(readMessagePackUint(reader, 2)))
+	case 0xdd:
+		return readMessagePackList(reader, int(readMessagePackUint(reader, 4)))
+	case 0xde:
+		return readMessagePackMap(reader, int(readMessagePackUint(reader, 2)))
+	case 0xdf:
+		return readMessagePackMap(reader, int(readMessagePackUint(reader, 4)))
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", code)
+	}
+}
+
+// readMessagePackUint reads a big endian unsigned integer of size bytes. A short read
+// is left for the next read to report.
+func readMessagePackUint(reader *bufio.Reader, size int) uint64 {
+	var value uint64
+
+	for index := 0; index < size; index++ {
+		next, _ := reader.ReadByte()
+		value = value<<8 | uint64(next)
+	}
+
+	return value
+}
+
+func readMessagePackString(reader *bufio.Reader, length int) (interface{}, error) {
+	if length > maxMessagePackLength {
+		return nil, errMessagePackTooLong
+	}
+
+	// The buffer grows with what is actually read, not with the declared length.
+	var data bytes.Buffer
+
+	if _, err := io.CopyN(&data, reader, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	return data.String(), nil
+}
+
+func readMessagePackList(reader *bufio.Reader, length int) (interface{}, error) {
+	if length > maxMessagePackLength {
+		return nil, errMessagePackTooLong
+	}
+
+	list := []interface{}{}
+
+	for index := 0; index < length; index++ {
+		element, err := readMessagePackValue(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, element)
+	}
+
+	return list, nil
+}
+
+func readMessagePackMap(reader *bufio.Reader, length int) (interface{}, error) {
+	if length > maxMessagePackLength {
+		return nil, errMessagePackTooLong
+	}
+
+	mapping := object{}
+
+	for index := 0; index < length; index++ {
+		key, err := readMessagePackValue(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keyText, ok := scalarText(key)
+
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map keys must be scalars")
+		}
+
+		value, err := readMessagePackValue(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mapping = append(mapping, field{key: keyText, value: value})
+	}
+
+	return mapping, nil
+}
@@ -0,0 +1,402 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The formats other than JSON are written from, and read into, a generic tree made of
+// nil, bool, json.Number, string, []interface{} and object values. Going through JSON
+// to build the tree means every format follows the json tags of the values it encodes.
+
+type field struct {
+	key   string
+	value interface{}
+	// line is the line of a YAML document the field was read from, 0 otherwise.
+	line int
+}
+
+// object is a JSON object that remembers the order of its fields.
+type object []field
+
+func (value object) get(key string) (interface{}, bool) {
+	for _, field := range value {
+		if field.key == key {
+			return field.value, true
+		}
+	}
+
+	return nil, false
+}
+
+// toTree turns value into a tree the way json.Marshal sees it.
+func toTree(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	return readTree(decoder)
+}
+
+func readTree(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			array := []interface{}{}
+
+			for decoder.More() {
+				element, err := readTree(decoder)
+
+				if err != nil {
+					return nil, err
+				}
+
+				array = append(array, element)
+			}
+
+			_, err := decoder.Token()
+
+			return array, err
+		}
+
+		result := object{}
+
+		for decoder.More() {
+			key, err := decoder.Token()
+
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := readTree(decoder)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, field{key: key.(string), value: value})
+		}
+
+		_, err := decoder.Token()
+
+		return result, err
+	default:
+		return token, nil
+	}
+}
+
+// fromTree stores a tree in the value target points to. Scalars are converted to the
+// type of the field they land in, since formats such as XML and CSV only have text.
+func fromTree(tree interface{}, target interface{}) error {
+	destination := reflect.ValueOf(target)
+
+	if destination.Kind() != reflect.Ptr || destination.IsNil() {
+		return fmt.Errorf("codecs: cannot decode into %T", target)
+	}
+
+	return assign(tree, destination.Elem())
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func assign(tree interface{}, destination reflect.Value) error {
+	if tree == nil {
+		destination.Set(reflect.Zero(destination.Type()))
+		return nil
+	}
+
+	if destination.Kind() == reflect.Ptr {
+		if destination.IsNil() {
+			destination.Set(reflect.New(destination.Type().Elem()))
+		}
+
+		return assign(tree, destination.Elem())
+	}
+
+	if destination.CanAddr() {
+		pointerType := destination.Addr().Type()
+
+		if text, ok := tree.(string); ok && pointerType.Implements(textUnmarshalerType) {
+			return destination.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+		}
+
+		if pointerType.Implements(jsonUnmarshalerType) {
+			encoded, err := json.Marshal(plain(tree))
+
+			if err != nil {
+				return err
+			}
+
+			return destination.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(encoded)
+		}
+	}
+
+	text, isText := scalarText(tree)
+
+	switch destination.Kind() {
+	case reflect.Interface:
+		destination.Set(reflect.ValueOf(plain(tree)))
+	case reflect.String:
+		if !isText {
+			return fmt.Errorf("codecs: expected text for %s", destination.Type())
+		}
+
+		destination.SetString(text)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(text)
+
+		if err != nil {
+			return fmt.Errorf("codecs: expected true or false, got %q", text)
+		}
+
+		destination.SetBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(text, 10, destination.Type().Bits())
+
+		if err != nil {
+			return fmt.Errorf("codecs: expected an integer, got %q", text)
+		}
+
+		destination.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(text, 10, destination.Type().Bits())
+
+		if err != nil {
+			return fmt.Errorf("codecs: expected a positive integer, got %q", text)
+		}
+
+		destination.SetUint(value)
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(text, destination.Type().Bits())
+
+		if err != nil {
+			return fmt.Errorf("codecs: expected a number, got %q", text)
+		}
+
+		destination.SetFloat(value)
+	case reflect.Slice:
+		return assignSlice(tree, destination)
+	case reflect.Map:
+		return assignMap(tree, destination)
+	case reflect.Struct:
+		return assignStruct(tree, destination)
+	default:
+		return fmt.Errorf("codecs: cannot decode into %s", destination.Type())
+	}
+
+	return nil
+}
+
+// scalarText returns the text of a scalar tree.
+func scalarText(tree interface{}) (string, bool) {
+	switch tree := tree.(type) {
+	case string:
+		return tree, true
+	case json.Number:
+		return tree.String(), true
+	case bool:
+		return strconv.FormatBool(tree), true
+	default:
+		return "", false
+	}
+}
+
+func assignSlice(tree interface{}, destination reflect.Value) error {
+	elements, ok := tree.([]interface{})
+
+	if !ok {
+		if text, isText := tree.(string); isText && len(text) == 0 {
+			destination.Set(reflect.MakeSlice(destination.Type(), 0, 0))
+			return nil
+		}
+
+		// A list with a single element reads the same as that element in XML.
+		elements = []interface{}{tree}
+	}
+
+	slice := reflect.MakeSlice(destination.Type(), len(elements), len(elements))
+
+	for index, element := range elements {
+		if err := assign(element, slice.Index(index)); err != nil {
+			return err
+		}
+	}
+
+	destination.Set(slice)
+
+	return nil
+}
+
+// assignMap fills a map from an object or, for formats such as CSV that only have
+// lists of rows, from a list of objects keyed by their id, or else name, field.
+func assignMap(tree interface{}, destination reflect.Value) error {
+	if destination.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("codecs: cannot decode into %s", destination.Type())
+	}
+
+	result := reflect.MakeMap(destination.Type())
+
+	add := func(key string, value interface{}) error {
+		element := reflect.New(destination.Type().Elem()).Elem()
+
+		if err := assign(value, element); err != nil {
+			return err
+		}
+
+		result.SetMapIndex(reflect.ValueOf(key).Convert(destination.Type().Key()), element)
+
+		return nil
+	}
+
+	switch tree := tree.(type) {
+	case object:
+		for _, field := range tree {
+			if err := add(field.key, field.value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for index, row := range tree {
+			rowObject, _ := row.(object)
+			key, ok := rowObject.get("id")
+
+			if text, _ := scalarText(key); !ok || len(text) == 0 {
+				key, ok = rowObject.get("name")
+			}
+
+			text, _ := scalarText(key)
+
+			if !ok || len(text) == 0 {
+				return fmt.Errorf("codecs: row %d has neither id nor name", index+1)
+			}
+
+			if err := add(text, row); err != nil {
+				return err
+			}
+		}
+	case string:
+		if len(tree) > 0 {
+			return fmt.Errorf("codecs: expected an object for %s", destination.Type())
+		}
+	default:
+		return fmt.Errorf("codecs: expected an object for %s", destination.Type())
+	}
+
+	destination.Set(result)
+
+	return nil
+}
+
+func assignStruct(tree interface{}, destination reflect.Value) error {
+	fields := structFields(destination)
+
+	switch tree := tree.(type) {
+	case object:
+		for _, field := range tree {
+			fieldValue, ok := fields[field.key]
+
+			if !ok {
+				return fmt.Errorf("codecs: unknown field %q for %s", field.key, destination.Type())
+			}
+
+			if err := assign(field.value, fieldValue); err != nil {
+				return fmt.Errorf("%s: %w", field.key, err)
+			}
+		}
+
+		return nil
+	case []interface{}:
+		// A list for a struct that only wraps a collection, such as a CSV table of pets,
+		// is that collection.
+		if len(fields) == 1 {
+			for _, fieldValue := range fields {
+				return assign(tree, fieldValue)
+			}
+		}
+	case string:
+		if len(tree) == 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("codecs: expected an object for %s", destination.Type())
+}
+
+// structFields maps the JSON names of a struct's fields, including those of embedded
+// structs, to the fields.
+func structFields(destination reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+
+	for index := 0; index < destination.NumField(); index++ {
+		structField := destination.Type().Field(index)
+
+		if len(structField.PkgPath) > 0 && !structField.Anonymous {
+			continue
+		}
+
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+
+		if name == "-" {
+			continue
+		}
+
+		if structField.Anonymous && len(name) == 0 && structField.Type.Kind() == reflect.Struct {
+			for embeddedName, embeddedField := range structFields(destination.Field(index)) {
+				if _, ok := fields[embeddedName]; !ok {
+					fields[embeddedName] = embeddedField
+				}
+			}
+
+			continue
+		}
+
+		if len(name) == 0 {
+			name = structField.Name
+		}
+
+		fields[name] = destination.Field(index)
+	}
+
+	return fields
+}
+
+// plain turns a tree into the maps and slices encoding/json works with.
+func plain(tree interface{}) interface{} {
+	switch tree := tree.(type) {
+	case object:
+		result := make(map[string]interface{}, len(tree))
+
+		for _, field := range tree {
+			result[field.key] = plain(field.value)
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(tree))
+
+		for index, element := range tree {
+			result[index] = plain(element)
+		}
+
+		return result
+	default:
+		return tree
+	}
+}
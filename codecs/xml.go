@@ -0,0 +1,205 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const xmlRootElement = "response"
+const xmlItemElement = "item"
+const xmlEntryElement = "entry"
+
+// XML writes objects as elements named after their keys inside a <response> element.
+// Keys that are not XML names, such as pet IDs, become <entry key="..."> elements and
+// list elements become <item> elements. Reading reverses this, with all scalars read
+// as text and converted to the type of the field they are stored in.
+var XML = treeCodec("application/xml", []string{"text/xml"}, writeXML, readXML)
+
+func writeXML(writer io.Writer, tree interface{}) error {
+	encoder := xml.NewEncoder(writer)
+
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+
+	if err := writeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: xmlRootElement}}, tree); err != nil {
+		return err
+	}
+
+	return encoder.Flush()
+}
+
+func writeXMLElement(encoder *xml.Encoder, start xml.StartElement, tree interface{}) error {
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch tree := tree.(type) {
+	case object:
+		for _, field := range tree {
+			element := xml.StartElement{Name: xml.Name{Local: field.key}}
+
+			if !isXMLName(field.key) || field.key == xmlItemElement || field.key == xmlEntryElement {
+				element = xml.StartElement{
+					Name: xml.Name{Local: xmlEntryElement},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: field.key}},
+				}
+			}
+
+			if err := writeXMLElement(encoder, element, field.value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, element := range tree {
+			if err := writeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: xmlItemElement}}, element); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		text, _ := scalarText(tree)
+
+		if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+func isXMLName(name string) bool {
+	if len(name) == 0 || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+
+	for index, character := range name {
+		if unicode.IsLetter(character) || character == '_' {
+			continue
+		}
+
+		if index > 0 && (unicode.IsDigit(character) || character == '-' || character == '.') {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func readXML(reader io.Reader) (interface{}, error) {
+	decoder := xml.NewDecoder(reader)
+
+	for {
+		token, err := decoder.Token()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := token.(xml.StartElement); ok {
+			tree, err := readXMLElement(decoder)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return tree, readXMLTrailer(decoder)
+		}
+	}
+}
+
+// readXMLTrailer makes sure nothing but whitespace, comments and processing
+// instructions follow the root element.
+func readXMLTrailer(decoder *xml.Decoder) error {
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch token := token.(type) {
+		case xml.Comment, xml.ProcInst:
+		case xml.CharData:
+			if len(bytes.TrimSpace(token)) > 0 {
+				return ErrTrailingData
+			}
+		default:
+			return ErrTrailingData
+		}
+	}
+}
+
+// readXMLElement reads the rest of the element just opened. An element holding only
+// <item> elements is a list, one holding other elements an object, and one holding
+// only text a string.
+func readXMLElement(decoder *xml.Decoder) (interface{}, error) {
+	children := object{}
+	allItems := true
+
+	var text bytes.Buffer
+
+	for {
+		token, err := decoder.Token()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			value, err := readXMLElement(decoder)
+
+			if err != nil {
+				return nil, err
+			}
+
+			key := token.Name.Local
+
+			if key == xmlEntryElement {
+				for _, attribute := range token.Attr {
+					if attribute.Name.Local == "key" {
+						key = attribute.Value
+					}
+				}
+			}
+
+			if token.Name.Local != xmlItemElement {
+				allItems = false
+			}
+
+			children = append(children, field{key: key, value: value})
+		case xml.CharData:
+			text.Write(token)
+		case xml.EndElement:
+			return xmlElementValue(children, allItems, text.String()), nil
+		}
+	}
+}
+
+func xmlElementValue(children object, allItems bool, text string) interface{} {
+	if len(children) == 0 {
+		return text
+	}
+
+	if allItems {
+		list := []interface{}{}
+
+		for _, child := range children {
+			list = append(list, child.value)
+		}
+
+		return list
+	}
+
+	return children
+}
@@ -0,0 +1,567 @@
+package codecs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// YAML writes block style YAML. Reading understands the block style subset it writes,
+// and the usual hand-written variations of it: comments, plain, single and double
+// quoted scalars, "- " lists, nested mappings and empty or single-line flow
+// collections. Anchors, tags, multi-document streams and block scalars are not
+// supported.
+var YAML = treeCodec("application/yaml", []string{"application/x-yaml", "text/yaml", "text/x-yaml"}, writeYAML, readYAML)
+
+func writeYAML(writer io.Writer, tree interface{}) error {
+	buffered := bufio.NewWriter(writer)
+
+	writeYAMLValue(buffered, tree, 0)
+
+	return buffered.Flush()
+}
+
+// writeYAMLValue writes tree at the given indentation, assuming the line it starts on
+// has already been indented.
+func writeYAMLValue(writer *bufio.Writer, tree interface{}, indent int) {
+	padding := strings.Repeat("  ", indent)
+
+	switch tree := tree.(type) {
+	case object:
+		if len(tree) == 0 {
+			writer.WriteString("{}\n")
+			return
+		}
+
+		for index, field := range tree {
+			if index > 0 {
+				writer.WriteString(padding)
+			}
+
+			writer.WriteString(yamlScalar(field.key))
+			writer.WriteString(":")
+			writeYAMLChild(writer, field.value, indent)
+		}
+	case []interface{}:
+		if len(tree) == 0 {
+			writer.WriteString("[]\n")
+			return
+		}
+
+		for index, element := range tree {
+			if index > 0 {
+				writer.WriteString(padding)
+			}
+
+			// Whatever follows the dash lines up two columns to its right.
+			writer.WriteString("- ")
+			writeYAMLValue(writer, element, indent+1)
+		}
+	default:
+		writer.WriteString(yamlScalar(tree))
+		writer.WriteString("\n")
+	}
+}
+
+// writeYAMLChild writes the value of a mapping key, on the same line when it is a
+// scalar and on the following, further indented, lines otherwise.
+func writeYAMLChild(writer *bufio.Writer, tree interface{}, indent int) {
+	if isScalar(tree) || isEmptyCollection(tree) {
+		writer.WriteString(" ")
+		writeYAMLValue(writer, tree, indent+1)
+		return
+	}
+
+	writer.WriteString("\n")
+	writer.WriteString(strings.Repeat("  ", indent+1))
+	writeYAMLValue(writer, tree, indent+1)
+}
+
+func isScalar(tree interface{}) bool {
+	switch tree.(type) {
+	case object, []interface{}:
+		return false
+	default:
+		return true
+	}
+}
+
+func isEmptyCollection(tree interface{}) bool {
+	switch tree := tree.(type) {
+	case object:
+		return len(tree) == 0
+	case []interface{}:
+		return len(tree) == 0
+	default:
+		return false
+	}
+}
+
+var yamlNumber = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+// yamlScalar writes a scalar, quoting strings that would otherwise read back as
+// something else.
+func yamlScalar(tree interface{}) string {
+	switch tree := tree.(type) {
+	case nil:
+		return "null"
+	case string:
+		if yamlNeedsQuotes(tree) {
+			return strconv.Quote(tree)
+		}
+
+		return tree
+	default:
+		text, _ := scalarText(tree)
+
+		return text
+	}
+}
+
+func yamlNeedsQuotes(text string) bool {
+	if len(text) == 0 || strings.TrimSpace(text) != text || yamlNumber.MatchString(text) {
+		return true
+	}
+
+	switch strings.ToLower(text) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off":
+		return true
+	}
+
+	if strings.ContainsAny(text[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+
+	if strings.Contains(text, ": ") || strings.Contains(text, " #") || strings.HasSuffix(text, ":") {
+		return true
+	}
+
+	for _, character := range text {
+		if character < ' ' || character == 0x7f || !strconv.IsPrint(character) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// YAMLScalar is a single value of a YAML document, as text, with the keys leading to
+// it joined by dots and the line it is on.
+type YAMLScalar struct {
+	Key  string
+	Text string
+	Line int
+}
+
+// ReadYAMLScalars reads a YAML document of nested mappings, such as a config file, as
+// the values in it, in the order they appear. Keys without a value have an empty one.
+// Lists are refused.
+func ReadYAMLScalars(reader io.Reader) ([]YAMLScalar, error) {
+	tree, err := readYAML(reader)
+
+	if err != nil || tree == nil {
+		return nil, err
+	}
+
+	mapping, ok := tree.(object)
+
+	if !ok {
+		return nil, fmt.Errorf("yaml: expected a mapping of keys to values")
+	}
+
+	return appendYAMLScalars(nil, "", mapping)
+}
+
+func appendYAMLScalars(scalars []YAMLScalar, prefix string, mapping object) ([]YAMLScalar, error) {
+	for _, field := range mapping {
+		key := prefix + field.key
+
+		switch value := field.value.(type) {
+		case object:
+			var err error
+
+			if scalars, err = appendYAMLScalars(scalars, key+".", value); err != nil {
+				return nil, err
+			}
+		case []interface{}:
+			return nil, fmt.Errorf("yaml: line %d: %s must be a single value, not a list", field.line, key)
+		default:
+			text, _ := scalarText(value)
+			scalars = append(scalars, YAMLScalar{Key: key, Text: text, Line: field.line})
+		}
+	}
+
+	return scalars, nil
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+func readYAML(reader io.Reader) (interface{}, error) {
+	lines := []yamlLine{}
+	scanner := bufio.NewScanner(reader)
+	number := 0
+
+	for scanner.Scan() {
+		number++
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") || (number == 1 && trimmed == "---") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs may not be used for indentation", number)
+		}
+
+		lines = append(lines, yamlLine{number: number, indent: len(text) - len(trimmed), text: trimmed})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	parser := &yamlParser{lines: lines}
+	tree, err := parser.parseBlock(lines[0].indent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.position < len(lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", lines[parser.position].number)
+	}
+
+	return tree, nil
+}
+
+type yamlParser struct {
+	lines    []yamlLine
+	position int
+}
+
+// parseBlock parses the mapping, list or scalar whose lines start at indent.
+func (parser *yamlParser) parseBlock(indent int) (interface{}, error) {
+	line := parser.lines[parser.position]
+
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return parser.parseList(indent)
+	}
+
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return parser.parseMapping(indent)
+	}
+
+	parser.position++
+
+	return parseYAMLScalar(line.text, line.number)
+}
+
+func (parser *yamlParser) parseList(indent int) (interface{}, error) {
+	list := []interface{}{}
+
+	for parser.position < len(parser.lines) {
+		line := parser.lines[parser.position]
+
+		isItem := line.text == "-" || strings.HasPrefix(line.text, "- ")
+
+		// A list nested under a key may sit at the key's indentation, and ends at the
+		// next key.
+		if line.indent < indent || (line.indent == indent && !isItem) {
+			break
+		}
+
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: expected a list item", line.number)
+		}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+
+		if len(rest) == 0 {
+			parser.position++
+
+			element, err := parser.parseNested(indent)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, element)
+			continue
+		}
+
+		// "- key: value" starts a mapping whose keys line up after the dash.
+		itemIndent := line.indent + len(line.text) - len(rest)
+		parser.lines[parser.position] = yamlLine{number: line.number, indent: itemIndent, text: rest}
+
+		element, err := parser.parseBlock(itemIndent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, element)
+	}
+
+	return list, nil
+}
+
+func (parser *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := object{}
+
+	for parser.position < len(parser.lines) {
+		line := parser.lines[parser.position]
+
+		if line.indent < indent {
+			break
+		}
+
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+		}
+
+		key, rest, ok := splitYAMLKey(line.text)
+
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected key: value", line.number)
+		}
+
+		key, err := parseYAMLKey(key, line.number)
+
+		if err != nil {
+			return nil, err
+		}
+
+		parser.position++
+
+		var value interface{}
+
+		if len(rest) == 0 || strings.HasPrefix(rest, "#") {
+			value, err = parser.parseNested(indent)
+		} else {
+			value, err = parseYAMLScalar(rest, line.number)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		mapping = append(mapping, field{key: key, value: value, line: line.number})
+	}
+
+	return mapping, nil
+}
+
+// parseNested parses the block under a key or dash with nothing after it. Lists may
+// sit at the same indentation as their key.
+func (parser *yamlParser) parseNested(indent int) (interface{}, error) {
+	if parser.position >= len(parser.lines) {
+		return nil, nil
+	}
+
+	next := parser.lines[parser.position]
+
+	if next.indent > indent || (next.indent == indent && strings.HasPrefix(next.text, "- ")) {
+		return parser.parseBlock(next.indent)
+	}
+
+	return nil, nil
+}
+
+// splitYAMLKey splits "key: value" at the first colon outside quotes that is followed
+// by a space or ends the line.
+func splitYAMLKey(text string) (string, string, bool) {
+	var quote rune
+
+	for index, character := range text {
+		switch {
+		case quote != 0:
+			if character == quote {
+				quote = 0
+			}
+		case (character == '"' || character == '\'') && index == 0:
+			quote = character
+		case character == '#' && index > 0 && text[index-1] == ' ':
+			return "", "", false
+		case character == ':' && (index == len(text)-1 || text[index+1] == ' '):
+			return strings.TrimSpace(text[:index]), strings.TrimSpace(text[index+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+func parseYAMLKey(text string, number int) (string, error) {
+	key, err := parseYAMLScalar(text, number)
+
+	if err != nil {
+		return "", err
+	}
+
+	keyText, ok := scalarText(key)
+
+	if !ok {
+		return "", fmt.Errorf("yaml: line %d: keys must be scalars", number)
+	}
+
+	return keyText, nil
+}
+
+func parseYAMLScalar(text string, number int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		end := closingQuote(text)
+
+		if end < 0 {
+			return nil, fmt.Errorf("yaml: line %d: unterminated string", number)
+		}
+
+		value, err := strconv.Unquote(text[:end+1])
+
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: %v", number, err)
+		}
+
+		return value, checkYAMLTrailer(text[end+1:], number)
+	case strings.HasPrefix(text, "'"):
+		var value strings.Builder
+
+		for index := 1; index < len(text); index++ {
+			if text[index] != '\'' {
+				value.WriteByte(text[index])
+				continue
+			}
+
+			if index+1 < len(text) && text[index+1] == '\'' {
+				value.WriteByte('\'')
+				index++
+				continue
+			}
+
+			return value.String(), checkYAMLTrailer(text[index+1:], number)
+		}
+
+		return nil, fmt.Errorf("yaml: line %d: unterminated string", number)
+	case strings.HasPrefix(text, "["), strings.HasPrefix(text, "{"):
+		return parseYAMLFlow(stripYAMLComment(text), number)
+	}
+
+	text = stripYAMLComment(text)
+
+	switch strings.ToLower(text) {
+	case "", "null", "~":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	if yamlNumber.MatchString(text) {
+		return json.Number(strings.TrimPrefix(text, "+")), nil
+	}
+
+	return text, nil
+}
+
+// closingQuote returns the index of the quote ending the double quoted string text
+// starts with.
+func closingQuote(text string) int {
+	for index := 1; index < len(text); index++ {
+		switch text[index] {
+		case '\\':
+			index++
+		case '"':
+			return index
+		}
+	}
+
+	return -1
+}
+
+func checkYAMLTrailer(trailer string, number int) error {
+	if trailer = strings.TrimSpace(trailer); len(trailer) > 0 && !strings.HasPrefix(trailer, "#") {
+		return fmt.Errorf("yaml: line %d: unexpected %q after string", number, trailer)
+	}
+
+	return nil
+}
+
+func stripYAMLComment(text string) string {
+	if index := strings.Index(text, " #"); index >= 0 {
+		text = text[:index]
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// parseYAMLFlow parses single-line flow collections such as [a, b] or {a: 1}, which
+// may not nest.
+func parseYAMLFlow(text string, number int) (interface{}, error) {
+	closing := map[byte]byte{'[': ']', '{': '}'}[text[0]]
+
+	if text[len(text)-1] != closing {
+		return nil, fmt.Errorf("yaml: line %d: unterminated flow collection", number)
+	}
+
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+	parts := []string{}
+
+	if len(inner) > 0 {
+		parts = strings.Split(inner, ",")
+	}
+
+	if closing == ']' {
+		list := []interface{}{}
+
+		for _, part := range parts {
+			value, err := parseYAMLScalar(strings.TrimSpace(part), number)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, value)
+		}
+
+		return list, nil
+	}
+
+	mapping := object{}
+
+	for _, part := range parts {
+		key, rest, ok := splitYAMLKey(strings.TrimSpace(part))
+
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected key: value in flow mapping", number)
+		}
+
+		key, err := parseYAMLKey(key, number)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := parseYAMLScalar(rest, number)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mapping = append(mapping, field{key: key, value: value})
+	}
+
+	return mapping, nil
+}
@@ -0,0 +1,563 @@
+// Package config works out how the server is set up from, in increasing precedence, the
+// defaults, a YAML or TOML config file, PETSERVER_* environment variables and flags, and
+// remembers where each setting came from.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"petServer/auth"
+	"petServer/dataStore"
+	"petServer/logging"
+	"petServer/reminders"
+	"petServer/webServer"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// environmentPrefix starts the environment variables settings are read from, as in
+// PETSERVER_SERVER_ADDRESS for server.address.
+const environmentPrefix = "PETSERVER_"
+
+// configFileVariable names the config file when the -config flag does not.
+const configFileVariable = environmentPrefix + "CONFIG"
+
+// AuthConfig says where API keys and the keys JWTs are signed with are kept, and which
+// JWTs are accepted.
+type AuthConfig struct {
+	KeyFilePath  string
+	JWKSFilePath string
+	JWTIssuer    string
+	JWTAudience  string
+	ClockSkew    time.Duration
+	// JWTRoleClaim names the claim JWTs give roles in, "role" when empty.
+	JWTRoleClaim string
+	// JWTRoles maps values of the role claim to roles, as in "staff=editor, vet=reader".
+	// The values are role names when it is empty.
+	JWTRoles string
+	// ClientCertRoles maps the common names of client certificates to roles, as in
+	// "ops-bot=admin, inventory=editor".
+	ClientCertRoles string
+}
+
+// ReminderConfig says how far ahead vaccinations are reminded of, and how often, and
+// which SMTP relay they are mailed through. Reminders are logged when there is none.
+type ReminderConfig struct {
+	Window       time.Duration
+	ScanInterval time.Duration
+	SMTPAddress  string
+	SMTPFrom     string
+}
+
+// Config is everything the server can be set up with.
+type Config struct {
+	Server    webServer.Config
+	Store     dataStore.Config
+	Auth      AuthConfig
+	Reminders ReminderConfig
+	Log       logging.Config
+	// File is the config file read, if any.
+	File    string
+	origins map[string]string
+}
+
+// Default is the configuration before any file, environment variable or flag changes it.
+// Files are kept in the working directory.
+func Default() Config {
+	return Config{
+		Server: webServer.Config{
+			Address:        ":8080",
+			AdminAddress:   webServer.DefaultAdminAddress,
+			DrainTimeout:   webServer.DefaultDrainTimeout,
+			MaxBodyBytes:   webServer.DefaultMaxBodyBytes,
+			MaxImportBytes: webServer.DefaultMaxImportBytes,
+		},
+		Store: dataStore.Config{FilePath: "pets.json"},
+		Auth: AuthConfig{
+			KeyFilePath:  "pets.keys.json",
+			JWKSFilePath: "pets.jwks.json",
+			JWTAudience:  "petServer",
+			ClockSkew:    time.Minute,
+		},
+		Reminders: ReminderConfig{
+			Window:       14 * 24 * time.Hour,
+			ScanInterval: reminders.DefaultScanInterval,
+		},
+		Log: logging.Config{
+			Level:     "info",
+			Rotation:  logging.Rotation{MaxBytes: 100 << 20, MaxAge: 7 * 24 * time.Hour, MaxBackups: 10},
+			AuditFile: "pets.audit.log",
+		},
+	}
+}
+
+// setting is one value of a Config, known as key in config files, as the upper case of
+// key after PETSERVER_ in the environment, and with dashes for dots and underscores as a
+// flag.
+type setting struct {
+	key   string
+	usage string
+	// field points at the setting in config: a *string, *bool, *int, *int64 or
+	// *time.Duration.
+	field func(config *Config) interface{}
+	// check, when set, says what is wrong with the value, if anything.
+	check func(config *Config) error
+}
+
+var settings = []setting{
+	{"server.address", "host and port to serve requests on", func(config *Config) interface{} { return &config.Server.Address }, checkAddress},
+	{"server.admin_address", "loopback host and port, or unix:PATH, to serve /close on", func(config *Config) interface{} { return &config.Server.AdminAddress }, func(config *Config) error { return webServer.CheckAdminAddress(config.Server.AdminAddress) }},
+	{"server.drain_timeout", "how long a shutdown waits for requests in progress", func(config *Config) interface{} { return &config.Server.DrainTimeout }, func(config *Config) error { return positive(config.Server.DrainTimeout) }},
+	{"server.shutdown_delay", "how long a shutdown goes on serving, with /readyz failing, before draining", func(config *Config) interface{} { return &config.Server.ShutdownDelay }, func(config *Config) error { return notNegative(config.Server.ShutdownDelay) }},
+	{"server.max_body_bytes", "largest request body handlers read", func(config *Config) interface{} { return &config.Server.MaxBodyBytes }, func(config *Config) error { return positiveInt(config.Server.MaxBodyBytes) }},
+	{"server.max_import_bytes", "largest request body /pets/import reads", func(config *Config) interface{} { return &config.Server.MaxImportBytes }, func(config *Config) error { return positiveInt(config.Server.MaxImportBytes) }},
+	{"tls.cert_file", "PEM certificate chain to serve HTTPS with, plain HTTP when empty", func(config *Config) interface{} { return &config.Server.TLS.CertFile }, func(config *Config) error {
+		return neededWith(config.Server.TLS.CertFile, config.Server.TLS.KeyFile, "tls.key_file")
+	}},
+	{"tls.key_file", "PEM private key of the certificate", func(config *Config) interface{} { return &config.Server.TLS.KeyFile }, func(config *Config) error {
+		return neededWith(config.Server.TLS.KeyFile, config.Server.TLS.CertFile, "tls.cert_file")
+	}},
+	{"tls.client_ca_file", "PEM CAs client certificates must be signed by", func(config *Config) interface{} { return &config.Server.TLS.ClientCAFile }, func(config *Config) error {
+		return needs(config.Server.TLS.ClientCAFile, config.Server.TLS.CertFile, "tls.cert_file")
+	}},
+	{"tls.require_client_cert", "refuse clients without a certificate", func(config *Config) interface{} { return &config.Server.TLS.RequireClientCert }, func(config *Config) error {
+		if config.Server.TLS.RequireClientCert {
+			return needs("true", config.Server.TLS.ClientCAFile, "tls.client_ca_file")
+		}
+
+		return nil
+	}},
+	{"tls.redirect_address", "host and port to redirect plain HTTP to HTTPS from", func(config *Config) interface{} { return &config.Server.TLS.RedirectAddress }, checkRedirectAddress},
+	{"store.file_path", "file pets are kept in, with the other data next to it", func(config *Config) interface{} { return &config.Store.FilePath }, func(config *Config) error { return notEmpty(config.Store.FilePath) }},
+	{"store.require_unique_names", "refuse to give two pets the same name", func(config *Config) interface{} { return &config.Store.RequireUniqueNames }, nil},
+	{"store.block_owned_pet_removal", "refuse to remove pets that still have owners, rather than unlinking them", func(config *Config) interface{} { return &config.Store.BlockOwnedPetRemoval }, nil},
+	{"auth.key_file_path", "file API keys are kept in", func(config *Config) interface{} { return &config.Auth.KeyFilePath }, func(config *Config) error { return notEmpty(config.Auth.KeyFilePath) }},
+	{"auth.jwks_file_path", "JWKS file with the keys JWTs are signed with", func(config *Config) interface{} { return &config.Auth.JWKSFilePath }, func(config *Config) error { return notEmpty(config.Auth.JWKSFilePath) }},
+	{"auth.jwt_issuer", "iss JWTs must have, any when empty", func(config *Config) interface{} { return &config.Auth.JWTIssuer }, nil},
+	{"auth.jwt_audience", "aud JWTs must have, any when empty", func(config *Config) interface{} { return &config.Auth.JWTAudience }, nil},
+	{"auth.jwt_role_claim", "claim JWTs give roles in, role when empty", func(config *Config) interface{} { return &config.Auth.JWTRoleClaim }, nil},
+	{"auth.jwt_roles", "roles of role claim values, as in staff=editor,vet=reader, role names when empty", func(config *Config) interface{} { return &config.Auth.JWTRoles }, func(config *Config) error {
+		_, err := auth.ParseSubjectRoles(config.Auth.JWTRoles)
+		return err
+	}},
+	{"auth.clock_skew", "how far JWT times may be off", func(config *Config) interface{} { return &config.Auth.ClockSkew }, func(config *Config) error { return notNegative(config.Auth.ClockSkew) }},
+	{"auth.client_cert_roles", "roles of client certificate common names, as in ops=admin,shop=reader", func(config *Config) interface{} { return &config.Auth.ClientCertRoles }, func(config *Config) error {
+		_, err := auth.ParseSubjectRoles(config.Auth.ClientCertRoles)
+		return err
+	}},
+	{"reminders.window", "how far ahead vaccinations due are reminded of", func(config *Config) interface{} { return &config.Reminders.Window }, func(config *Config) error { return positive(config.Reminders.Window) }},
+	{"reminders.scan_interval", "how often to look for reminders to send", func(config *Config) interface{} { return &config.Reminders.ScanInterval }, func(config *Config) error { return positive(config.Reminders.ScanInterval) }},
+	{"reminders.smtp_address", "host and port of the SMTP relay to mail reminders through, logged instead when empty", func(config *Config) interface{} { return &config.Reminders.SMTPAddress }, func(config *Config) error {
+		return neededWith(config.Reminders.SMTPAddress, config.Reminders.SMTPFrom, "reminders.smtp_from")
+	}},
+	{"reminders.smtp_from", "address reminders are mailed from", func(config *Config) interface{} { return &config.Reminders.SMTPFrom }, func(config *Config) error {
+		return neededWith(config.Reminders.SMTPFrom, config.Reminders.SMTPAddress, "reminders.smtp_address")
+	}},
+	{"log.level", "least severe level logged: debug, info, warn or error", func(config *Config) interface{} { return &config.Log.Level }, func(config *Config) error {
+		_, err := logging.ParseLevel(config.Log.Level)
+		return err
+	}},
+	{"log.file", "file to log to, rotated, standard error when empty", func(config *Config) interface{} { return &config.Log.File }, nil},
+	{"log.max_bytes", "how large the log file grows before it is rotated, no limit when 0", func(config *Config) interface{} { return &config.Log.Rotation.MaxBytes }, func(config *Config) error { return notNegativeInt(config.Log.Rotation.MaxBytes) }},
+	{"log.max_age", "how long the log file is written to before it is rotated, no limit when 0", func(config *Config) interface{} { return &config.Log.Rotation.MaxAge }, func(config *Config) error { return notNegative(config.Log.Rotation.MaxAge) }},
+	{"log.max_backups", "how many rotated log files to keep, all when 0", func(config *Config) interface{} { return &config.Log.Rotation.MaxBackups }, func(config *Config) error { return notNegativeInt(int64(config.Log.Rotation.MaxBackups)) }},
+	{"log.audit_file", "file changes to pets are audited in, no audit log when empty", func(config *Config) interface{} { return &config.Log.AuditFile }, nil},
+}
+
+func (setting setting) environmentVariable() string {
+	return environmentPrefix + strings.ToUpper(strings.ReplaceAll(setting.key, ".", "_"))
+}
+
+func (setting setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(setting.key)
+}
+
+// Load reads the configuration from the config file named by the -config flag or
+// PETSERVER_CONFIG, environment, given as by os.Environ, and the flags at the start of
+// arguments, then validates it. It returns the arguments after the flags, such as a
+// command. Asking for help returns flag.ErrHelp.
+func Load(arguments []string, environment []string) (Config, []string, error) {
+	config := Default()
+	config.origins = make(map[string]string)
+
+	variables := make(map[string]string)
+
+	for _, variable := range environment {
+		if name, value, ok := strings.Cut(variable, "="); ok && strings.HasPrefix(name, environmentPrefix) {
+			variables[name] = value
+		}
+	}
+
+	flags := flag.NewFlagSet("petServer", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	configFile := flags.String("config", "", "YAML or TOML config file")
+
+	flagValues := make(map[string]*flagValue)
+
+	for _, setting := range settings {
+		_, isBool := setting.field(&config).(*bool)
+		flagValues[setting.key] = &flagValue{isBool: isBool}
+		flags.Var(flagValues[setting.key], setting.flagName(), setting.usage)
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return config, nil, err
+	}
+
+	setFlags := make(map[string]bool)
+	flags.Visit(func(flag *flag.Flag) {
+		setFlags[flag.Name] = true
+	})
+
+	problems := []string{}
+
+	config.File = variables[configFileVariable]
+
+	if setFlags["config"] {
+		config.File = *configFile
+	}
+
+	if len(config.File) > 0 {
+		values, err := readFile(config.File)
+
+		if err != nil {
+			return config, nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+
+		for _, setting := range settings {
+			if value, ok := values[setting.key]; ok {
+				problems = config.set(setting, value.text, fmt.Sprintf("file %s:%d", config.File, value.line), problems)
+				delete(values, setting.key)
+			}
+		}
+
+		for _, value := range sortedValues(values) {
+			problem := fmt.Sprintf("%s:%d: unknown setting %q", config.File, value.line, value.key)
+
+			if closest, ok := closestSetting(value.key); ok {
+				problem += "; did you mean " + closest.key + "?"
+			}
+
+			problems = append(problems, problem)
+		}
+	}
+
+	for _, setting := range settings {
+		name := setting.environmentVariable()
+
+		if value, ok := variables[name]; ok {
+			problems = config.set(setting, value, "env "+name, problems)
+			delete(variables, name)
+		}
+	}
+
+	delete(variables, configFileVariable)
+
+	for _, name := range sortedKeys(variables) {
+		key := strings.ToLower(strings.Replace(strings.TrimPrefix(name, environmentPrefix), "_", ".", 1))
+		problem := fmt.Sprintf("environment variable %s is not a setting", name)
+
+		if closest, ok := closestSetting(key); ok {
+			problem += "; did you mean " + closest.environmentVariable() + "?"
+		}
+
+		problems = append(problems, problem)
+	}
+
+	for _, setting := range settings {
+		if setFlags[setting.flagName()] {
+			problems = config.set(setting, flagValues[setting.key].text, "flag -"+setting.flagName(), problems)
+		}
+	}
+
+	if len(problems) == 0 {
+		problems = config.validate()
+	}
+
+	if len(problems) > 0 {
+		return config, nil, fmt.Errorf("%w:\n  %s", ErrInvalidConfig, strings.Join(problems, "\n  "))
+	}
+
+	return config, flags.Args(), nil
+}
+
+// flagValue keeps a flag's text for set to parse, so that flags are parsed as values
+// from other places are. Boolean flags may be given without a value, meaning true.
+type flagValue struct {
+	text   string
+	isBool bool
+}
+
+func (value *flagValue) String() string {
+	if value == nil {
+		return ""
+	}
+
+	return value.text
+}
+
+func (value *flagValue) Set(text string) error {
+	value.text = text
+	return nil
+}
+
+func (value *flagValue) IsBoolFlag() bool {
+	return value.isBool
+}
+
+// set parses text into the setting, noting that it came from origin, or adds what is
+// wrong with it to problems.
+func (config *Config) set(setting setting, text string, origin string, problems []string) []string {
+	var err error
+
+	switch field := setting.field(config).(type) {
+	case *string:
+		*field = text
+	case *bool:
+		if *field, err = strconv.ParseBool(strings.TrimSpace(text)); err != nil {
+			err = fmt.Errorf("%q is not true or false", text)
+		}
+	case *int64:
+		if *field, err = strconv.ParseInt(strings.TrimSpace(text), 10, 64); err != nil {
+			err = fmt.Errorf("%q is not a whole number", text)
+		}
+	case *int:
+		if *field, err = strconv.Atoi(strings.TrimSpace(text)); err != nil {
+			err = fmt.Errorf("%q is not a whole number", text)
+		}
+	case *time.Duration:
+		if *field, err = time.ParseDuration(strings.TrimSpace(text)); err != nil {
+			err = fmt.Errorf("%q is not a duration such as 30s or 1h30m", text)
+		}
+	}
+
+	if err != nil {
+		return append(problems, fmt.Sprintf("%s (from %s): %v", setting.key, origin, err))
+	}
+
+	config.origins[setting.key] = origin
+
+	return problems
+}
+
+func (config *Config) validate() []string {
+	problems := []string{}
+
+	for _, setting := range settings {
+		if setting.check == nil {
+			continue
+		}
+
+		if err := setting.check(config); err != nil {
+			problems = append(problems, fmt.Sprintf("%s = %s (from %s): %v", setting.key, config.value(setting), config.Origin(setting.key), err))
+		}
+	}
+
+	return problems
+}
+
+// Origin says where the setting with key came from: "default", "file PATH:LINE",
+// "env NAME" or "flag -NAME".
+func (config Config) Origin(key string) string {
+	if origin, ok := config.origins[key]; ok {
+		return origin
+	}
+
+	return "default"
+}
+
+func (config Config) value(setting setting) string {
+	switch field := setting.field(&config).(type) {
+	case *string:
+		return strconv.Quote(*field)
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *int64:
+		return strconv.FormatInt(*field, 10)
+	case *int:
+		return strconv.Itoa(*field)
+	case *time.Duration:
+		return field.String()
+	default:
+		return ""
+	}
+}
+
+// Write lists every setting with its value and where the value came from.
+func (config Config) Write(output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "SETTING\tVALUE\tFROM")
+
+	for _, setting := range settings {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.key, config.value(setting), config.Origin(setting.key))
+	}
+
+	return writer.Flush()
+}
+
+// WriteUsage lists the flags and environment variables settings can be given with.
+func WriteUsage(output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "usage: petServer [flags] [keys ... | config print]")
+	_, _ = fmt.Fprintf(writer, "  -config PATH\t%s\tYAML or TOML config file\n", configFileVariable)
+
+	defaults := Default()
+
+	for _, setting := range settings {
+		_, _ = fmt.Fprintf(writer, "  -%s\t%s\t%s, %s by default\n", setting.flagName(), setting.environmentVariable(), setting.usage, defaults.value(setting))
+	}
+
+	return writer.Flush()
+}
+
+func checkAddress(config *Config) error {
+	if _, _, err := net.SplitHostPort(config.Server.Address); err != nil {
+		return fmt.Errorf("expected a host and port such as :8080")
+	}
+
+	return nil
+}
+
+func checkRedirectAddress(config *Config) error {
+	address := config.Server.TLS.RedirectAddress
+
+	if len(address) == 0 {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return fmt.Errorf("expected a host and port such as :80")
+	}
+
+	return needs(address, config.Server.TLS.CertFile, "tls.cert_file")
+}
+
+// neededWith complains when value is empty but other, which needs it, is not.
+func neededWith(value string, other string, otherKey string) error {
+	if len(value) == 0 && len(other) > 0 {
+		return fmt.Errorf("needed with %s", otherKey)
+	}
+
+	return nil
+}
+
+// needs complains when value is set but needed, the value of neededKey, is empty.
+func needs(value string, needed string, neededKey string) error {
+	if len(value) > 0 && len(needed) == 0 {
+		return fmt.Errorf("needs %s", neededKey)
+	}
+
+	return nil
+}
+
+func notEmpty(text string) error {
+	if len(strings.TrimSpace(text)) == 0 {
+		return fmt.Errorf("may not be empty")
+	}
+
+	return nil
+}
+
+func positive(duration time.Duration) error {
+	if duration <= 0 {
+		return fmt.Errorf("must be more than zero")
+	}
+
+	return nil
+}
+
+func notNegative(duration time.Duration) error {
+	if duration < 0 {
+		return fmt.Errorf("may not be negative")
+	}
+
+	return nil
+}
+
+// positiveInt is positive for sizes and counts.
+func positiveInt(count int64) error {
+	if count <= 0 {
+		return fmt.Errorf("must be more than zero")
+	}
+
+	return nil
+}
+
+// notNegativeInt is notNegative for sizes and counts.
+func notNegativeInt(count int64) error {
+	if count < 0 {
+		return fmt.Errorf("may not be negative")
+	}
+
+	return nil
+}
+
+// closestSetting returns the setting key was probably meant to be, if one is close
+// enough.
+func closestSetting(key string) (setting, bool) {
+	best, bestDistance := setting{}, 4
+
+	for _, setting := range settings {
+		if distance := editDistance(key, setting.key); distance < bestDistance {
+			best, bestDistance = setting, distance
+		}
+	}
+
+	return best, len(best.key) > 0
+}
+
+func editDistance(first string, second string) int {
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+
+			current[j] = previous[j-1] + cost
+
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(second)]
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
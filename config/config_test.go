@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, directory string, name string, text string) string {
+	filePath := filepath.Join(directory, name)
+
+	if err := ioutil.WriteFile(filePath, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filePath
+}
+
+func TestFlagsOverrideEnvironmentOverridesFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestFlagsOverrideEnvironmentOverridesFile")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := writeConfigFile(t, directory, "petServer.yaml", `
+# Where the server listens.
+server:
+  address: ":9000"
+  drain_timeout: 10s   # long enough for uploads
+store:
+  file_path: '/var/lib/pets.json'
+  require_unique_names: true
+`)
+
+	config, arguments, err := Load(
+		[]string{"-config", filePath, "-server-drain-timeout", "5s", "keys", "list"},
+		[]string{"PETSERVER_SERVER_DRAIN_TIMEOUT=20s", "PETSERVER_AUTH_JWT_AUDIENCE=pets", "HOME=/root"},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(arguments, " ") != "keys list" {
+		t.Errorf("expected the command to be left over, got %v", arguments)
+	}
+
+	expected := map[string]string{
+		"server.address":             "file " + filePath + ":4",
+		"server.drain_timeout":       "flag -server-drain-timeout",
+		"store.file_path":            "file " + filePath + ":7",
+		"store.require_unique_names": "file " + filePath + ":8",
+		"auth.jwt_audience":          "env PETSERVER_AUTH_JWT_AUDIENCE",
+		"reminders.window":           "default",
+	}
+
+	for key, origin := range expected {
+		if config.Origin(key) != origin {
+			t.Errorf("expected %s to come from %q, got %q", key, origin, config.Origin(key))
+		}
+	}
+
+	if config.Server.Address != ":9000" || config.Server.DrainTimeout != 5*time.Second || config.Store.FilePath != "/var/lib/pets.json" ||
+		!config.Store.RequireUniqueNames || config.Auth.JWTAudience != "pets" || config.Reminders.Window != Default().Reminders.Window {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+
+	var output bytes.Buffer
+
+	if err := config.Write(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.String(), "server.drain_timeout") || !strings.Contains(output.String(), "5s") || !strings.Contains(output.String(), "flag -server-drain-timeout") {
+		t.Errorf("expected the printed configuration to say where each value came from, got\n%s", output.String())
+	}
+}
+
+func TestReadingTOMLFromTheEnvironment(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestReadingTOMLFromTheEnvironment")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := writeConfigFile(t, directory, "petServer.toml", `
+[server]
+admin_address = "unix:/run/petServer.sock" # only the owner may close the server
+max_body_bytes = 2048
+
+[reminders]
+window = "72h"
+`)
+
+	config, _, err := Load(nil, []string{"PETSERVER_CONFIG=" + filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.File != filePath || config.Server.AdminAddress != "unix:/run/petServer.sock" || config.Server.MaxBodyBytes != 2048 || config.Reminders.Window != 72*time.Hour {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+
+	if config.Origin("server.max_body_bytes") != "file "+filePath+":4" {
+		t.Errorf("unexpected origin %q", config.Origin("server.max_body_bytes"))
+	}
+}
+
+func TestInvalidConfigurationIsExplained(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestInvalidConfigurationIsExplained")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := writeConfigFile(t, directory, "petServer.yaml", "server:\n  adress: \":8080\"\n")
+
+	_, _, err = Load(
+		[]string{"-config", filePath, "-reminders-window", "a fortnight"},
+		[]string{"PETSERVER_STORE_REQUIRE_UNIQUE_NAMES=maybe", "PETSERVER_SERVER_PORT=8080", "PETSERVER_SERVER_ADRESS=:8080"},
+	)
+
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+
+	for _, expected := range []string{
+		filePath + `:2: unknown setting "server.adress"; did you mean server.address?`,
+		`store.require_unique_names (from env PETSERVER_STORE_REQUIRE_UNIQUE_NAMES): "maybe" is not true or false`,
+		"environment variable PETSERVER_SERVER_PORT is not a setting",
+		"PETSERVER_SERVER_ADRESS is not a setting; did you mean PETSERVER_SERVER_ADDRESS?",
+		`reminders.window (from flag -reminders-window): "a fortnight" is not a duration`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error to say %q, got\n%v", expected, err)
+		}
+	}
+
+	_, _, err = Load([]string{"-server-admin-address", "0.0.0.0:8081", "-server-drain-timeout", "0s", "-server-max-body-bytes", "0", "-log-max-backups", "-1"}, nil)
+
+	for _, expected := range []string{
+		`server.admin_address = "0.0.0.0:8081" (from flag -server-admin-address): admin address must be on localhost`,
+		"server.drain_timeout = 0s (from flag -server-drain-timeout): must be more than zero",
+		"server.max_body_bytes = 0 (from flag -server-max-body-bytes): must be more than zero",
+		"log.max_backups = -1 (from flag -log-max-backups): may not be negative",
+	} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error to say %q, got\n%v", expected, err)
+		}
+	}
+
+	_, _, err = Load([]string{"-tls-key-file", "server.key", "-tls-require-client-cert", "-tls-redirect-address", ":80", "-reminders-smtp-address", "localhost:25"},
+		[]string{"PETSERVER_AUTH_CLIENT_CERT_ROLES=ops-bot=owner", "PETSERVER_AUTH_JWT_ROLES=staff"})
+
+	for _, expected := range []string{
+		`tls.cert_file = "" (from default): needed with tls.key_file`,
+		"tls.require_client_cert = true (from flag -tls-require-client-cert): needs tls.client_ca_file",
+		`tls.redirect_address = ":80" (from flag -tls-redirect-address): needs tls.cert_file`,
+		"auth.client_cert_roles",
+		`reminders.smtp_from = "" (from default): needed with reminders.smtp_address`,
+		`auth.jwt_roles = "staff" (from env PETSERVER_AUTH_JWT_ROLES): expected name=role, not "staff"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error to say %q, got\n%v", expected, err)
+		}
+	}
+
+	tomlFilePath := writeConfigFile(t, directory, "petServer.toml", "[store]\nfile_path = /var/lib/my pets.json\n")
+
+	if _, _, err := Load([]string{"-config", tomlFilePath}, nil); err == nil || !strings.Contains(err.Error(), tomlFilePath+":2:") {
+		t.Errorf("expected an unquoted TOML string to be refused with its line, got %v", err)
+	}
+
+	if _, _, err := Load([]string{"-help"}, nil); err != flag.ErrHelp {
+		t.Errorf("expected flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestExampleConfigFileLoads(t *testing.T) {
+	config, _, err := Load([]string{"-config", "../petServer.example.yaml"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(config.Origin("log.audit_file"), "file ../petServer.example.yaml:") {
+		t.Errorf("expected log.audit_file to come from the file, got %q", config.Origin("log.audit_file"))
+	}
+}
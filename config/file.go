@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"petServer/codecs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fileValue is the text given for key on a line of a config file.
+type fileValue struct {
+	key  string
+	text string
+	line int
+}
+
+// readFile reads the settings of a config file, YAML when it ends in .yaml or .yml and
+// TOML when it ends in .toml. Only what settings need of TOML is understood: tables
+// holding keys with single values, and comments.
+func readFile(filePath string) (map[string]fileValue, error) {
+	fileData, err := ioutil.ReadFile(filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		return parseYAML(filePath, fileData)
+	case ".toml":
+		return parseTOML(filePath, string(fileData))
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", filePath)
+	}
+}
+
+// parseYAML reads sections holding keys indented below them:
+//
+//	server:
+//	  address: ":8080"
+func parseYAML(filePath string, fileData []byte) (map[string]fileValue, error) {
+	scalars, err := codecs.ReadYAMLScalars(bytes.NewReader(fileData))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	values := make(map[string]fileValue)
+
+	for _, scalar := range scalars {
+		if err := addValue(values, fileValue{key: scalar.Key, text: scalar.Text, line: scalar.Line}, filePath); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// parseTOML reads tables holding keys:
+//
+//	[server]
+//	address = ":8080"
+func parseTOML(filePath string, text string) (map[string]fileValue, error) {
+	values := make(map[string]fileValue)
+	section := ""
+
+	for index, line := range strings.Split(text, "\n") {
+		number := index + 1
+		line = strings.TrimSpace(stripComment(line))
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: expected [section]", filePath, number)
+			}
+
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		name, rawValue, ok := strings.Cut(line, "=")
+
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", filePath, number)
+		}
+
+		key := strings.TrimSpace(name)
+
+		if len(section) > 0 {
+			key = section + "." + key
+		}
+
+		value, err := unquote(strings.TrimSpace(rawValue))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", filePath, number, err)
+		}
+
+		if err := addValue(values, fileValue{key: key, text: value, line: number}, filePath); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func addValue(values map[string]fileValue, value fileValue, filePath string) error {
+	if earlier, ok := values[value.key]; ok {
+		return fmt.Errorf("%s:%d: %s is already set on line %d", filePath, value.line, value.key, earlier.line)
+	}
+
+	values[value.key] = value
+
+	return nil
+}
+
+// stripComment removes a comment starting with # outside quotes.
+func stripComment(line string) string {
+	quote := rune(0)
+
+	for index, character := range line {
+		switch {
+		case quote != 0 && character == quote:
+			quote = 0
+		case quote == 0 && (character == '"' || character == '\''):
+			quote = character
+		case quote == 0 && character == '#':
+			return line[:index]
+		}
+	}
+
+	return line
+}
+
+// unquote returns the text of a TOML value, with double quoted strings unescaped and
+// single quoted ones taken as they are. As TOML strings must be quoted, bare values are
+// only allowed for numbers, booleans and the like.
+func unquote(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		text, err := strconv.Unquote(value)
+
+		if err != nil {
+			return "", fmt.Errorf("bad double quoted string %s", value)
+		}
+
+		return text, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("bad single quoted string %s", value)
+		}
+
+		return value[1 : len(value)-1], nil
+	case strings.ContainsAny(value, " \t[{"):
+		return "", fmt.Errorf("expected a single value, not %s", value)
+	default:
+		return value, nil
+	}
+}
+
+// sortedValues returns values in the order they appear in the file.
+func sortedValues(values map[string]fileValue) []fileValue {
+	sorted := make([]fileValue, 0, len(values))
+
+	for _, value := range values {
+		sorted = append(sorted, value)
+	}
+
+	sort.Slice(sorted, func(i int, j int) bool {
+		return sorted[i].line < sorted[j].line
+	})
+
+	return sorted
+}
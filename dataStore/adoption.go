@@ -0,0 +1,295 @@
+package dataStore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const IntakeStatus = "intake"
+const AvailableStatus = "available"
+const OnHoldStatus = "on_hold"
+const AdoptedStatus = "adopted"
+const ReturnedStatus = "returned"
+const TransferredStatus = "transferred"
+
+var ErrInvalidTransition = errors.New("transition not allowed")
+
+// ErrUnknownStatus is returned for a status the adoption workflow does not have.
+var ErrUnknownStatus = errors.New("unknown adoption status")
+
+// ErrTransitionBlocked wraps the reason a guard gave for refusing a transition.
+var ErrTransitionBlocked = errors.New("transition blocked")
+
+// InvalidTransitionError is returned when the workflow has no transition from the
+// pet's status to the one asked for. It matches ErrInvalidTransition.
+type InvalidTransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (err *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("%s: %s to %s, allowed next statuses are [%s]", ErrInvalidTransition, err.From, err.To, strings.Join(err.Allowed, ", "))
+}
+
+func (err *InvalidTransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// StatusChange records one transition of a pet's adoption status.
+type StatusChange struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	By     string    `json:"by"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// AdoptionRecord is a pet's adoption status and how it got there. Pets without a
+// record are in IntakeStatus.
+type AdoptionRecord struct {
+	Status  string         `json:"status"`
+	History []StatusChange `json:"history"`
+}
+
+// AdoptionCollection holds adoption records keyed by pet ID.
+type AdoptionCollection struct {
+	Records map[string]AdoptionRecord `json:"adoption_records"`
+}
+
+func NewAdoptionRecord() AdoptionRecord {
+	return AdoptionRecord{Status: IntakeStatus, History: []StatusChange{}}
+}
+
+func NewAdoptionCollection() AdoptionCollection {
+	return AdoptionCollection{Records: make(map[string]AdoptionRecord)}
+}
+
+// TransitionContext is what a guard gets to decide whether a pet may move to a new
+// status. It is a snapshot taken while the store is locked.
+type TransitionContext struct {
+	Pet           Pet
+	Links         []PetOwnerLink
+	MedicalRecord MedicalRecord
+	From          string
+	To            string
+	Now           time.Time
+}
+
+// TransitionGuard returns an error explaining why the transition must not happen.
+type TransitionGuard func(context TransitionContext) error
+
+// AdoptionWorkflow is the state machine pets move through. Transitions lists the
+// statuses each status may move to; Guards lists the checks a pet has to pass to
+// enter a status.
+type AdoptionWorkflow struct {
+	Transitions map[string][]string
+	Guards      map[string][]TransitionGuard
+}
+
+// DefaultAdoptionWorkflow is the shelter's usual intake to adoption process.
+func DefaultAdoptionWorkflow() AdoptionWorkflow {
+	return AdoptionWorkflow{
+		Transitions: map[string][]string{
+			IntakeStatus:      {AvailableStatus, TransferredStatus},
+			AvailableStatus:   {OnHoldStatus, AdoptedStatus, TransferredStatus},
+			OnHoldStatus:      {AvailableStatus, AdoptedStatus, TransferredStatus},
+			AdoptedStatus:     {ReturnedStatus},
+			ReturnedStatus:    {AvailableStatus, TransferredStatus},
+			TransferredStatus: {},
+		},
+		Guards: map[string][]TransitionGuard{
+			AdoptedStatus: {RequireOwner, RequireCurrentVaccinations},
+		},
+	}
+}
+
+// sorted returns a copy of the workflow with the statuses each status may move to
+// sorted, so that allowed need not sort them each time. Statuses only ever moved to are
+// added with nowhere to move to, so that every status is a key of Transitions.
+func (workflow AdoptionWorkflow) sorted() AdoptionWorkflow {
+	transitions := make(map[string][]string, len(workflow.Transitions))
+
+	for from, to := range workflow.Transitions {
+		transitions[from] = append([]string{}, to...)
+		sort.Strings(transitions[from])
+	}
+
+	for _, to := range workflow.Transitions {
+		for _, status := range to {
+			if _, ok := transitions[status]; !ok {
+				transitions[status] = []string{}
+			}
+		}
+	}
+
+	workflow.Transitions = transitions
+
+	return workflow
+}
+
+// allowed returns the statuses a pet in status from may move to, which the caller must
+// not change.
+func (workflow AdoptionWorkflow) allowed(from string) []string {
+	return workflow.Transitions[from]
+}
+
+// RequireOwner refuses the transition unless the pet has a primary owner.
+func RequireOwner(context TransitionContext) error {
+	for _, link := range context.Links {
+		if link.Role == PrimaryOwnerRole {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s needs a primary owner", ErrTransitionBlocked, context.Pet.Name)
+}
+
+// RequireCurrentVaccinations refuses the transition unless the pet has been vaccinated
+// and the latest vaccination of every vaccine is not past its due date.
+func RequireCurrentVaccinations(context TransitionContext) error {
+	if len(context.MedicalRecord.Vaccinations) == 0 {
+		return fmt.Errorf("%w: %s has no vaccinations on record", ErrTransitionBlocked, context.Pet.Name)
+	}
+
+	today := context.Now.Format(BirthDateLayout)
+
+	for _, vaccination := range context.MedicalRecord.LatestVaccinations() {
+		if len(vaccination.DueDate) > 0 && vaccination.DueDate < today {
+			return fmt.Errorf("%w: %s's %s vaccination was due %s", ErrTransitionBlocked, context.Pet.Name, vaccination.Vaccine, vaccination.DueDate)
+		}
+	}
+
+	return nil
+}
+
+type AdoptionStore interface {
+	SetAdoptionWorkflow(workflow AdoptionWorkflow)
+	AdoptionRecordOf(petID string) (AdoptionRecord, []string, error)
+	TransitionPet(petID string, to string, by string, reason string) (AdoptionRecord, []string, error)
+	PetsWithStatus(status string) PetsCollection
+}
+
+func (store *dataStore) SetAdoptionWorkflow(workflow AdoptionWorkflow) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.adoptionWorkflow = workflow.sorted()
+}
+
+// AdoptionRecordOf returns the pet's adoption record and the statuses it may move to.
+func (store *dataStore) AdoptionRecordOf(petID string) (AdoptionRecord, []string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return AdoptionRecord{}, nil, ErrPetNotFound
+	}
+
+	record := store.adoptionRecordOf(petID)
+
+	return record, store.adoptionWorkflow.allowed(record.Status), nil
+}
+
+// TransitionPet moves the pet to status to, recording who did it and why, provided
+// the workflow allows it and every guard on to agrees. It returns the updated record
+// and the statuses the pet may move to next.
+func (store *dataStore) TransitionPet(petID string, to string, by string, reason string) (AdoptionRecord, []string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	pet, ok := store.petsCollection.Collection[petID]
+
+	if !ok {
+		return AdoptionRecord{}, nil, ErrPetNotFound
+	}
+
+	if _, ok := store.adoptionWorkflow.Transitions[to]; !ok {
+		return AdoptionRecord{}, nil, fmt.Errorf("%w: %q", ErrUnknownStatus, to)
+	}
+
+	record := store.adoptionRecordOf(petID)
+	allowed := store.adoptionWorkflow.allowed(record.Status)
+
+	if !containsString(allowed, to) {
+		return AdoptionRecord{}, nil, &InvalidTransitionError{From: record.Status, To: to, Allowed: allowed}
+	}
+
+	medicalRecord, ok := store.medicalCollection.Records[petID]
+
+	if !ok {
+		medicalRecord = NewMedicalRecord()
+	}
+
+	now := time.Now().UTC()
+
+	context := TransitionContext{
+		Pet: pet,
+		Links: filterLinks(store.ownersCollection.Links, func(link PetOwnerLink) bool {
+			return link.PetID == petID
+		}),
+		MedicalRecord: medicalRecord.copy(),
+		From:          record.Status,
+		To:            to,
+		Now:           now,
+	}
+
+	for _, guard := range store.adoptionWorkflow.Guards[to] {
+		if err := guard(context); err != nil {
+			return AdoptionRecord{}, nil, err
+		}
+	}
+
+	record.History = append(record.History, StatusChange{From: record.Status, To: to, By: by, Reason: reason, At: now})
+	record.Status = to
+	store.adoptionCollection.Records[petID] = record
+
+	return record.copy(), store.adoptionWorkflow.allowed(to), nil
+}
+
+// PetsWithStatus returns every pet whose adoption status is status.
+func (store *dataStore) PetsWithStatus(status string) PetsCollection {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	result := NewPetsCollection()
+
+	for id, pet := range store.petsCollection.Collection {
+		if store.adoptionRecordOf(id).Status == status {
+			result.Collection[id] = pet
+		}
+	}
+
+	return result.copyForReading()
+}
+
+// adoptionRecordOf returns a copy of the pet's adoption record. The caller must hold
+// the store lock.
+func (store *dataStore) adoptionRecordOf(petID string) AdoptionRecord {
+	record, ok := store.adoptionCollection.Records[petID]
+
+	if !ok {
+		return NewAdoptionRecord()
+	}
+
+	return record.copy()
+}
+
+func (record AdoptionRecord) copy() AdoptionRecord {
+	record.History = append([]StatusChange{}, record.History...)
+
+	return record
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,261 @@
+package dataStore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const BookedAppointment = "booked"
+const CancelledAppointment = "cancelled"
+
+// PetRemovedReason is why appointments cancelled by removing their pet were cancelled.
+const PetRemovedReason = "pet removed"
+
+var ErrAppointmentNotFound = errors.New("appointment not found")
+var ErrAppointmentOverlap = errors.New("pet already has an appointment at that time")
+var ErrResourceFull = errors.New("resource is fully booked at that time")
+
+// ErrInvalidAppointment wraps every validation failure for appointments.
+var ErrInvalidAppointment = errors.New("invalid appointment")
+
+// Appointment books a resource, such as a grooming table or a boarding kennel, for a
+// pet. Start and End are kept in UTC; TimeZone is the IANA zone the appointment was
+// made in and is used when showing it. CancelReason says why an appointment the store
+// cancelled by itself was cancelled.
+type Appointment struct {
+	ID           string    `json:"id"`
+	PetID        string    `json:"pet_id"`
+	Kind         string    `json:"kind"`
+	Resource     string    `json:"resource"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	TimeZone     string    `json:"time_zone,omitempty"`
+	Status       string    `json:"status"`
+	CancelReason string    `json:"cancel_reason,omitempty"`
+	Notes        string    `json:"notes,omitempty"`
+}
+
+// AppointmentsCollection holds appointments keyed by ID and, keyed by resource, how
+// many appointments each resource can take at once. Resources not listed take one.
+type AppointmentsCollection struct {
+	Appointments map[string]Appointment `json:"appointments"`
+	Capacities   map[string]int         `json:"capacities"`
+}
+
+func NewAppointmentsCollection() AppointmentsCollection {
+	return AppointmentsCollection{Appointments: make(map[string]Appointment), Capacities: make(map[string]int)}
+}
+
+type AppointmentStore interface {
+	BookAppointment(appointment Appointment) (Appointment, error)
+	RescheduleAppointment(id string, start time.Time, end time.Time) (Appointment, error)
+	CancelAppointment(id string) (Appointment, error)
+	AppointmentByID(id string) (Appointment, error)
+	AppointmentsBetween(from time.Time, to time.Time) []Appointment
+	SetResourceCapacity(resource string, capacity int)
+}
+
+func (appointment Appointment) Validate() error {
+	switch appointment.Kind {
+	case "grooming", "vet", "boarding":
+	default:
+		return fmt.Errorf("%w: kind must be grooming, vet or boarding, not %q", ErrInvalidAppointment, appointment.Kind)
+	}
+
+	if !appointment.End.After(appointment.Start) {
+		return fmt.Errorf("%w: end must be after start", ErrInvalidAppointment)
+	}
+
+	if _, err := time.LoadLocation(appointment.TimeZone); err != nil {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidAppointment, appointment.TimeZone)
+	}
+
+	return nil
+}
+
+func (appointment Appointment) overlaps(start time.Time, end time.Time) bool {
+	return appointment.Status == BookedAppointment && appointment.Start.Before(end) && start.Before(appointment.End)
+}
+
+// localized returns the appointment with its times in its own time zone.
+func (appointment Appointment) localized() Appointment {
+	if location, err := time.LoadLocation(appointment.TimeZone); err == nil {
+		appointment.Start = appointment.Start.In(location)
+		appointment.End = appointment.End.In(location)
+	}
+
+	return appointment
+}
+
+func (store *dataStore) SetResourceCapacity(resource string, capacity int) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.appointmentsCollection.Capacities[resource] = capacity
+}
+
+func (store *dataStore) BookAppointment(appointment Appointment) (Appointment, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if len(appointment.Resource) == 0 {
+		appointment.Resource = appointment.Kind
+	}
+
+	appointment.ID = NewID()
+	appointment.Status = BookedAppointment
+
+	if err := store.checkAppointment(appointment); err != nil {
+		return Appointment{}, err
+	}
+
+	appointment.Start = appointment.Start.UTC()
+	appointment.End = appointment.End.UTC()
+	store.appointmentsCollection.Appointments[appointment.ID] = appointment
+
+	return appointment.localized(), nil
+}
+
+func (store *dataStore) RescheduleAppointment(id string, start time.Time, end time.Time) (Appointment, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	appointment, ok := store.appointmentsCollection.Appointments[id]
+
+	if !ok {
+		return Appointment{}, ErrAppointmentNotFound
+	}
+
+	if appointment.Status != BookedAppointment {
+		return Appointment{}, fmt.Errorf("%w: a %s appointment cannot be rescheduled", ErrInvalidAppointment, appointment.Status)
+	}
+
+	appointment.Start = start
+	appointment.End = end
+
+	if err := store.checkAppointment(appointment); err != nil {
+		return Appointment{}, err
+	}
+
+	appointment.Start = start.UTC()
+	appointment.End = end.UTC()
+	store.appointmentsCollection.Appointments[id] = appointment
+
+	return appointment.localized(), nil
+}
+
+func (store *dataStore) CancelAppointment(id string) (Appointment, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	appointment, ok := store.appointmentsCollection.Appointments[id]
+
+	if !ok {
+		return Appointment{}, ErrAppointmentNotFound
+	}
+
+	appointment.Status = CancelledAppointment
+	store.appointmentsCollection.Appointments[id] = appointment
+
+	return appointment.localized(), nil
+}
+
+func (store *dataStore) AppointmentByID(id string) (Appointment, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	appointment, ok := store.appointmentsCollection.Appointments[id]
+
+	if !ok {
+		return Appointment{}, ErrAppointmentNotFound
+	}
+
+	return appointment.localized(), nil
+}
+
+// AppointmentsBetween returns every appointment, cancelled ones included, that
+// overlaps the range from to to, ordered by start time.
+func (store *dataStore) AppointmentsBetween(from time.Time, to time.Time) []Appointment {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	result := []Appointment{}
+
+	for _, appointment := range store.appointmentsCollection.Appointments {
+		if appointment.Start.Before(to) && from.Before(appointment.End) {
+			result = append(result, appointment.localized())
+		}
+	}
+
+	sort.Slice(result, func(i int, j int) bool {
+		if result[i].Start.Equal(result[j].Start) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].Start.Before(result[j].Start)
+	})
+
+	return result
+}
+
+// checkAppointment validates a booked appointment against the pets and every other
+// booked appointment: the pet must exist and be free, and the resource must have room
+// throughout.
+func (store *dataStore) checkAppointment(appointment Appointment) error {
+	if err := appointment.Validate(); err != nil {
+		return err
+	}
+
+	if _, ok := store.petsCollection.Collection[appointment.PetID]; !ok {
+		return ErrPetNotFound
+	}
+
+	capacity, ok := store.appointmentsCollection.Capacities[appointment.Resource]
+
+	if !ok {
+		capacity = 1
+	}
+
+	sharingResource := []Appointment{}
+
+	for id, other := range store.appointmentsCollection.Appointments {
+		if id == appointment.ID || !other.overlaps(appointment.Start, appointment.End) {
+			continue
+		}
+
+		if other.PetID == appointment.PetID {
+			return ErrAppointmentOverlap
+		}
+
+		if other.Resource == appointment.Resource {
+			sharingResource = append(sharingResource, other)
+		}
+	}
+
+	// The most appointments running at once always includes one that starts at that
+	// moment, so it is enough to count at each start within the new appointment.
+	instants := []time.Time{appointment.Start}
+
+	for _, other := range sharingResource {
+		if other.Start.After(appointment.Start) {
+			instants = append(instants, other.Start)
+		}
+	}
+
+	for _, instant := range instants {
+		running := 1
+
+		for _, other := range sharingResource {
+			if !other.Start.After(instant) && other.End.After(instant) {
+				running++
+			}
+		}
+
+		if running > capacity {
+			return ErrResourceFull
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package dataStore
+
+import (
+	"log/slog"
+	"petServer/logging"
+)
+
+// Actions recorded in the audit log.
+const (
+	AddPetAction    = "add_pet"
+	PutPetAction    = "put_pet"
+	CreatePetAction = "create_pet"
+	RemovePetAction = "remove_pet"
+	RenamePetAction = "rename_pet"
+	UpdatePetAction = "update_pet"
+	ImportPetAction = "import_pet"
+)
+
+// Actor is who a change to the store is made for, as recorded in the audit log.
+type Actor struct {
+	Subject   string
+	RequestID string
+}
+
+// ActingStore is a store that can record who its changes are made for.
+type ActingStore interface {
+	As(actor Actor) DataStore
+}
+
+// Audit returns store recording every change it makes to pets in auditLog, once the
+// change has been made. The changes are recorded as made by nobody in particular, unless
+// made through the store As returns for an actor. A change that cannot be recorded is
+// still made, and the failure logged.
+func Audit(store DataStore, auditLog *logging.AuditLog) DataStore {
+	return &auditedStore{DataStore: store, auditLog: auditLog}
+}
+
+type auditedStore struct {
+	DataStore
+	auditLog *logging.AuditLog
+	actor    Actor
+}
+
+func (store *auditedStore) As(actor Actor) DataStore {
+	return &auditedStore{DataStore: store.DataStore, auditLog: store.auditLog, actor: actor}
+}
+
+func (store *auditedStore) record(action string, id string, name string) {
+	entry := logging.AuditEntry{Action: action, PetID: id, PetName: name, Actor: store.actor.Subject, RequestID: store.actor.RequestID}
+
+	if err := store.auditLog.Record(entry); err != nil {
+		slog.Error("recording a change in the audit log failed", "action", action, "pet_id", id, "request_id", store.actor.RequestID, "error", err)
+	}
+}
+
+func (store *auditedStore) AddPet(name string, breed string, age int) PetsCollection {
+	petsCollection := store.DataStore.AddPet(name, breed, age)
+
+	if ids := petsCollection.idsNamed(name); len(ids) > 0 {
+		store.record(AddPetAction, ids[0], name)
+	}
+
+	return petsCollection
+}
+
+func (store *auditedStore) PutPet(pet Pet) (PetsCollection, error) {
+	petsCollection, err := store.DataStore.PutPet(pet)
+
+	if err == nil {
+		// A pet without an ID replaced the oldest pet with its name, or was created.
+		if ids := petsCollection.idsNamed(pet.Name); len(pet.ID) == 0 && len(ids) > 0 {
+			pet.ID = ids[0]
+		}
+
+		store.record(PutPetAction, pet.ID, pet.Name)
+	}
+
+	return petsCollection, err
+}
+
+func (store *auditedStore) PutPets(pets []Pet) (PetsCollection, error) {
+	petsCollection, err := store.DataStore.PutPets(pets)
+
+	if err == nil {
+		for id, put := range petsCollection.Collection {
+			store.record(PutPetAction, id, put.Name)
+		}
+	}
+
+	return petsCollection, err
+}
+
+func (store *auditedStore) CreatePet(pet Pet, allowDuplicateName bool) (PetsCollection, error) {
+	petsCollection, err := store.DataStore.CreatePet(pet, allowDuplicateName)
+
+	if err == nil {
+		for id, created := range petsCollection.Collection {
+			store.record(CreatePetAction, id, created.Name)
+		}
+	}
+
+	return petsCollection, err
+}
+
+// RemovePet records the removal only of a pet there was, as removing an unknown ID
+// succeeds without doing anything.
+func (store *auditedStore) RemovePet(id string) (PetsCollection, error) {
+	pet, found := store.DataStore.PetByID(id).Collection[id]
+
+	petsCollection, err := store.DataStore.RemovePet(id)
+
+	if err == nil && found {
+		store.record(RemovePetAction, id, pet.Name)
+	}
+
+	return petsCollection, err
+}
+
+func (store *auditedStore) RenamePet(id string, name string) (PetsCollection, error) {
+	petsCollection, err := store.DataStore.RenamePet(id, name)
+
+	if err == nil {
+		store.record(RenamePetAction, id, name)
+	}
+
+	return petsCollection, err
+}
+
+func (store *auditedStore) UpdatePet(id string, update func(pet Pet) (Pet, error)) (PetsCollection, error) {
+	petsCollection, err := store.DataStore.UpdatePet(id, update)
+
+	if err == nil {
+		store.record(UpdatePetAction, id, petsCollection.Collection[id].Name)
+	}
+
+	return petsCollection, err
+}
+
+func (store *auditedStore) ImportPets(pets []Pet, policy ConflictPolicy, dryRun bool) ([]ImportOutcome, error) {
+	outcomes, err := store.DataStore.ImportPets(pets, policy, dryRun)
+
+	if err == nil && !dryRun {
+		for _, outcome := range outcomes {
+			if outcome.Action == CreatedImport || outcome.Action == UpdatedImport {
+				store.record(ImportPetAction, outcome.ID, outcome.Name)
+			}
+		}
+	}
+
+	return outcomes, err
+}
@@ -1,16 +1,68 @@
 package dataStore
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"sync"
+	"time"
 )
 
-func NewDataStore(filePath string) (DataStore, error) {
+var ErrPetNotFound = errors.New("pet not found")
+var ErrPetExists = errors.New("pet already exists")
+var ErrImmutableID = errors.New("pet id may not be changed")
+
+// Config says where a DataStore keeps its files and how it treats pet names.
+type Config struct {
+	// FilePath is the file pets are kept in. Owners, medical records and the rest are kept
+	// in files next to it.
+	FilePath string
+	// RequireUniqueNames starts the store off refusing duplicate names, as
+	// RequireUniqueNames does.
+	RequireUniqueNames bool
+	// BlockOwnedPetRemoval starts the store off with BlockPetRemoval rather than
+	// CascadePetRemoval, as SetPetRemovalPolicy does.
+	BlockOwnedPetRemoval bool
+}
+
+func NewDataStore(config Config) (DataStore, error) {
+	filePath := config.FilePath
 	serverSettings, err := NewServerSettings(filePath)
 
 	if err != nil {
 		return nil, err
 	}
-	return &dataStore{serverSettings: serverSettings, petsCollection: NewPetsCollection()}, nil
+
+	petRemovalPolicy := CascadePetRemoval
+
+	if config.BlockOwnedPetRemoval {
+		petRemovalPolicy = BlockPetRemoval
+	}
+
+	return &dataStore{
+		filePath:               filePath,
+		serverSettings:         serverSettings,
+		loadErr:                ErrNotLoaded,
+		petsCollection:         NewPetsCollection(),
+		requireUniqueNames:     config.RequireUniqueNames,
+		petRemovalPolicy:       petRemovalPolicy,
+		ownersFilePath:         siblingFilePath(filePath, "owners"),
+		ownersCollection:       NewOwnersCollection(),
+		medicalFilePath:        siblingFilePath(filePath, "medical"),
+		medicalCollection:      NewMedicalCollection(),
+		remindersFilePath:      siblingFilePath(filePath, "reminders"),
+		sentReminders:          NewSentRemindersCollection(),
+		appointmentsFilePath:   siblingFilePath(filePath, "appointments"),
+		appointmentsCollection: NewAppointmentsCollection(),
+		adoptionFilePath:       siblingFilePath(filePath, "adoption"),
+		adoptionCollection:     NewAdoptionCollection(),
+		adoptionWorkflow:       DefaultAdoptionWorkflow().sorted(),
+		photosFilePath:         siblingFilePath(filePath, "photos"),
+		photosCollection:       NewPhotosCollection(),
+		photoDirectory:         photoDirectory(filePath),
+	}, nil
 }
 
 type Loader interface {
@@ -19,85 +71,499 @@ type Loader interface {
 
 type Storeer interface {
 	Store() error
+	// UnsavedChanges says whether anything changed since the data was last loaded or
+	// stored.
+	UnsavedChanges() bool
 }
 
 type DataStore interface {
 	Loader
 	Storeer
+	OwnerStore
+	MedicalStore
+	ReminderStore
+	AppointmentStore
+	AdoptionStore
+	PhotoStore
+	HealthStore
 	AddPet(name string, breed string, age int) PetsCollection
-	RemovePet(name string) PetsCollection
+	PutPet(pet Pet) (PetsCollection, error)
+	PutPets(pets []Pet) (PetsCollection, error)
+	CreatePet(pet Pet, allowDuplicateName bool) (PetsCollection, error)
+	RemovePet(id string) (PetsCollection, error)
+	RenamePet(id string, name string) (PetsCollection, error)
 	AllPets() PetsCollection
 	OnePet(name string) PetsCollection
+	PetByID(id string) PetsCollection
+	UpdatePet(id string, update func(pet Pet) (Pet, error)) (PetsCollection, error)
+	ImportPets(pets []Pet, policy ConflictPolicy, dryRun bool) ([]ImportOutcome, error)
+	RequireUniqueNames(required bool)
 }
 
 type dataStore struct {
-	serverSettings ServerSettings
-	petsCollection PetsCollection
-	lock           sync.RWMutex
+	filePath               string
+	serverSettings         ServerSettings
+	loadErr                error
+	savedHash              [sha256.Size]byte
+	petsCollection         PetsCollection
+	requireUniqueNames     bool
+	ownersFilePath         string
+	ownersCollection       OwnersCollection
+	petRemovalPolicy       PetRemovalPolicy
+	medicalFilePath        string
+	medicalCollection      MedicalCollection
+	remindersFilePath      string
+	sentReminders          SentRemindersCollection
+	appointmentsFilePath   string
+	appointmentsCollection AppointmentsCollection
+	adoptionFilePath       string
+	adoptionCollection     AdoptionCollection
+	adoptionWorkflow       AdoptionWorkflow
+	photosFilePath         string
+	photosCollection       PhotosCollection
+	photoDirectory         string
+	lock                   sync.RWMutex
 }
 
 func (store *dataStore) Load() error {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
-	petsCollection, err := store.serverSettings.Deserialize()
+	store.loadErr = store.load()
 
-	if err != nil {
+	if store.loadErr == nil || os.IsNotExist(store.loadErr) {
+		store.savedHash = store.stateHash()
+	}
+
+	return store.loadErr
+}
+
+// load reads every data file, which the caller must hold the lock for, and keeps what
+// was read only when all of them could be. A missing pets file counts as no pets: the
+// other files are read all the same, and the not-exist error is returned once they are.
+func (store *dataStore) load() error {
+	petsCollection, petsErr := store.serverSettings.Deserialize()
+
+	if os.IsNotExist(petsErr) {
+		petsCollection = NewPetsCollection()
+	} else if petsErr != nil {
+		return petsErr
+	}
+
+	ownersCollection := NewOwnersCollection()
+
+	if err := readJSONFile(store.ownersFilePath, &ownersCollection); err != nil {
+		return err
+	}
+
+	if ownersCollection.Owners == nil {
+		ownersCollection.Owners = make(map[string]Owner)
+	}
+
+	medicalCollection := NewMedicalCollection()
+
+	if err := readJSONFile(store.medicalFilePath, &medicalCollection); err != nil {
+		return err
+	}
+
+	if medicalCollection.Records == nil {
+		medicalCollection.Records = make(map[string]MedicalRecord)
+	}
+
+	sentReminders := NewSentRemindersCollection()
+
+	if err := readJSONFile(store.remindersFilePath, &sentReminders); err != nil {
+		return err
+	}
+
+	if sentReminders.Sent == nil {
+		sentReminders.Sent = make(map[string]time.Time)
+	}
+
+	appointmentsCollection := NewAppointmentsCollection()
+
+	if err := readJSONFile(store.appointmentsFilePath, &appointmentsCollection); err != nil {
+		return err
+	}
+
+	if appointmentsCollection.Appointments == nil {
+		appointmentsCollection.Appointments = make(map[string]Appointment)
+	}
+
+	if appointmentsCollection.Capacities == nil {
+		appointmentsCollection.Capacities = make(map[string]int)
+	}
+
+	adoptionCollection := NewAdoptionCollection()
+
+	if err := readJSONFile(store.adoptionFilePath, &adoptionCollection); err != nil {
+		return err
+	}
+
+	if adoptionCollection.Records == nil {
+		adoptionCollection.Records = make(map[string]AdoptionRecord)
+	}
+
+	photosCollection := NewPhotosCollection()
+
+	if err := readJSONFile(store.photosFilePath, &photosCollection); err != nil {
 		return err
 	}
 
+	if photosCollection.Photos == nil {
+		photosCollection.Photos = make(map[string][]Photo)
+	}
+
+	petsCollection, migrated := migratePetsCollection(petsCollection)
+
+	// Written straight away, so that the IDs stay the same if the server restarts before
+	// anything else is stored.
+	if migrated {
+		if err := store.serverSettings.Serialize(petsCollection); err != nil {
+			return fmt.Errorf("storing the pets given IDs: %w", err)
+		}
+	}
+
 	store.petsCollection = petsCollection
+	store.ownersCollection = ownersCollection
+	store.medicalCollection = medicalCollection
+	store.sentReminders = sentReminders
+	store.appointmentsCollection = appointmentsCollection
+	store.adoptionCollection = adoptionCollection
+	store.photosCollection = photosCollection
 
-	return nil
+	return petsErr
 }
 
+// Store writes every data file. After a Load that failed, for any reason but there being
+// no pets file yet, it refuses to: the store then still holds what it held before, and
+// writing that would lose whatever is in the files.
 func (store *dataStore) Store() error {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
+	if store.loadErr != nil && store.loadErr != ErrNotLoaded && !os.IsNotExist(store.loadErr) {
+		return fmt.Errorf("not overwriting data that could not be loaded: %w", store.loadErr)
+	}
+
 	if err := store.serverSettings.Serialize(store.petsCollection); err != nil {
 		return err
 	}
 
+	if err := writeOptionalJSONFile(store.ownersFilePath, store.ownersCollection, len(store.ownersCollection.Owners) == 0); err != nil {
+		return err
+	}
+
+	if err := writeOptionalJSONFile(store.medicalFilePath, store.medicalCollection, len(store.medicalCollection.Records) == 0); err != nil {
+		return err
+	}
+
+	if err := writeOptionalJSONFile(store.remindersFilePath, store.sentReminders, len(store.sentReminders.Sent) == 0); err != nil {
+		return err
+	}
+
+	appointmentsEmpty := len(store.appointmentsCollection.Appointments) == 0 && len(store.appointmentsCollection.Capacities) == 0
+
+	if err := writeOptionalJSONFile(store.appointmentsFilePath, store.appointmentsCollection, appointmentsEmpty); err != nil {
+		return err
+	}
+
+	if err := writeOptionalJSONFile(store.adoptionFilePath, store.adoptionCollection, len(store.adoptionCollection.Records) == 0); err != nil {
+		return err
+	}
+
+	if err := writeOptionalJSONFile(store.photosFilePath, store.photosCollection, len(store.photosCollection.Photos) == 0); err != nil {
+		return err
+	}
+
+	store.savedHash = store.stateHash()
+
 	return nil
 }
 
+func (store *dataStore) UnsavedChanges() bool {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	return store.stateHash() != store.savedHash
+}
+
+// stateHash sums up everything Store writes, which the caller must hold the lock for,
+// so that changes can be told by comparing sums.
+func (store *dataStore) stateHash() [sha256.Size]byte {
+	state, err := json.Marshal([]interface{}{store.petsCollection, store.ownersCollection, store.medicalCollection, store.sentReminders,
+		store.appointmentsCollection, store.adoptionCollection, store.photosCollection})
+
+	if err != nil {
+		// Cannot match the sum of anything stored, so counts as a change.
+		return [sha256.Size]byte{}
+	}
+
+	return sha256.Sum256(state)
+}
+
+// RequireUniqueNames makes CreatePet, RenamePet and UpdatePet refuse to give a pet a
+// name that another pet already has, regardless of what the caller asks for.
+func (store *dataStore) RequireUniqueNames(required bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.requireUniqueNames = required
+}
+
+// AddPet replaces the breed and age of the pet with the given name, creating the pet
+// if there is none. When several pets share the name the oldest one is updated.
 func (store *dataStore) AddPet(name string, breed string, age int) PetsCollection {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
-	store.petsCollection.Collection[name] = Pet{Age: age, Breed: breed}
+	ids := store.petsCollection.idsNamed(name)
+
+	if len(ids) == 0 {
+		id := NewID()
+		store.petsCollection.Collection[id] = Pet{ID: id, Name: name, Age: age, Breed: breed}
+	} else {
+		pet := store.petsCollection.Collection[ids[0]]
+		pet.Age = age
+		pet.Breed = breed
+		store.petsCollection.Collection[ids[0]] = pet
+	}
 
-	return store.petsCollection
+	return store.petsCollection.copyForReading()
 }
 
-func (store *dataStore) RemovePet(name string) PetsCollection {
+// PutPet replaces a pet wholesale. A pet with an ID replaces the pet with that ID; a
+// pet without one replaces the oldest pet with the same name, or is created.
+func (store *dataStore) PutPet(pet Pet) (PetsCollection, error) {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
-	delete(store.petsCollection.Collection, name)
+	if _, err := store.petsCollection.putPet(pet, store.requireUniqueNames); err != nil {
+		return PetsCollection{}, err
+	}
 
-	return store.petsCollection
+	return store.petsCollection.copyForReading(), nil
+}
+
+// PutPets replaces each of pets as PutPet does, all or none of them: if any pet cannot
+// be put the store is left unchanged. It returns the pets as put.
+func (store *dataStore) PutPets(pets []Pet) (PetsCollection, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	working := NewPetsCollection()
+
+	for id, pet := range store.petsCollection.Collection {
+		working.Collection[id] = pet
+	}
+
+	result := NewPetsCollection()
+
+	for _, pet := range pets {
+		put, err := working.putPet(pet, store.requireUniqueNames)
+
+		if err != nil {
+			return PetsCollection{}, err
+		}
+
+		result.Collection[put.ID] = put
+	}
+
+	store.petsCollection = working
+
+	return result.copyForReading(), nil
+}
+
+// putPet replaces pet in petsCollection, returning it with its ID.
+func (petsCollection PetsCollection) putPet(pet Pet, requireUniqueNames bool) (Pet, error) {
+	if len(pet.ID) > 0 {
+		if _, ok := petsCollection.Collection[pet.ID]; !ok {
+			return Pet{}, ErrPetNotFound
+		}
+	} else if ids := petsCollection.idsNamed(pet.Name); len(ids) > 0 {
+		pet.ID = ids[0]
+	} else {
+		pet.ID = NewID()
+	}
+
+	if err := petsCollection.checkPet(pet); err != nil {
+		return Pet{}, err
+	}
+
+	if existingPet, ok := petsCollection.Collection[pet.ID]; ok && requireUniqueNames && existingPet.Name != pet.Name && len(petsCollection.idsNamed(pet.Name)) > 0 {
+		return Pet{}, ErrPetExists
+	}
+
+	petsCollection.Collection[pet.ID] = pet
+
+	return pet, nil
+}
+
+// checkPet validates pet and makes sure no other pet carries its microchip number.
+func (store *dataStore) checkPet(pet Pet) error {
+	return store.petsCollection.checkPet(pet)
+}
+
+func (petsCollection PetsCollection) checkPet(pet Pet) error {
+	if err := pet.Validate(); err != nil {
+		return err
+	}
+
+	if len(pet.Microchip) == 0 {
+		return nil
+	}
+
+	for id, otherPet := range petsCollection.Collection {
+		if id != pet.ID && otherPet.Microchip == pet.Microchip {
+			return ErrMicrochipExists
+		}
+	}
+
+	return nil
+}
+
+// CreatePet stores pet under a newly generated ID. Unless allowDuplicateName is set,
+// and the store does not require unique names, the pet's name must not be in use.
+func (store *dataStore) CreatePet(pet Pet, allowDuplicateName bool) (PetsCollection, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if (!allowDuplicateName || store.requireUniqueNames) && len(store.petsCollection.idsNamed(pet.Name)) > 0 {
+		return PetsCollection{}, ErrPetExists
+	}
+
+	pet.ID = NewID()
+
+	if err := store.checkPet(pet); err != nil {
+		return PetsCollection{}, err
+	}
+
+	store.petsCollection.Collection[pet.ID] = pet
+
+	result := NewPetsCollection()
+	result.Collection[pet.ID] = pet
+
+	return result.copyForReading(), nil
+}
+
+// RemovePet deletes the pet, its medical and adoption records and any of its photos no
+// other pet has, and cancels its booked appointments, which are kept as a record.
+// Depending on the removal policy it either deletes the pet's links to owners or, if it
+// still has any, refuses with ErrPetHasOwners.
+func (store *dataStore) RemovePet(id string) (PetsCollection, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	links := filterLinks(store.ownersCollection.Links, func(link PetOwnerLink) bool {
+		return link.PetID != id
+	})
+
+	if store.petRemovalPolicy == BlockPetRemoval && len(links) != len(store.ownersCollection.Links) {
+		return PetsCollection{}, ErrPetHasOwners
+	}
+
+	delete(store.petsCollection.Collection, id)
+	delete(store.medicalCollection.Records, id)
+	delete(store.adoptionCollection.Records, id)
+	store.ownersCollection.Links = links
+
+	for appointmentID, appointment := range store.appointmentsCollection.Appointments {
+		if appointment.PetID == id && appointment.Status == BookedAppointment {
+			appointment.Status = CancelledAppointment
+			appointment.CancelReason = PetRemovedReason
+			store.appointmentsCollection.Appointments[appointmentID] = appointment
+		}
+	}
+
+	photoIDs := []string{}
+
+	for _, photo := range store.photosCollection.Photos[id] {
+		photoIDs = append(photoIDs, photo.ID)
+	}
+
+	delete(store.photosCollection.Photos, id)
+	store.removeOrphanedPhotos(photoIDs)
+
+	return store.petsCollection.copyForReading(), nil
+}
+
+func (store *dataStore) RenamePet(id string, name string) (PetsCollection, error) {
+	return store.UpdatePet(id, func(pet Pet) (Pet, error) {
+		pet.Name = name
+		return pet, nil
+	})
 }
 
 func (store *dataStore) AllPets() PetsCollection {
 	store.lock.RLock()
 	defer store.lock.RUnlock()
 
-	return store.petsCollection
+	return store.petsCollection.copyForReading()
 }
 
+// OnePet returns every pet with the given name, keyed by ID.
 func (store *dataStore) OnePet(name string) PetsCollection {
 	store.lock.RLock()
 	defer store.lock.RUnlock()
 
 	result := NewPetsCollection()
 
-	pet := store.petsCollection.Collection[name]
+	for _, id := range store.petsCollection.idsNamed(name) {
+		result.Collection[id] = store.petsCollection.Collection[id]
+	}
+
+	return result.copyForReading()
+}
+
+func (store *dataStore) PetByID(id string) PetsCollection {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
 
-	if pet.Age != 0 || len(pet.Breed) > 0 {
-		result.Collection[name] = pet
+	result := NewPetsCollection()
+
+	if pet, ok := store.petsCollection.Collection[id]; ok {
+		result.Collection[id] = pet
+	}
+
+	return result.copyForReading()
+}
+
+// UpdatePet applies update to the pet with the given ID while holding the store lock,
+// so the pet is either fully replaced by the result of update or left untouched.
+func (store *dataStore) UpdatePet(id string, update func(pet Pet) (Pet, error)) (PetsCollection, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	pet, ok := store.petsCollection.Collection[id]
+
+	if !ok {
+		return PetsCollection{}, ErrPetNotFound
 	}
 
-	return result
+	pet.Age = pet.AgeOn(time.Now())
+
+	updatedPet, err := update(pet)
+
+	if err != nil {
+		return PetsCollection{}, err
+	}
+
+	if updatedPet.ID != id {
+		return PetsCollection{}, ErrImmutableID
+	}
+
+	if store.requireUniqueNames && updatedPet.Name != pet.Name && len(store.petsCollection.idsNamed(updatedPet.Name)) > 0 {
+		return PetsCollection{}, ErrPetExists
+	}
+
+	if err := store.checkPet(updatedPet); err != nil {
+		return PetsCollection{}, err
+	}
+
+	store.petsCollection.Collection[id] = updatedPet
+
+	result := NewPetsCollection()
+	result.Collection[id] = updatedPet
+
+	return result.copyForReading(), nil
 }
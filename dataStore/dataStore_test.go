@@ -1,7 +1,18 @@
 package dataStore
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"petServer/logging"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadingDataStore(t *testing.T) {
@@ -11,7 +22,7 @@ func TestLoadingDataStore(t *testing.T) {
 
 	_ = store3Pets(t, fileName)
 
-	store, err := NewDataStore(fileName)
+	store, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Error(err)
@@ -29,7 +40,7 @@ func TestGettingNonExistentPet(t *testing.T) {
 
 	_ = store3Pets(t, fileName)
 
-	store, err := NewDataStore(fileName)
+	store, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Error(err)
@@ -53,7 +64,7 @@ func TestGetting1Pet(t *testing.T) {
 
 	_ = store3Pets(t, fileName)
 
-	store, err := NewDataStore(fileName)
+	store, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Error(err)
@@ -69,7 +80,7 @@ func TestGetting1Pet(t *testing.T) {
 		t.Errorf("expected to get 1 pet, but got %d", len(petCollection.Collection))
 	}
 
-	pet := petCollection.Collection[buttons]
+	pet := petNamed(t, petCollection, buttons)
 
 	if pet.Breed != buttonsBreed || pet.Age != buttonsAge {
 		t.Error("got the wrong pet")
@@ -83,7 +94,7 @@ func TestGettingAllPets(t *testing.T) {
 
 	_ = store3Pets(t, fileName)
 
-	store, err := NewDataStore(fileName)
+	store, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Error(err)
@@ -99,17 +110,17 @@ func TestGettingAllPets(t *testing.T) {
 		t.Errorf("expected 3 pets, got %d", len(pets.Collection))
 	}
 
-	pet := pets.Collection[buttons]
+	pet := petNamed(t, pets, buttons)
 	if pet.Age != buttonsAge || pet.Breed != buttonsBreed {
 		t.Errorf("collection does not contain pet named %s", buttons)
 	}
 
-	pet = pets.Collection[shasta]
+	pet = petNamed(t, pets, shasta)
 	if pet.Age != shastaAge || pet.Breed != shastaBreed {
 		t.Errorf("collection does not contain pet named %s", shasta)
 	}
 
-	pet = pets.Collection[gracie]
+	pet = petNamed(t, pets, gracie)
 	if pet.Age != gracieAge || pet.Breed != gracieBreed {
 		t.Errorf("collection does not contain pet named %s", gracie)
 	}
@@ -120,7 +131,7 @@ func TestStoringPets(t *testing.T) {
 
 	defer nukeFile(fileName)
 
-	store, err := NewDataStore(fileName)
+	store, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Error(err)
@@ -142,7 +153,7 @@ func TestStoringPets(t *testing.T) {
 		t.Error(err)
 	}
 
-	store2, err := NewDataStore(fileName)
+	store2, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Error(err)
@@ -158,7 +169,7 @@ func TestStoringPets(t *testing.T) {
 		t.Errorf("expected 1 pet, got %d", len(pets2.Collection))
 	}
 
-	pet := pets2.Collection[twitch]
+	pet := petNamed(t, pets2, twitch)
 
 	if pet.Age != twitchAge || pet.Breed != twitchBreed {
 		t.Error("got incorrect pet info")
@@ -168,19 +179,296 @@ func TestStoringPets(t *testing.T) {
 func TestLoadingFromNonExistentFile(t *testing.T) {
 	const fileName = "TestLoadingFromNonExistentFile.json"
 
-	_, err := NewDataStore(fileName)
+	_, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Fatal("trying to read non-existent file should not error")
 	}
 }
 
+func TestCheckingHealth(t *testing.T) {
+	const fileName = "TestCheckingHealth.json"
+
+	defer nukeFile(fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CheckLoaded(); err != ErrNotLoaded {
+		t.Errorf("expected a store not loaded yet to say so, got %v", err)
+	}
+
+	_ = store.Load()
+
+	if err := store.CheckLoaded(); err != nil {
+		t.Errorf("expected a store without a file yet to count as loaded, got %v", err)
+	}
+
+	if err := store.CheckWritable(); err != nil {
+		t.Errorf("expected the pets file to be creatable, got %v", err)
+	}
+
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("expected checking to leave no pets file behind, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(fileName, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CheckWritable(); err != nil {
+		t.Errorf("expected the pets file to be writable, got %v", err)
+	}
+
+	if err := store.Load(); err == nil || store.CheckLoaded() != err {
+		t.Errorf("expected a broken file to fail loading, got %v", store.CheckLoaded())
+	}
+
+	unwritable, err := NewDataStore(Config{FilePath: "no such directory/pets.json"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unwritable.CheckWritable(); err == nil {
+		t.Errorf("expected a pets file in a missing directory not to be writable")
+	}
+}
+
+func TestFailedLoadKeepsDataAndFiles(t *testing.T) {
+	const fileName = "TestFailedLoadKeepsDataAndFiles.json"
+	const ownersFileName = "TestFailedLoadKeepsDataAndFiles.owners.json"
+
+	defer nukeFile(fileName)
+	defer nukeFile(ownersFileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.AddPet(shasta, shastaBreed, shastaAge)
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(ownersFileName, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Load(); err == nil {
+		t.Fatal("expected a broken owners file to fail loading")
+	}
+
+	if pets := store.AllPets(); len(pets.Collection) != 1 {
+		t.Errorf("expected the failed load to keep 1 pet, got %d", len(pets.Collection))
+	}
+
+	if err := store.Store(); err == nil {
+		t.Error("expected storing after a failed load to be refused")
+	}
+
+	if fileData, err := ioutil.ReadFile(ownersFileName); err != nil || string(fileData) != "{" {
+		t.Errorf("expected the owners file to be left alone, got %q, %v", fileData, err)
+	}
+}
+
+func TestMissingPetsFileKeepsOtherData(t *testing.T) {
+	const fileName = "TestMissingPetsFileKeepsOtherData.json"
+	ownersFileName := siblingFilePath(fileName, "owners")
+
+	defer nukeFile(fileName)
+	defer nukeFile(ownersFileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner, err := store.AddOwner(Owner{Name: "Pat", Email: "pat@example.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	nukeFile(fileName)
+
+	store2, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); !os.IsNotExist(err) {
+		t.Fatalf("expected no pets file, got %v", err)
+	}
+
+	if err := store2.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	store3, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store3.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if owners := store3.AllOwners(); len(owners) != 1 || owners[owner.ID].Email != "pat@example.com" {
+		t.Errorf("expected the owner to survive a store without a pets file, got %+v", owners)
+	}
+}
+
+func TestTellingUnsavedChanges(t *testing.T) {
+	const fileName = "TestTellingUnsavedChanges.json"
+
+	defer nukeFile(fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Load(); !os.IsNotExist(err) {
+		t.Fatalf("expected no pets file yet, got %v", err)
+	}
+
+	if store.UnsavedChanges() {
+		t.Error("expected a store without a pets file yet to have nothing to store")
+	}
+
+	store.AddPet(shasta, shastaBreed, shastaAge)
+
+	if !store.UnsavedChanges() {
+		t.Error("expected an added pet to be an unsaved change")
+	}
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.UnsavedChanges() {
+		t.Error("expected no unsaved changes once stored")
+	}
+}
+
+func TestAuditingChanges(t *testing.T) {
+	const fileName = "TestAuditingChanges.json"
+	const auditFileName = "TestAuditingChanges.audit.log"
+
+	defer nukeFile(fileName)
+	defer nukeFile(auditFileName)
+
+	auditLog, err := logging.OpenAuditLog(auditFileName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = Audit(store, auditLog)
+	store.AddPet("Shasta", "Spitz", 9)
+
+	alice := store.(ActingStore).As(Actor{Subject: "alice", RequestID: "r1"})
+	created, err := alice.CreatePet(Pet{Name: "Gracie", Breed: "Spitz"}, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := alice.CreatePet(Pet{Name: "Gracie", Breed: "Spitz"}, false); err != ErrPetExists {
+		t.Fatalf("expected a duplicate name to be refused, got %v", err)
+	}
+
+	var gracieID string
+
+	for id := range created.Collection {
+		gracieID = id
+	}
+
+	if _, err := alice.RenamePet(gracieID, "Grace"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second time there is no pet to remove, so nothing is recorded.
+	for range []int{1, 2} {
+		if _, err := store.(ActingStore).As(Actor{Subject: "bob"}).RemovePet(gracieID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := alice.ImportPets([]Pet{{Name: "Buttons", Breed: "Terrier"}}, UpsertOnConflict, true); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = auditLog.Close()
+
+	data, err := ioutil.ReadFile(auditFileName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []logging.AuditEntry{
+		{Action: AddPetAction, PetName: "Shasta"},
+		{Action: CreatePetAction, PetID: gracieID, PetName: "Gracie", Actor: "alice", RequestID: "r1"},
+		{Action: RenamePetAction, PetID: gracieID, PetName: "Grace", Actor: "alice", RequestID: "r1"},
+		{Action: RemovePetAction, PetID: gracieID, PetName: "Grace", Actor: "bob"},
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	if len(lines) != len(expected) {
+		t.Fatalf("expected only the changes made to be recorded, got %s", data)
+	}
+
+	for index, line := range lines {
+		var entry logging.AuditEntry
+
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if index == 0 {
+			expected[0].PetID = entry.PetID
+		}
+
+		if entry.Action != expected[index].Action || entry.PetID != expected[index].PetID || entry.PetName != expected[index].PetName ||
+			entry.Actor != expected[index].Actor || entry.RequestID != expected[index].RequestID || len(entry.PetID) == 0 {
+			t.Errorf("expected entry %d to be %+v, got %+v", index, expected[index], entry)
+		}
+	}
+
+	if _, err := logging.VerifyAuditLog(strings.NewReader(string(data))); err != nil {
+		t.Errorf("expected the chain to hold, got %v", err)
+	}
+}
+
 func TestSavingEmptyCollection(t *testing.T) {
 	const fileName = "TestSavingEmptyCollection.json"
 
 	defer nukeFile(fileName)
 
-	newStore, err := NewDataStore(fileName)
+	newStore, err := NewDataStore(Config{FilePath: fileName})
 
 	if err != nil {
 		t.Fatal("trying to read non-existent file should not error")
@@ -192,3 +480,665 @@ func TestSavingEmptyCollection(t *testing.T) {
 		t.Fatal("storing empty collection should not error")
 	}
 }
+
+func TestUpdatingPet(t *testing.T) {
+	const fileName = "TestUpdatingPet.json"
+
+	defer nukeFile(fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := petNamed(t, store.AddPet(buttons, buttonsBreed, buttonsAge), buttons).ID
+
+	_, err = store.UpdatePet(id, func(pet Pet) (Pet, error) {
+		pet.Age++
+		return pet, nil
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pet := store.PetByID(id).Collection[id]; pet.Age != buttonsAge+1 {
+		t.Errorf("expected age %d, got %d", buttonsAge+1, pet.Age)
+	}
+
+	_, err = store.UpdatePet(id, func(pet Pet) (Pet, error) {
+		pet.ID = "other"
+		return pet, nil
+	})
+
+	if err != ErrImmutableID {
+		t.Errorf("expected ErrImmutableID, got %v", err)
+	}
+
+	if _, err := store.UpdatePet("noID", func(pet Pet) (Pet, error) { return pet, nil }); err != ErrPetNotFound {
+		t.Errorf("expected ErrPetNotFound, got %v", err)
+	}
+}
+
+func petNamed(t *testing.T, petsCollection PetsCollection, name string) Pet {
+	for id, pet := range petsCollection.Collection {
+		if pet.Name == name {
+			if pet.ID != id {
+				t.Errorf("pet %s is keyed by %s but has ID %s", name, id, pet.ID)
+			}
+			return pet
+		}
+	}
+
+	t.Errorf("collection does not contain pet named %s", name)
+
+	return Pet{}
+}
+
+func TestMigratingNameKeyedPets(t *testing.T) {
+	const fileName = "TestMigratingNameKeyedPets.json"
+
+	defer nukeFile(fileName)
+
+	_ = store3Pets(t, fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	id := petNamed(t, store.AllPets(), shasta).ID
+
+	store2, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if pet := store2.PetByID(id).Collection[id]; pet.Name != shasta || pet.Breed != shastaBreed {
+		t.Errorf("migrated pet did not keep its ID without being stored, got %+v", pet)
+	}
+}
+
+func TestPetsSharingAName(t *testing.T) {
+	const fileName = "TestPetsSharingAName.json"
+
+	defer nukeFile(fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const buddy = "Buddy"
+
+	first, err := store.CreatePet(Pet{Name: buddy, Age: 3, Breed: "Labrador"}, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.CreatePet(Pet{Name: buddy, Age: 5, Breed: "Beagle"}, false); err != ErrPetExists {
+		t.Errorf("expected ErrPetExists, got %v", err)
+	}
+
+	if _, err := store.CreatePet(Pet{Name: buddy, Age: 5, Breed: "Beagle"}, true); err != nil {
+		t.Error(err)
+	}
+
+	if count := len(store.OnePet(buddy).Collection); count != 2 {
+		t.Errorf("expected 2 pets named %s, got %d", buddy, count)
+	}
+
+	id := petNamed(t, first, buddy).ID
+
+	if _, err := store.RenamePet(id, "Max"); err != nil {
+		t.Error(err)
+	}
+
+	if pet := store.PetByID(id).Collection[id]; pet.Name != "Max" {
+		t.Errorf("expected renamed pet, got %+v", pet)
+	}
+
+	store.RequireUniqueNames(true)
+
+	if _, err := store.RenamePet(id, buddy); err != ErrPetExists {
+		t.Errorf("expected ErrPetExists, got %v", err)
+	}
+}
+
+func TestStoringDetailedPet(t *testing.T) {
+	const fileName = "TestStoringDetailedPet.json"
+
+	defer nukeFile(fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	birthDate := time.Now().AddDate(-4, 0, -1).Format(BirthDateLayout)
+
+	pet := Pet{
+		Name:      gracie,
+		Breed:     gracieBreed,
+		Species:   "dog",
+		Sex:       "female",
+		Neutered:  true,
+		BirthDate: birthDate,
+		WeightKg:  9.5,
+		Color:     "white",
+		Microchip: "985112003456789",
+		Notes:     "afraid of thunder",
+	}
+
+	if _, err := store.CreatePet(pet, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	store2, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedPet := petNamed(t, store2.AllPets(), gracie)
+
+	if loadedPet.Age != 4 {
+		t.Errorf("expected age computed from birth date to be 4, got %d", loadedPet.Age)
+	}
+
+	if loadedPet.Species != "dog" || loadedPet.Sex != "female" || !loadedPet.Neutered || loadedPet.WeightKg != 9.5 || loadedPet.Notes != pet.Notes {
+		t.Errorf("pet did not survive a round trip: %+v", loadedPet)
+	}
+
+	pet.Name = shasta
+
+	if _, err := store2.CreatePet(pet, false); err != ErrMicrochipExists {
+		t.Errorf("expected ErrMicrochipExists, got %v", err)
+	}
+
+	pet.Microchip = ""
+	pet.Sex = "tomcat"
+
+	if _, err := store2.CreatePet(pet, false); !errors.Is(err, ErrInvalidPet) {
+		t.Errorf("expected ErrInvalidPet, got %v", err)
+	}
+}
+
+func TestStoringOwners(t *testing.T) {
+	const fileName = "TestStoringOwners.json"
+	ownersFileName := siblingFilePath(fileName, "owners")
+
+	defer nukeFile(fileName)
+	defer nukeFile(ownersFileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	petID := petNamed(t, store.AddPet(gracie, gracieBreed, gracieAge), gracie).ID
+
+	owner, err := store.AddOwner(Owner{Name: "Pat", Email: "pat@example.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.LinkPetOwner(petID, owner.ID, PrimaryOwnerRole); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.AddOwner(Owner{Name: "Sam", Email: "sam at example.com"}); !errors.Is(err, ErrInvalidOwner) {
+		t.Errorf("expected an owner with a bad email to be invalid, got %v", err)
+	}
+
+	second, _ := store.AddOwner(Owner{Name: "Sam"})
+
+	if err := store.LinkPetOwner(petID, second.ID, PrimaryOwnerRole); err != ErrPrimaryOwnerExists {
+		t.Errorf("expected ErrPrimaryOwnerExists, got %v", err)
+	}
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	store2, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	owners := store2.OwnersOfPet(petID)
+
+	if len(owners) != 1 || owners[0].Owner.Email != "pat@example.com" || owners[0].Role != PrimaryOwnerRole {
+		t.Errorf("owners did not survive a round trip: %+v", owners)
+	}
+}
+
+func TestBlockingOwnedPetRemoval(t *testing.T) {
+	const fileName = "TestBlockingOwnedPetRemoval.json"
+
+	defer nukeFile(fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName, BlockOwnedPetRemoval: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	petID := petNamed(t, store.AddPet(gracie, gracieBreed, gracieAge), gracie).ID
+
+	owner, err := store.AddOwner(Owner{Name: "Pat"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.LinkPetOwner(petID, owner.ID, PrimaryOwnerRole); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.RemovePet(petID); err != ErrPetHasOwners {
+		t.Errorf("expected ErrPetHasOwners, got %v", err)
+	}
+}
+
+func TestStoringMedicalRecords(t *testing.T) {
+	const fileName = "TestStoringMedicalRecords.json"
+
+	defer nukeFile(fileName)
+	defer nukeFile(siblingFilePath(fileName, "medical"))
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	petID := petNamed(t, store.AddPet(gracie, gracieBreed, gracieAge), gracie).ID
+
+	_, err = store.UpdateMedicalRecord(petID, func(record MedicalRecord) (MedicalRecord, error) {
+		record.Vaccinations = append(record.Vaccinations, Vaccination{Vaccine: "Rabies", DateGiven: "2025-03-01", DueDate: "2026-03-01"})
+		record.Allergies = append(record.Allergies, Allergy{Allergen: "chicken"})
+		return record, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.UpdateMedicalRecord(petID, func(record MedicalRecord) (MedicalRecord, error) {
+		record.VisitNotes = append(record.VisitNotes, VisitNote{Date: "yesterday"})
+		return record, nil
+	})
+
+	if !errors.Is(err, ErrInvalidMedicalRecord) {
+		t.Errorf("expected ErrInvalidMedicalRecord, got %v", err)
+	}
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	store2, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := store2.MedicalRecordOf(petID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(record.Vaccinations) != 1 || len(record.Vaccinations[0].ID) == 0 || len(record.Allergies) != 1 || len(record.VisitNotes) != 0 {
+		t.Errorf("medical record did not survive a round trip: %+v", record)
+	}
+
+	if _, err := store2.RemovePet(petID); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store2.AllMedicalRecords()) != 0 {
+		t.Error("removing a pet did not remove its medical record")
+	}
+}
+
+func TestResourceCapacity(t *testing.T) {
+	const fileName = "TestResourceCapacity.json"
+
+	defer nukeFile(fileName)
+	defer nukeFile(siblingFilePath(fileName, "appointments"))
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.SetResourceCapacity("kennels", 2)
+
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	book := func(name string, fromDay int, toDay int) error {
+		petID := petNamed(t, store.AddPet(name, "Mutt", 1), name).ID
+		_, err := store.BookAppointment(Appointment{PetID: petID, Kind: "boarding", Resource: "kennels", Start: day.AddDate(0, 0, fromDay), End: day.AddDate(0, 0, toDay)})
+		return err
+	}
+
+	if err := book("Rex", 0, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := book("Fido", 3, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overlaps both, but never more than one of them at a time.
+	if err := book("Spot", 1, 4); err != nil {
+		t.Errorf("expected room in the kennels, got %v", err)
+	}
+
+	if err := book("Lady", 1, 2); err != ErrResourceFull {
+		t.Errorf("expected ErrResourceFull, got %v", err)
+	}
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	store2, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if appointments := store2.AppointmentsBetween(day, day.AddDate(0, 0, 10)); len(appointments) != 3 {
+		t.Errorf("expected 3 appointments after reloading, got %d", len(appointments))
+	}
+
+	if _, err := store2.RemovePet(petNamed(t, store2.AllPets(), "Rex").ID); err != nil {
+		t.Fatal(err)
+	}
+
+	appointments := store2.AppointmentsBetween(day, day.AddDate(0, 0, 2))
+
+	if len(appointments) != 2 || appointments[0].Status != CancelledAppointment || appointments[0].CancelReason != PetRemovedReason || appointments[1].Status != BookedAppointment {
+		t.Errorf("expected removing Rex to cancel only his appointment, got %+v", appointments)
+	}
+}
+
+func TestAdoptionWorkflow(t *testing.T) {
+	const fileName = "TestAdoptionWorkflow.json"
+
+	defer nukeFile(fileName)
+	defer nukeFile(siblingFilePath(fileName, "owners"))
+	defer nukeFile(siblingFilePath(fileName, "medical"))
+	defer nukeFile(siblingFilePath(fileName, "adoption"))
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	petID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+
+	if _, _, err := store.TransitionPet(petID, AdoptedStatus, "alice", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+
+	if _, allowed, err := store.TransitionPet(petID, AvailableStatus, "alice", "vet check done"); err != nil || !containsString(allowed, AdoptedStatus) {
+		t.Fatalf("expected to become available with adoption allowed next, got %v %v", allowed, err)
+	}
+
+	if _, _, err := store.TransitionPet(petID, AdoptedStatus, "alice", ""); !errors.Is(err, ErrTransitionBlocked) {
+		t.Errorf("expected adoption without an owner to be blocked, got %v", err)
+	}
+
+	owner, err := store.AddOwner(Owner{Name: "Bob"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.LinkPetOwner(petID, owner.ID, PrimaryOwnerRole); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.UpdateMedicalRecord(petID, func(record MedicalRecord) (MedicalRecord, error) {
+		record.Vaccinations = append(record.Vaccinations, Vaccination{Vaccine: "Rabies", DateGiven: "2020-01-01", DueDate: "2021-01-01"})
+		return record, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.TransitionPet(petID, AdoptedStatus, "alice", ""); !errors.Is(err, ErrTransitionBlocked) {
+		t.Errorf("expected adoption with an overdue vaccination to be blocked, got %v", err)
+	}
+
+	_, err = store.UpdateMedicalRecord(petID, func(record MedicalRecord) (MedicalRecord, error) {
+		record.Vaccinations = append(record.Vaccinations, Vaccination{Vaccine: "Rabies", DateGiven: time.Now().Format(BirthDateLayout)})
+		return record, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.TransitionPet(petID, AdoptedStatus, "alice", "forever home"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	store2, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	record, allowed, err := store2.AdoptionRecordOf(petID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Status != AdoptedStatus || len(record.History) != 2 || record.History[1].Reason != "forever home" {
+		t.Errorf("unexpected adoption record after reloading: %+v", record)
+	}
+
+	if len(allowed) != 1 || allowed[0] != ReturnedStatus {
+		t.Errorf("expected only %s to be allowed next, got %v", ReturnedStatus, allowed)
+	}
+
+	if pets := store2.PetsWithStatus(AdoptedStatus); len(pets.Collection) != 1 {
+		t.Errorf("expected 1 adopted pet, got %d", len(pets.Collection))
+	}
+}
+
+func testPNG(t *testing.T, width int, height int) []byte {
+	picture := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for x := 0; x < width; x++ {
+		picture.Set(x, x*height/width, color.RGBA{R: 255, A: 255})
+	}
+
+	var encoded bytes.Buffer
+
+	if err := png.Encode(&encoded, picture); err != nil {
+		t.Fatal(err)
+	}
+
+	return encoded.Bytes()
+}
+
+func TestStoringPhotos(t *testing.T) {
+	const fileName = "TestStoringPhotos.json"
+
+	defer nukeFile(fileName)
+	defer os.RemoveAll(photoDirectory(fileName))
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shastaID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+	gracieID := petNamed(t, store.AddPet("Gracie", "Spitz", 9), "Gracie").ID
+
+	if _, err := store.AddPhoto(shastaID, []byte("not a photo")); err != ErrUnsupportedPhoto {
+		t.Errorf("expected ErrUnsupportedPhoto, got %v", err)
+	}
+
+	data := testPNG(t, 600, 300)
+
+	photo, err := store.AddPhoto(shastaID, data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.AddPhoto(gracieID, data); err != nil {
+		t.Fatal(err)
+	}
+
+	thumbnailPath, contentType, err := store.PhotoFile(shastaID, photo.ID, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumbnailFile, err := os.Open(thumbnailPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer thumbnailFile.Close()
+
+	config, _, err := image.DecodeConfig(thumbnailFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "image/png" || config.Width != ThumbnailSize || config.Height != ThumbnailSize/2 {
+		t.Errorf("unexpected %s thumbnail of %dx%d", contentType, config.Width, config.Height)
+	}
+
+	photoPath, _, _ := store.PhotoFile(shastaID, photo.ID, false)
+
+	if _, err := store.RemovePet(shastaID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(photoPath); err != nil {
+		t.Errorf("expected the photo Gracie still has to be kept, got %v", err)
+	}
+
+	if _, err := store.RemovePet(gracieID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(photoPath); !os.IsNotExist(err) {
+		t.Errorf("expected the orphaned photo to be deleted, got %v", err)
+	}
+
+	if _, err := os.Stat(thumbnailPath); !os.IsNotExist(err) {
+		t.Errorf("expected the orphaned thumbnail to be deleted, got %v", err)
+	}
+}
+
+func TestImportingPets(t *testing.T) {
+	const fileName = "TestImportingPets.json"
+
+	defer nukeFile(fileName)
+
+	store, err := NewDataStore(Config{FilePath: fileName})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shastaID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+	pets := []Pet{{Name: "Shasta", Breed: "Samoyed"}, {Name: "Buttons", Age: 2}, {Name: "Rex", Sex: "yes"}}
+
+	if outcomes, err := store.ImportPets(pets, FailOnConflict, false); err != ErrImportConflict || outcomes[0].ID != shastaID {
+		t.Errorf("expected ErrImportConflict for Shasta, got %v %+v", err, outcomes)
+	}
+
+	if len(store.AllPets().Collection) != 1 {
+		t.Errorf("expected a failed import to change nothing, got %d pets", len(store.AllPets().Collection))
+	}
+
+	outcomes, err := store.ImportPets(pets, UpsertOnConflict, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if outcomes[0].Action != UpdatedImport || outcomes[1].Action != CreatedImport || outcomes[2].Action != FailedImport {
+		t.Errorf("unexpected dry run outcomes: %+v", outcomes)
+	}
+
+	if len(store.AllPets().Collection) != 1 {
+		t.Errorf("expected a dry run to change nothing, got %d pets", len(store.AllPets().Collection))
+	}
+
+	if outcomes, err = store.ImportPets(pets, SkipOnConflict, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if outcomes[0].Action != SkippedImport || petNamed(t, store.AllPets(), "Shasta").Breed != "Spitz" {
+		t.Errorf("expected Shasta to be skipped, got %+v", outcomes[0])
+	}
+
+	if pets := store.AllPets(); len(pets.Collection) != 2 || petNamed(t, pets, "Buttons").Age != 2 {
+		t.Errorf("expected Buttons to be imported and Rex not, got %+v", pets)
+	}
+}
@@ -0,0 +1,65 @@
+package dataStore
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"petServer/health"
+)
+
+var ErrNotLoaded = errors.New("data not loaded yet")
+
+type HealthStore interface {
+	CheckLoaded() error
+	CheckWritable() error
+}
+
+// RegisterHealthChecks makes store's readiness depend on its data having been loaded
+// and its pets file being writable.
+func RegisterHealthChecks(store DataStore, registry *health.Registry) {
+	registry.Register(health.Readiness, "store-loaded", health.CheckerFunc(func(ctx context.Context) error {
+		return store.CheckLoaded()
+	}))
+	registry.Register(health.Readiness, "data-file-writable", health.CheckerFunc(func(ctx context.Context) error {
+		return store.CheckWritable()
+	}))
+}
+
+// CheckLoaded returns why the last Load failed, or ErrNotLoaded before the first one.
+// A store without a pets file yet counts as loaded, as there is nothing to read.
+func (store *dataStore) CheckLoaded() error {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if os.IsNotExist(store.loadErr) {
+		return nil
+	}
+
+	return store.loadErr
+}
+
+// CheckWritable returns an error unless the pets file, or the directory it is to be
+// created in, can be written to. Nothing in the file is changed.
+func (store *dataStore) CheckWritable() error {
+	file, err := os.OpenFile(store.filePath, os.O_WRONLY, 0)
+
+	if err == nil {
+		return file.Close()
+	}
+
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	probe, err := ioutil.TempFile(filepath.Dir(store.filePath), ".writable-")
+
+	if err != nil {
+		return err
+	}
+
+	_ = probe.Close()
+
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,50 @@
+package dataStore
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewID returns a new ULID: 48 bits of millisecond timestamp followed by 80 random
+// bits, encoded as 26 characters of Crockford base32 so IDs sort by creation time.
+func NewID() string {
+	var id [16]byte
+
+	milliseconds := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	for index := 5; index >= 0; index-- {
+		id[index] = byte(milliseconds)
+		milliseconds >>= 8
+	}
+
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+
+	encoded := make([]byte, 26)
+
+	// 128 bits encode to 26 five-bit characters with the first character holding 3 bits.
+	var bits uint
+	var accumulator uint32
+	position := 25
+
+	for index := len(id) - 1; index >= 0; index-- {
+		accumulator |= uint32(id[index]) << bits
+		bits += 8
+
+		for bits >= 5 && position >= 0 {
+			encoded[position] = crockfordAlphabet[accumulator&0x1f]
+			accumulator >>= 5
+			bits -= 5
+			position--
+		}
+	}
+
+	if position == 0 {
+		encoded[0] = crockfordAlphabet[accumulator&0x1f]
+	}
+
+	return string(encoded)
+}
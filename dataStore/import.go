@@ -0,0 +1,139 @@
+package dataStore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConflictPolicy decides what ImportPets does with a pet that is already in the store,
+// either under the same ID or, for pets without one, under the same name.
+type ConflictPolicy string
+
+const (
+	// UpsertOnConflict replaces the existing pet.
+	UpsertOnConflict ConflictPolicy = "upsert"
+	// SkipOnConflict leaves the existing pet alone.
+	SkipOnConflict ConflictPolicy = "skip"
+	// FailOnConflict imports nothing at all if any pet is already in the store.
+	FailOnConflict ConflictPolicy = "fail"
+)
+
+const CreatedImport = "created"
+const UpdatedImport = "updated"
+const SkippedImport = "skipped"
+const FailedImport = "failed"
+
+// ErrImportConflict is returned, with every outcome, when FailOnConflict stopped an import.
+var ErrImportConflict = errors.New("pet already exists")
+
+// ImportOutcome is what ImportPets did, or in a dry run would have done, with one pet.
+type ImportOutcome struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (policy ConflictPolicy) Valid() bool {
+	switch policy {
+	case UpsertOnConflict, SkipOnConflict, FailOnConflict:
+		return true
+	default:
+		return false
+	}
+}
+
+// ImportPets adds pets in one step, returning an outcome for each in the same order.
+// Pets that fail validation are left out and the rest are imported, unless policy is
+// FailOnConflict and one of them conflicts, in which case ErrImportConflict is returned
+// and nothing changes. A dry run reports the same outcomes without changing anything.
+func (store *dataStore) ImportPets(pets []Pet, policy ConflictPolicy, dryRun bool) ([]ImportOutcome, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	working := NewPetsCollection()
+
+	for id, pet := range store.petsCollection.Collection {
+		working.Collection[id] = pet
+	}
+
+	outcomes := make([]ImportOutcome, len(pets))
+	conflicted := false
+
+	for index, pet := range pets {
+		outcome, err := working.importPet(pet, policy, store.requireUniqueNames)
+
+		if errors.Is(err, ErrImportConflict) {
+			conflicted = true
+		}
+
+		if err != nil {
+			outcome.Action = FailedImport
+			outcome.Error = err.Error()
+		}
+
+		outcomes[index] = outcome
+	}
+
+	if conflicted && policy == FailOnConflict {
+		return outcomes, ErrImportConflict
+	}
+
+	if !dryRun {
+		store.petsCollection = working
+	}
+
+	return outcomes, nil
+}
+
+// importPet imports one pet into petsCollection.
+func (petsCollection PetsCollection) importPet(pet Pet, policy ConflictPolicy, requireUniqueNames bool) (ImportOutcome, error) {
+	outcome := ImportOutcome{ID: pet.ID, Name: pet.Name}
+
+	existingID := ""
+
+	if len(pet.ID) > 0 {
+		if _, ok := petsCollection.Collection[pet.ID]; ok {
+			existingID = pet.ID
+		}
+	} else if ids := petsCollection.idsNamed(pet.Name); len(ids) > 1 {
+		return outcome, fmt.Errorf("%d pets are named %s, give an id instead", len(ids), pet.Name)
+	} else if len(ids) == 1 {
+		existingID = ids[0]
+	}
+
+	outcome.Action = CreatedImport
+
+	if len(existingID) > 0 {
+		switch policy {
+		case SkipOnConflict:
+			outcome.ID = existingID
+			outcome.Action = SkippedImport
+			return outcome, nil
+		case UpsertOnConflict:
+			outcome.Action = UpdatedImport
+		default:
+			outcome.ID = existingID
+			return outcome, ErrImportConflict
+		}
+
+		pet.ID = existingID
+	} else if len(pet.ID) == 0 {
+		pet.ID = NewID()
+	}
+
+	if err := petsCollection.checkPet(pet); err != nil {
+		return outcome, err
+	}
+
+	for _, id := range petsCollection.idsNamed(pet.Name) {
+		if requireUniqueNames && id != pet.ID {
+			return outcome, ErrPetExists
+		}
+	}
+
+	petsCollection.Collection[pet.ID] = pet
+	outcome.ID = pet.ID
+
+	return outcome, nil
+}
@@ -0,0 +1,53 @@
+package dataStore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// siblingFilePath derives the path of a data file kept next to the pets file, so
+// "/data/pets.json" and "owners" give "/data/pets.owners.json".
+func siblingFilePath(filePath string, name string) string {
+	extension := filepath.Ext(filePath)
+
+	return strings.TrimSuffix(filePath, extension) + "." + name + extension
+}
+
+// readJSONFile decodes filePath into value. A missing file leaves value untouched and
+// is not an error, since every data file but the pets file is optional.
+func readJSONFile(filePath string, value interface{}) error {
+	fileData, err := ioutil.ReadFile(filePath)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(fileData, value)
+}
+
+func writeJSONFile(filePath string, value interface{}) error {
+	serializedValue, err := json.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filePath, serializedValue, 0644)
+}
+
+// writeOptionalJSONFile writes value like writeJSONFile, except that nothing is
+// written when value is empty and there is no file yet to overwrite.
+func writeOptionalJSONFile(filePath string, value interface{}, empty bool) error {
+	if _, err := os.Stat(filePath); empty && os.IsNotExist(err) {
+		return nil
+	}
+
+	return writeJSONFile(filePath, value)
+}
@@ -0,0 +1,261 @@
+package dataStore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrInvalidMedicalRecord wraps every validation failure for medical records.
+var ErrInvalidMedicalRecord = errors.New("invalid medical record")
+
+type Vaccination struct {
+	ID             string `json:"id"`
+	Vaccine        string `json:"vaccine"`
+	DateGiven      string `json:"date_given"`
+	DueDate        string `json:"due_date,omitempty"`
+	AdministeredBy string `json:"administered_by,omitempty"`
+}
+
+type Medication struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Dosage    string `json:"dosage,omitempty"`
+	Frequency string `json:"frequency,omitempty"`
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+}
+
+type Allergy struct {
+	ID       string `json:"id"`
+	Allergen string `json:"allergen"`
+	Reaction string `json:"reaction,omitempty"`
+	Severity string `json:"severity,omitempty"`
+}
+
+type VisitNote struct {
+	ID           string `json:"id"`
+	Date         string `json:"date"`
+	Veterinarian string `json:"veterinarian,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	Notes        string `json:"notes"`
+}
+
+// MedicalRecord is everything the clinic knows about one pet's health. Dates use
+// BirthDateLayout.
+type MedicalRecord struct {
+	Vaccinations []Vaccination `json:"vaccinations"`
+	Medications  []Medication  `json:"medications"`
+	Allergies    []Allergy     `json:"allergies"`
+	VisitNotes   []VisitNote   `json:"visit_notes"`
+}
+
+// MedicalCollection holds medical records keyed by pet ID.
+type MedicalCollection struct {
+	Records map[string]MedicalRecord `json:"medical_records"`
+}
+
+func NewMedicalRecord() MedicalRecord {
+	return MedicalRecord{
+		Vaccinations: []Vaccination{},
+		Medications:  []Medication{},
+		Allergies:    []Allergy{},
+		VisitNotes:   []VisitNote{},
+	}
+}
+
+// LatestVaccinations keeps only the most recently given vaccination of each vaccine,
+// since an older one's due date is superseded by the booster, ordered by vaccine.
+func (record MedicalRecord) LatestVaccinations() []Vaccination {
+	latest := make(map[string]Vaccination)
+
+	for _, vaccination := range record.Vaccinations {
+		if current, ok := latest[vaccination.Vaccine]; !ok || vaccination.DateGiven >= current.DateGiven {
+			latest[vaccination.Vaccine] = vaccination
+		}
+	}
+
+	result := []Vaccination{}
+
+	for _, vaccination := range latest {
+		result = append(result, vaccination)
+	}
+
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Vaccine < result[j].Vaccine
+	})
+
+	return result
+}
+
+func NewMedicalCollection() MedicalCollection {
+	return MedicalCollection{Records: make(map[string]MedicalRecord)}
+}
+
+type MedicalStore interface {
+	MedicalRecordOf(petID string) (MedicalRecord, error)
+	UpdateMedicalRecord(petID string, update func(record MedicalRecord) (MedicalRecord, error)) (MedicalRecord, error)
+	AllMedicalRecords() map[string]MedicalRecord
+}
+
+func (record MedicalRecord) Validate() error {
+	for _, vaccination := range record.Vaccinations {
+		if len(vaccination.Vaccine) == 0 {
+			return fmt.Errorf("%w: vaccination needs a vaccine", ErrInvalidMedicalRecord)
+		}
+
+		if len(vaccination.DateGiven) == 0 {
+			return fmt.Errorf("%w: vaccination needs date_given", ErrInvalidMedicalRecord)
+		}
+
+		if err := validateDates(vaccination.DateGiven, vaccination.DueDate); err != nil {
+			return err
+		}
+	}
+
+	for _, medication := range record.Medications {
+		if len(medication.Name) == 0 {
+			return fmt.Errorf("%w: medication needs a name", ErrInvalidMedicalRecord)
+		}
+
+		if err := validateDates(medication.StartDate, medication.EndDate); err != nil {
+			return err
+		}
+	}
+
+	for _, allergy := range record.Allergies {
+		if len(allergy.Allergen) == 0 {
+			return fmt.Errorf("%w: allergy needs an allergen", ErrInvalidMedicalRecord)
+		}
+	}
+
+	for _, visitNote := range record.VisitNotes {
+		if len(visitNote.Date) == 0 {
+			return fmt.Errorf("%w: visit note needs a date", ErrInvalidMedicalRecord)
+		}
+
+		if err := validateDates(visitNote.Date); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateDates(dates ...string) error {
+	for _, date := range dates {
+		if len(date) == 0 {
+			continue
+		}
+
+		if _, err := time.Parse(BirthDateLayout, date); err != nil {
+			return fmt.Errorf("%w: %q does not look like %s", ErrInvalidMedicalRecord, date, BirthDateLayout)
+		}
+	}
+
+	return nil
+}
+
+// assignIDs gives every entry that does not yet have an ID a new one.
+func (record MedicalRecord) assignIDs() MedicalRecord {
+	for index := range record.Vaccinations {
+		if len(record.Vaccinations[index].ID) == 0 {
+			record.Vaccinations[index].ID = NewID()
+		}
+	}
+
+	for index := range record.Medications {
+		if len(record.Medications[index].ID) == 0 {
+			record.Medications[index].ID = NewID()
+		}
+	}
+
+	for index := range record.Allergies {
+		if len(record.Allergies[index].ID) == 0 {
+			record.Allergies[index].ID = NewID()
+		}
+	}
+
+	for index := range record.VisitNotes {
+		if len(record.VisitNotes[index].ID) == 0 {
+			record.VisitNotes[index].ID = NewID()
+		}
+	}
+
+	return record
+}
+
+// copy returns a record that shares no slices with record.
+func (record MedicalRecord) copy() MedicalRecord {
+	return MedicalRecord{
+		Vaccinations: append([]Vaccination{}, record.Vaccinations...),
+		Medications:  append([]Medication{}, record.Medications...),
+		Allergies:    append([]Allergy{}, record.Allergies...),
+		VisitNotes:   append([]VisitNote{}, record.VisitNotes...),
+	}
+}
+
+// MedicalRecordOf returns the pet's medical record, which is empty for a pet that has
+// none yet.
+func (store *dataStore) MedicalRecordOf(petID string) (MedicalRecord, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return MedicalRecord{}, ErrPetNotFound
+	}
+
+	record, ok := store.medicalCollection.Records[petID]
+
+	if !ok {
+		return NewMedicalRecord(), nil
+	}
+
+	return record.copy(), nil
+}
+
+// UpdateMedicalRecord applies update to a copy of the pet's medical record and keeps
+// the result only if update succeeds and the result is valid.
+func (store *dataStore) UpdateMedicalRecord(petID string, update func(record MedicalRecord) (MedicalRecord, error)) (MedicalRecord, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return MedicalRecord{}, ErrPetNotFound
+	}
+
+	record, ok := store.medicalCollection.Records[petID]
+
+	if !ok {
+		record = NewMedicalRecord()
+	}
+
+	updatedRecord, err := update(record.copy())
+
+	if err != nil {
+		return MedicalRecord{}, err
+	}
+
+	if err := updatedRecord.Validate(); err != nil {
+		return MedicalRecord{}, err
+	}
+
+	updatedRecord = updatedRecord.copy().assignIDs()
+	store.medicalCollection.Records[petID] = updatedRecord
+
+	return updatedRecord.copy(), nil
+}
+
+func (store *dataStore) AllMedicalRecords() map[string]MedicalRecord {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	result := make(map[string]MedicalRecord, len(store.medicalCollection.Records))
+
+	for petID, record := range store.medicalCollection.Records {
+		result[petID] = record.copy()
+	}
+
+	return result
+}
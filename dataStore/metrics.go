@@ -0,0 +1,55 @@
+package dataStore
+
+import (
+	"petServer/metrics"
+	"time"
+)
+
+// storeBuckets suit loading and storing the data files, in seconds.
+var storeBuckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5}
+
+// Instrument returns store measured in registry: how long loading and storing take,
+// how often they fail, and how many pets there are.
+func Instrument(store DataStore, registry *metrics.Registry) DataStore {
+	instrumented := &instrumentedStore{
+		DataStore: store,
+		durations: registry.NewHistogram("petserver_store_operation_duration_seconds", "How long loading and storing the data files took.", storeBuckets, "operation"),
+		failures:  registry.NewCounter("petserver_store_operation_failures_total", "How often loading or storing the data files failed.", "operation"),
+	}
+
+	registry.NewGaugeFunc("petserver_pets", "Number of pets in the store.", func() float64 {
+		return float64(len(store.AllPets().Collection))
+	})
+
+	return instrumented
+}
+
+type instrumentedStore struct {
+	DataStore
+	durations *metrics.Histogram
+	failures  *metrics.Counter
+}
+
+func (store *instrumentedStore) Load() error {
+	return store.measure("load", store.DataStore.Load)
+}
+
+func (store *instrumentedStore) Store() error {
+	return store.measure("store", store.DataStore.Store)
+}
+
+func (store *instrumentedStore) measure(operation string, run func() error) error {
+	start := time.Now()
+	err := run()
+
+	store.durations.Observe(time.Since(start).Seconds(), operation)
+
+	if err != nil {
+		store.failures.Inc(operation)
+	} else {
+		// Failures start at zero rather than appearing with the first one.
+		store.failures.Add(0, operation)
+	}
+
+	return err
+}
@@ -0,0 +1,25 @@
+package dataStore
+
+// migratePetsCollection converts pets files written before pets had IDs, where the
+// collection was keyed by name. Any pet without an ID is given one and re-keyed,
+// keeping its old key as its name. It reports whether any pet was given an ID, in which
+// case the result must be written back before the IDs are handed out.
+func migratePetsCollection(petsCollection PetsCollection) (PetsCollection, bool) {
+	result := NewPetsCollection()
+	migrated := false
+
+	for key, pet := range petsCollection.Collection {
+		if len(pet.ID) == 0 {
+			if len(pet.Name) == 0 {
+				pet.Name = key
+			}
+
+			pet.ID = NewID()
+			migrated = true
+		}
+
+		result.Collection[pet.ID] = pet
+	}
+
+	return result, migrated
+}
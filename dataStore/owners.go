@@ -0,0 +1,274 @@
+package dataStore
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+)
+
+const PrimaryOwnerRole = "primary"
+const SecondaryOwnerRole = "secondary"
+const EmergencyContactRole = "emergency_contact"
+
+var ErrOwnerNotFound = errors.New("owner not found")
+var ErrPrimaryOwnerExists = errors.New("pet already has a primary owner")
+var ErrPetHasOwners = errors.New("pet is still linked to owners")
+
+// ErrInvalidOwner wraps every validation failure for owners and their links.
+var ErrInvalidOwner = errors.New("invalid owner")
+
+// PetRemovalPolicy decides what RemovePet does with records that refer to the pet.
+type PetRemovalPolicy int
+
+const (
+	// CascadePetRemoval removes everything that refers to the pet along with it.
+	CascadePetRemoval PetRemovalPolicy = iota
+	// BlockPetRemoval refuses to remove a pet that still has owners.
+	BlockPetRemoval
+)
+
+type Owner struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+type PetOwnerLink struct {
+	PetID   string `json:"pet_id"`
+	OwnerID string `json:"owner_id"`
+	Role    string `json:"role"`
+}
+
+// OwnerOfPet is an owner together with the role they have for a particular pet.
+type OwnerOfPet struct {
+	Owner Owner  `json:"owner"`
+	Role  string `json:"role"`
+}
+
+type OwnersCollection struct {
+	Owners map[string]Owner `json:"owners"`
+	Links  []PetOwnerLink   `json:"links"`
+}
+
+func NewOwnersCollection() OwnersCollection {
+	return OwnersCollection{Owners: make(map[string]Owner), Links: []PetOwnerLink{}}
+}
+
+type OwnerStore interface {
+	AddOwner(owner Owner) (Owner, error)
+	UpdateOwner(owner Owner) (Owner, error)
+	RemoveOwner(id string) error
+	AllOwners() map[string]Owner
+	OwnerByID(id string) (Owner, error)
+	LinkPetOwner(petID string, ownerID string, role string) error
+	UnlinkPetOwner(petID string, ownerID string) error
+	OwnersOfPet(petID string) []OwnerOfPet
+	PetsOfOwner(ownerID string) (PetsCollection, error)
+	SetPetRemovalPolicy(policy PetRemovalPolicy)
+}
+
+// Validate checks the owner can be stored. The email, when given, must be a bare
+// address such as pat@example.com, as reminders are mailed to it.
+func (owner Owner) Validate() error {
+	if len(owner.Name) == 0 {
+		return fmt.Errorf("%w: name may not be empty", ErrInvalidOwner)
+	}
+
+	if len(owner.Email) > 0 {
+		if address, err := mail.ParseAddress(owner.Email); err != nil || address.Address != owner.Email {
+			return fmt.Errorf("%w: email must be an address such as pat@example.com, not %q", ErrInvalidOwner, owner.Email)
+		}
+	}
+
+	return nil
+}
+
+func validOwnerRole(role string) bool {
+	return role == PrimaryOwnerRole || role == SecondaryOwnerRole || role == EmergencyContactRole
+}
+
+func (store *dataStore) SetPetRemovalPolicy(policy PetRemovalPolicy) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.petRemovalPolicy = policy
+}
+
+func (store *dataStore) AddOwner(owner Owner) (Owner, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := owner.Validate(); err != nil {
+		return Owner{}, err
+	}
+
+	owner.ID = NewID()
+	store.ownersCollection.Owners[owner.ID] = owner
+
+	return owner, nil
+}
+
+func (store *dataStore) UpdateOwner(owner Owner) (Owner, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.ownersCollection.Owners[owner.ID]; !ok {
+		return Owner{}, ErrOwnerNotFound
+	}
+
+	if err := owner.Validate(); err != nil {
+		return Owner{}, err
+	}
+
+	store.ownersCollection.Owners[owner.ID] = owner
+
+	return owner, nil
+}
+
+// RemoveOwner deletes the owner along with all of their links to pets.
+func (store *dataStore) RemoveOwner(id string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.ownersCollection.Owners[id]; !ok {
+		return ErrOwnerNotFound
+	}
+
+	delete(store.ownersCollection.Owners, id)
+
+	store.ownersCollection.Links = filterLinks(store.ownersCollection.Links, func(link PetOwnerLink) bool {
+		return link.OwnerID != id
+	})
+
+	return nil
+}
+
+func (store *dataStore) AllOwners() map[string]Owner {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	result := make(map[string]Owner, len(store.ownersCollection.Owners))
+
+	for id, owner := range store.ownersCollection.Owners {
+		result[id] = owner
+	}
+
+	return result
+}
+
+func (store *dataStore) OwnerByID(id string) (Owner, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	owner, ok := store.ownersCollection.Owners[id]
+
+	if !ok {
+		return Owner{}, ErrOwnerNotFound
+	}
+
+	return owner, nil
+}
+
+// LinkPetOwner links a pet to an owner in the given role, replacing the role of an
+// existing link between them. A pet can have only one primary owner.
+func (store *dataStore) LinkPetOwner(petID string, ownerID string, role string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return ErrPetNotFound
+	}
+
+	if _, ok := store.ownersCollection.Owners[ownerID]; !ok {
+		return ErrOwnerNotFound
+	}
+
+	if !validOwnerRole(role) {
+		return fmt.Errorf("%w: role must be %s, %s or %s, not %q", ErrInvalidOwner, PrimaryOwnerRole, SecondaryOwnerRole, EmergencyContactRole, role)
+	}
+
+	for _, link := range store.ownersCollection.Links {
+		if role == PrimaryOwnerRole && link.PetID == petID && link.OwnerID != ownerID && link.Role == PrimaryOwnerRole {
+			return ErrPrimaryOwnerExists
+		}
+	}
+
+	links := filterLinks(store.ownersCollection.Links, func(link PetOwnerLink) bool {
+		return link.PetID != petID || link.OwnerID != ownerID
+	})
+
+	store.ownersCollection.Links = append(links, PetOwnerLink{PetID: petID, OwnerID: ownerID, Role: role})
+
+	return nil
+}
+
+func (store *dataStore) UnlinkPetOwner(petID string, ownerID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	links := filterLinks(store.ownersCollection.Links, func(link PetOwnerLink) bool {
+		return link.PetID != petID || link.OwnerID != ownerID
+	})
+
+	if len(links) == len(store.ownersCollection.Links) {
+		return ErrOwnerNotFound
+	}
+
+	store.ownersCollection.Links = links
+
+	return nil
+}
+
+// OwnersOfPet returns the pet's owners, primary owner first.
+func (store *dataStore) OwnersOfPet(petID string) []OwnerOfPet {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	result := []OwnerOfPet{}
+
+	for _, link := range store.ownersCollection.Links {
+		if link.PetID == petID {
+			result = append(result, OwnerOfPet{Owner: store.ownersCollection.Owners[link.OwnerID], Role: link.Role})
+		}
+	}
+
+	sort.SliceStable(result, func(i int, j int) bool {
+		return result[i].Role == PrimaryOwnerRole && result[j].Role != PrimaryOwnerRole
+	})
+
+	return result
+}
+
+func (store *dataStore) PetsOfOwner(ownerID string) (PetsCollection, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.ownersCollection.Owners[ownerID]; !ok {
+		return PetsCollection{}, ErrOwnerNotFound
+	}
+
+	result := NewPetsCollection()
+
+	for _, link := range store.ownersCollection.Links {
+		if pet, ok := store.petsCollection.Collection[link.PetID]; link.OwnerID == ownerID && ok {
+			result.Collection[pet.ID] = pet
+		}
+	}
+
+	return result.copyForReading(), nil
+}
+
+func filterLinks(links []PetOwnerLink, keep func(link PetOwnerLink) bool) []PetOwnerLink {
+	result := []PetOwnerLink{}
+
+	for _, link := range links {
+		if keep(link) {
+			result = append(result, link)
+		}
+	}
+
+	return result
+}
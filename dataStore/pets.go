@@ -1,16 +1,128 @@
 package dataStore
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const BirthDateLayout = "2006-01-02"
+
+var ErrMicrochipExists = errors.New("microchip number already belongs to another pet")
+
+// ErrInvalidPet wraps every validation failure reported by Pet.Validate.
+var ErrInvalidPet = errors.New("invalid pet")
+
 func NewPetsCollection() PetsCollection {
 	petsCollection := PetsCollection{}
 	petsCollection.Collection = make(map[string]Pet)
 	return petsCollection
 }
 
+// Pet is a single animal. When BirthDate is set, Age is derived from it whenever the
+// pet is read from the store; otherwise Age is whatever was last stored.
 type Pet struct {
-	Age   int    `json:"age"`
-	Breed string `json:"breed"`
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Age       int     `json:"age"`
+	Breed     string  `json:"breed"`
+	Species   string  `json:"species,omitempty"`
+	Sex       string  `json:"sex,omitempty"`
+	Neutered  bool    `json:"neutered,omitempty"`
+	BirthDate string  `json:"birth_date,omitempty"`
+	WeightKg  float64 `json:"weight_kg,omitempty"`
+	Color     string  `json:"color,omitempty"`
+	Markings  string  `json:"markings,omitempty"`
+	Microchip string  `json:"microchip,omitempty"`
+	Notes     string  `json:"notes,omitempty"`
 }
 
+// PetsCollection holds pets keyed by their ID.
 type PetsCollection struct {
 	Collection map[string]Pet `json:"pets_collection"`
 }
+
+func (pet Pet) Validate() error {
+	if len(pet.Name) == 0 {
+		return fmt.Errorf("%w: name may not be empty", ErrInvalidPet)
+	}
+
+	switch pet.Sex {
+	case "", "male", "female", "unknown":
+	default:
+		return fmt.Errorf("%w: sex must be male, female or unknown, not %q", ErrInvalidPet, pet.Sex)
+	}
+
+	if pet.Age < 0 {
+		return fmt.Errorf("%w: age may not be negative", ErrInvalidPet)
+	}
+
+	if pet.WeightKg < 0 {
+		return fmt.Errorf("%w: weight may not be negative", ErrInvalidPet)
+	}
+
+	if len(pet.BirthDate) > 0 {
+		birthDate, err := time.Parse(BirthDateLayout, pet.BirthDate)
+
+		if err != nil {
+			return fmt.Errorf("%w: birth_date must look like %s", ErrInvalidPet, BirthDateLayout)
+		}
+
+		if birthDate.After(time.Now()) {
+			return fmt.Errorf("%w: birth_date may not be in the future", ErrInvalidPet)
+		}
+	}
+
+	return nil
+}
+
+// AgeOn returns the pet's age in whole years on the given day.
+func (pet Pet) AgeOn(now time.Time) int {
+	birthDate, err := time.Parse(BirthDateLayout, pet.BirthDate)
+
+	if err != nil {
+		return pet.Age
+	}
+
+	age := now.Year() - birthDate.Year()
+
+	if now.Month() < birthDate.Month() || (now.Month() == birthDate.Month() && now.Day() < birthDate.Day()) {
+		age--
+	}
+
+	if age < 0 {
+		return 0
+	}
+
+	return age
+}
+
+// idsNamed returns the IDs of the pets called name, oldest first.
+func (petsCollection PetsCollection) idsNamed(name string) []string {
+	ids := []string{}
+
+	for id, pet := range petsCollection.Collection {
+		if pet.Name == name {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// copyForReading returns a copy of the collection, safe to use outside the store lock,
+// with ages brought up to date.
+func (petsCollection PetsCollection) copyForReading() PetsCollection {
+	result := NewPetsCollection()
+	now := time.Now()
+
+	for id, pet := range petsCollection.Collection {
+		pet.Age = pet.AgeOn(now)
+		result.Collection[id] = pet
+	}
+
+	return result
+}
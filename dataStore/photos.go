@@ -0,0 +1,258 @@
+package dataStore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxPhotoPixels bounds the size of the photos AddPhoto is willing to decode.
+const MaxPhotoPixels = 50 * 1000 * 1000
+
+var ErrPhotoNotFound = errors.New("photo not found")
+
+// ErrUnsupportedPhoto is returned for uploads that are not JPEG, PNG or GIF images.
+var ErrUnsupportedPhoto = errors.New("photos must be JPEG, PNG or GIF images")
+
+// ErrInvalidPhoto wraps every reason a JPEG, PNG or GIF upload cannot be used.
+var ErrInvalidPhoto = errors.New("invalid photo")
+
+// Photo describes an uploaded image. Its ID is the SHA-256 of the image, which is
+// also the name of the file holding it, so a pet uploading the same photo twice, or
+// two pets sharing one, keep a single copy.
+type Photo struct {
+	ID                   string    `json:"id"`
+	ContentType          string    `json:"content_type"`
+	Size                 int       `json:"size"`
+	Width                int       `json:"width"`
+	Height               int       `json:"height"`
+	ThumbnailContentType string    `json:"thumbnail_content_type"`
+	UploadedAt           time.Time `json:"uploaded_at"`
+}
+
+// PhotosCollection holds each pet's photos, keyed by pet ID, in upload order.
+type PhotosCollection struct {
+	Photos map[string][]Photo `json:"photos"`
+}
+
+func NewPhotosCollection() PhotosCollection {
+	return PhotosCollection{Photos: make(map[string][]Photo)}
+}
+
+type PhotoStore interface {
+	AddPhoto(petID string, data []byte) (Photo, error)
+	RemovePhoto(petID string, photoID string) error
+	PhotosOf(petID string) ([]Photo, error)
+	PhotoFile(petID string, photoID string, thumbnail bool) (string, string, error)
+}
+
+// photoDirectory is where the photos of the pets in filePath are kept, so
+// "/data/pets.json" keeps its photos in "/data/pets.photos".
+func photoDirectory(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".photos"
+}
+
+// AddPhoto checks that data is a JPEG, PNG or GIF image, stores it with a thumbnail and
+// adds it to the pet's photos. Adding a photo the pet already has changes nothing.
+func (store *dataStore) AddPhoto(petID string, data []byte) (Photo, error) {
+	contentType := http.DetectContentType(data)
+
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return Photo{}, ErrUnsupportedPhoto
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return Photo{}, fmt.Errorf("%w: %v", ErrInvalidPhoto, err)
+	}
+
+	if config.Width*config.Height > MaxPhotoPixels {
+		return Photo{}, fmt.Errorf("%w: %dx%d is more than %d pixels", ErrInvalidPhoto, config.Width, config.Height, MaxPhotoPixels)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return Photo{}, fmt.Errorf("%w: %v", ErrInvalidPhoto, err)
+	}
+
+	thumbnailData, thumbnailContentType, err := encodeThumbnail(thumbnail(decoded), contentType)
+
+	if err != nil {
+		return Photo{}, err
+	}
+
+	hash := sha256.Sum256(data)
+
+	photo := Photo{
+		ID:                   hex.EncodeToString(hash[:]),
+		ContentType:          contentType,
+		Size:                 len(data),
+		Width:                config.Width,
+		Height:               config.Height,
+		ThumbnailContentType: thumbnailContentType,
+		UploadedAt:           time.Now().UTC(),
+	}
+
+	// The files are written while holding the lock so that removing another pet cannot
+	// delete them as orphans before the photo is recorded.
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return Photo{}, ErrPetNotFound
+	}
+
+	for _, existingPhoto := range store.photosCollection.Photos[petID] {
+		if existingPhoto.ID == photo.ID {
+			return existingPhoto, nil
+		}
+	}
+
+	if err := writePhotoFile(store.photoFilePath(photo.ID, false), data); err != nil {
+		return Photo{}, err
+	}
+
+	if err := writePhotoFile(store.photoFilePath(photo.ID, true), thumbnailData); err != nil {
+		return Photo{}, err
+	}
+
+	store.photosCollection.Photos[petID] = append(store.photosCollection.Photos[petID], photo)
+
+	return photo, nil
+}
+
+// RemovePhoto takes the photo away from the pet, deleting its files unless another pet
+// has the same photo.
+func (store *dataStore) RemovePhoto(petID string, photoID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return ErrPetNotFound
+	}
+
+	photos := []Photo{}
+
+	for _, photo := range store.photosCollection.Photos[petID] {
+		if photo.ID != photoID {
+			photos = append(photos, photo)
+		}
+	}
+
+	if len(photos) == len(store.photosCollection.Photos[petID]) {
+		return ErrPhotoNotFound
+	}
+
+	if len(photos) == 0 {
+		delete(store.photosCollection.Photos, petID)
+	} else {
+		store.photosCollection.Photos[petID] = photos
+	}
+
+	store.removeOrphanedPhotos([]string{photoID})
+
+	return nil
+}
+
+func (store *dataStore) PhotosOf(petID string) ([]Photo, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return nil, ErrPetNotFound
+	}
+
+	return append([]Photo{}, store.photosCollection.Photos[petID]...), nil
+}
+
+// PhotoFile returns the path of the file holding one of the pet's photos, or its
+// thumbnail, along with the file's content type.
+func (store *dataStore) PhotoFile(petID string, photoID string, thumbnail bool) (string, string, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	if _, ok := store.petsCollection.Collection[petID]; !ok {
+		return "", "", ErrPetNotFound
+	}
+
+	for _, photo := range store.photosCollection.Photos[petID] {
+		if photo.ID == photoID {
+			if thumbnail {
+				return store.photoFilePath(photoID, true), photo.ThumbnailContentType, nil
+			}
+
+			return store.photoFilePath(photoID, false), photo.ContentType, nil
+		}
+	}
+
+	return "", "", ErrPhotoNotFound
+}
+
+func (store *dataStore) photoFilePath(photoID string, thumbnail bool) string {
+	if thumbnail {
+		return filepath.Join(store.photoDirectory, photoID+".thumbnail")
+	}
+
+	return filepath.Join(store.photoDirectory, photoID)
+}
+
+// removeOrphanedPhotos deletes the files of those of photoIDs that no pet has any more.
+// The caller must hold the store lock.
+func (store *dataStore) removeOrphanedPhotos(photoIDs []string) {
+	for _, photoID := range photoIDs {
+		if store.photoInUse(photoID) {
+			continue
+		}
+
+		_ = os.Remove(store.photoFilePath(photoID, false))
+		_ = os.Remove(store.photoFilePath(photoID, true))
+	}
+}
+
+func (store *dataStore) photoInUse(photoID string) bool {
+	for _, photos := range store.photosCollection.Photos {
+		for _, photo := range photos {
+			if photo.ID == photoID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// writePhotoFile writes data to filePath unless the file is already there, which,
+// since photos are named after their content, means it already holds data.
+func writePhotoFile(filePath string, data []byte) error {
+	if _, err := os.Stat(filePath); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	temporaryFilePath := filePath + ".tmp"
+
+	if err := ioutil.WriteFile(temporaryFilePath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryFilePath, filePath)
+}
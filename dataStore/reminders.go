@@ -0,0 +1,36 @@
+package dataStore
+
+import (
+	"time"
+)
+
+// SentRemindersCollection records which reminders have gone out, keyed by a string
+// chosen by whoever sends them, so they are not repeated after a restart.
+type SentRemindersCollection struct {
+	Sent map[string]time.Time `json:"sent_reminders"`
+}
+
+func NewSentRemindersCollection() SentRemindersCollection {
+	return SentRemindersCollection{Sent: make(map[string]time.Time)}
+}
+
+type ReminderStore interface {
+	ReminderSent(key string) bool
+	MarkReminderSent(key string, sentAt time.Time)
+}
+
+func (store *dataStore) ReminderSent(key string) bool {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
+	_, ok := store.sentReminders.Sent[key]
+
+	return ok
+}
+
+func (store *dataStore) MarkReminderSent(key string, sentAt time.Time) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.sentReminders.Sent[key] = sentAt
+}
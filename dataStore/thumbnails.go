@@ -0,0 +1,82 @@
+package dataStore
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+)
+
+// ThumbnailSize is the longest side, in pixels, of a photo's thumbnail.
+const ThumbnailSize = 256
+
+// thumbnail scales source down to fit within ThumbnailSize by averaging the pixels
+// each thumbnail pixel covers. Images that already fit are copied as they are.
+func thumbnail(source image.Image) image.Image {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			width, height = ThumbnailSize, maxInt(1, height*ThumbnailSize/width)
+		} else {
+			width, height = maxInt(1, width*ThumbnailSize/height), ThumbnailSize
+		}
+	}
+
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := maxInt(top+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+
+		for x := 0; x < width; x++ {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := maxInt(left+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var red, green, blue, alpha, count uint64
+
+			for sourceY := top; sourceY < bottom; sourceY++ {
+				for sourceX := left; sourceX < right; sourceX++ {
+					r, g, b, a := source.At(sourceX, sourceY).RGBA()
+					red, green, blue, alpha = red+uint64(r), green+uint64(g), blue+uint64(b), alpha+uint64(a)
+					count++
+				}
+			}
+
+			result.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(red / count),
+				G: uint16(green / count),
+				B: uint16(blue / count),
+				A: uint16(alpha / count),
+			})
+		}
+	}
+
+	return result
+}
+
+// encodeThumbnail encodes a thumbnail as JPEG for JPEG photos and as PNG for the rest,
+// which may be transparent, returning the encoded image and its content type.
+func encodeThumbnail(picture image.Image, contentType string) ([]byte, string, error) {
+	var encoded bytes.Buffer
+
+	if contentType == "image/jpeg" {
+		err := jpeg.Encode(&encoded, picture, &jpeg.Options{Quality: 85})
+
+		return encoded.Bytes(), "image/jpeg", err
+	}
+
+	err := png.Encode(&encoded, picture)
+
+	return encoded.Bytes(), "image/png", err
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
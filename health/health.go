@@ -0,0 +1,166 @@
+// Package health keeps the checks that say whether the server is alive and ready to
+// serve, and runs them for the probes of an orchestrator.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Probe is what a check is asked for: whether the process works at all, or whether it
+// should be sent requests.
+type Probe int
+
+const (
+	// Liveness checks fail when the process is stuck and should be restarted.
+	Liveness Probe = iota
+	// Readiness checks fail when the process should not be sent requests for now.
+	Readiness
+)
+
+func (probe Probe) String() string {
+	switch probe {
+	case Liveness:
+		return "liveness"
+	case Readiness:
+		return "readiness"
+	default:
+		return fmt.Sprintf("probe %d", int(probe))
+	}
+}
+
+// Checker returns an error saying what is wrong, or nil when all is well. It should
+// give up once ctx is done.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (checker CheckerFunc) Check(ctx context.Context) error {
+	return checker(ctx)
+}
+
+// Statuses of a Report and of each Result in it.
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Report is what running the checks for a probe found.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+func (report Report) OK() bool {
+	return report.Status == StatusOK
+}
+
+// Result is what one check found.
+type Result struct {
+	Name     string `json:"name"`
+	Probe    string `json:"probe"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type check struct {
+	name    string
+	probe   Probe
+	checker Checker
+}
+
+// Registry holds the checks subsystems register.
+type Registry struct {
+	checks []check
+	lock   sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds checker to the checks run for probe, or panics if a check for probe
+// already has name, which is a mistake in the program rather than something to handle.
+func (registry *Registry) Register(probe Probe, name string, checker Checker) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, check := range registry.checks {
+		if check.probe == probe && check.name == name {
+			panic(fmt.Sprintf("%s check %s is already registered", probe, name))
+		}
+	}
+
+	registry.checks = append(registry.checks, check{name: name, probe: probe, checker: checker})
+}
+
+// Run runs the checks for probes at the same time and reports on them, sorted by name.
+// The report is failing when any check fails, or has not finished when ctx is done.
+func (registry *Registry) Run(ctx context.Context, probes ...Probe) Report {
+	registry.lock.Lock()
+	checks := []check{}
+
+	for _, check := range registry.checks {
+		for _, probe := range probes {
+			if check.probe == probe {
+				checks = append(checks, check)
+			}
+		}
+	}
+
+	registry.lock.Unlock()
+
+	results := make([]Result, len(checks))
+	finished := make([]chan struct{}, len(checks))
+
+	for index, registered := range checks {
+		results[index] = Result{Name: registered.name, Probe: registered.probe.String()}
+		finished[index] = make(chan struct{})
+
+		go func(result *Result, checker Checker, finished chan struct{}) {
+			defer close(finished)
+
+			start := time.Now()
+			err := checker.Check(ctx)
+
+			result.Duration = time.Since(start).String()
+			result.Status = StatusOK
+
+			if err != nil {
+				result.Status, result.Error = StatusFailing, err.Error()
+			}
+		}(&results[index], registered.checker, finished[index])
+	}
+
+	report := Report{Status: StatusOK, Checks: make([]Result, 0, len(checks))}
+
+	for index := range checks {
+		var result Result
+
+		select {
+		case <-finished[index]:
+			result = results[index]
+		case <-ctx.Done():
+			// A check that ignores ctx keeps running, but is reported without waiting for it.
+			result = Result{Name: checks[index].name, Probe: checks[index].probe.String(), Status: StatusFailing, Error: fmt.Sprintf("did not finish: %v", ctx.Err())}
+		}
+
+		if result.Status != StatusOK {
+			report.Status = StatusFailing
+		}
+
+		report.Checks = append(report.Checks, result)
+	}
+
+	sort.SliceStable(report.Checks, func(i int, j int) bool {
+		return report.Checks[i].Name < report.Checks[j].Name
+	})
+
+	return report
+}
@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunningChecks(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Readiness, "store", CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}))
+	registry.Register(Readiness, "draining", CheckerFunc(func(ctx context.Context) error {
+		return errors.New("shutting down")
+	}))
+	registry.Register(Liveness, "scheduler", CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}))
+
+	report := registry.Run(context.Background(), Liveness)
+
+	if !report.OK() || len(report.Checks) != 1 || report.Checks[0].Name != "scheduler" || report.Checks[0].Probe != "liveness" {
+		t.Errorf("expected only the passing liveness check, got %+v", report)
+	}
+
+	report = registry.Run(context.Background(), Liveness, Readiness)
+
+	if report.OK() || len(report.Checks) != 3 {
+		t.Fatalf("expected all three checks and a failing report, got %+v", report)
+	}
+
+	if report.Checks[0].Name != "draining" || report.Checks[0].Status != StatusFailing || report.Checks[0].Error != "shutting down" {
+		t.Errorf("expected the draining check to fail first, got %+v", report.Checks[0])
+	}
+
+	if report.Checks[2].Name != "store" || report.Checks[2].Status != StatusOK || len(report.Checks[2].Duration) == 0 {
+		t.Errorf("expected the store check to pass and be timed, got %+v", report.Checks[2])
+	}
+
+	if report := NewRegistry().Run(context.Background(), Readiness); !report.OK() || len(report.Checks) != 0 {
+		t.Errorf("expected no checks to be ok, got %+v", report)
+	}
+}
+
+func TestChecksThatDoNotFinish(t *testing.T) {
+	registry := NewRegistry()
+	stuck := make(chan struct{})
+
+	defer close(stuck)
+
+	registry.Register(Liveness, "stuck", CheckerFunc(func(ctx context.Context) error {
+		<-stuck
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	report := registry.Run(ctx, Liveness)
+
+	if report.OK() || report.Checks[0].Status != StatusFailing || len(report.Checks[0].Error) == 0 {
+		t.Errorf("expected a check that does not finish in time to fail, got %+v", report)
+	}
+}
+
+func TestRegisteringTwiceIsAMistake(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Readiness, "store", CheckerFunc(func(ctx context.Context) error { return nil }))
+	registry.Register(Liveness, "store", CheckerFunc(func(ctx context.Context) error { return nil }))
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a check for a probe twice to panic")
+		}
+	}()
+
+	registry.Register(Readiness, "store", CheckerFunc(func(ctx context.Context) error { return nil }))
+}
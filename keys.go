@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"petServer/auth"
+	"text/tabwriter"
+)
+
+const keysUsage = `usage:
+  petServer keys create -name NAME -role reader|editor|admin
+  petServer keys list
+  petServer keys revoke ID`
+
+// runKeysCommand manages the API keys in the key file at filePath, writing what it did
+// to output.
+func runKeysCommand(arguments []string, filePath string, output io.Writer) error {
+	if len(arguments) == 0 {
+		return fmt.Errorf("%s", keysUsage)
+	}
+
+	store, err := auth.NewKeyStore(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	switch arguments[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		flags.SetOutput(output)
+		name := flags.String("name", "", "who or what the key is for")
+		roleText := flags.String("role", string(auth.Reader), "reader, editor or admin")
+
+		if err := flags.Parse(arguments[1:]); err != nil {
+			return err
+		}
+
+		role, err := auth.ParseRole(*roleText)
+
+		if err != nil {
+			return err
+		}
+
+		key, apiKey, err := store.Create(*name, role)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(output, "created key %s for %s with role %s; it will not be shown again:\n%s\n", apiKey.ID, apiKey.Name, apiKey.Role, key)
+
+		return err
+	case "list":
+		keys, err := store.Keys()
+
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "ID\tNAME\tROLE\tCREATED")
+
+		for _, apiKey := range keys {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", apiKey.ID, apiKey.Name, apiKey.Role, apiKey.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+
+		return writer.Flush()
+	case "revoke":
+		if len(arguments) != 2 {
+			return fmt.Errorf("%s", keysUsage)
+		}
+
+		if err := store.Revoke(arguments[1]); err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(output, "revoked key %s\n", arguments[1])
+
+		return err
+	default:
+		return fmt.Errorf("unknown keys command %q\n%s", arguments[0], keysUsage)
+	}
+}
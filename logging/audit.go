@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrAuditLogTampered = errors.New("audit log was tampered with")
+
+// AuditEntry is one change recorded in an audit log. Each entry carries the hash of the
+// one before it and its own hash over everything else in it, so that changing,
+// removing or reordering entries breaks the chain from there on.
+type AuditEntry struct {
+	Sequence  uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	PetID     string    `json:"pet_id,omitempty"`
+	PetName   string    `json:"pet_name,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Previous  string    `json:"prev"`
+	Hash      string    `json:"hash"`
+}
+
+// hash is the SHA-256 of the entry as JSON without its hash.
+func (entry AuditEntry) hash() (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditLog appends entries, one JSON line each, to a file that is never rotated, as
+// removing old files would break the chain.
+type AuditLog struct {
+	file     *os.File
+	sequence uint64
+	last     string
+	now      func() time.Time
+	lock     sync.Mutex
+}
+
+// OpenAuditLog appends to the audit log in filePath, carrying on the chain of the
+// entries already in it, and refuses with ErrAuditLogTampered to carry on a chain that
+// is broken.
+func OpenAuditLog(filePath string) (*AuditLog, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := VerifyAuditLog(file)
+
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	return &AuditLog{file: file, sequence: last.Sequence, last: last.Hash, now: time.Now}, nil
+}
+
+// Record completes entry with its sequence number, time and hashes and appends it,
+// making sure it is on disk before returning.
+func (auditLog *AuditLog) Record(entry AuditEntry) error {
+	auditLog.lock.Lock()
+	defer auditLog.lock.Unlock()
+
+	if auditLog.file == nil {
+		return os.ErrClosed
+	}
+
+	entry.Sequence = auditLog.sequence + 1
+	entry.Time = auditLog.now().UTC()
+	entry.Previous = auditLog.last
+
+	hash, err := entry.hash()
+
+	if err != nil {
+		return err
+	}
+
+	entry.Hash = hash
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := auditLog.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if err := auditLog.file.Sync(); err != nil {
+		return err
+	}
+
+	auditLog.sequence, auditLog.last = entry.Sequence, entry.Hash
+
+	return nil
+}
+
+func (auditLog *AuditLog) Close() error {
+	auditLog.lock.Lock()
+	defer auditLog.lock.Unlock()
+
+	if auditLog.file == nil {
+		return nil
+	}
+
+	err := auditLog.file.Close()
+	auditLog.file = nil
+
+	return err
+}
+
+// VerifyAuditLog checks the chain of the audit log read from input, returning its last
+// entry, or an error wrapping ErrAuditLogTampered that names the first entry that does
+// not fit. Entries cut off the end leave a chain that still fits, which only comparing
+// the last entry with one noted down before can tell.
+func VerifyAuditLog(input io.Reader) (AuditEntry, error) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	last := AuditEntry{}
+
+	for line := 1; scanner.Scan(); line++ {
+		var entry AuditEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return last, fmt.Errorf("%w: line %d is not an entry: %v", ErrAuditLogTampered, line, err)
+		}
+
+		hash, err := entry.hash()
+
+		if err != nil {
+			return last, err
+		}
+
+		switch {
+		case entry.Sequence != last.Sequence+1:
+			return last, fmt.Errorf("%w: line %d has sequence number %d after %d", ErrAuditLogTampered, line, entry.Sequence, last.Sequence)
+		case entry.Previous != last.Hash:
+			return last, fmt.Errorf("%w: line %d does not follow the entry before it", ErrAuditLogTampered, line)
+		case entry.Hash != hash:
+			return last, fmt.Errorf("%w: line %d was changed", ErrAuditLogTampered, line)
+		}
+
+		last = entry
+	}
+
+	return last, scanner.Err()
+}
@@ -0,0 +1,71 @@
+// Package logging sets up the server's structured logs: JSON lines through log/slog,
+// written to standard error or to files rotated by size and age, and an audit log of
+// changes to pets that shows whether it was tampered with.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Config says how much is logged and where to.
+type Config struct {
+	// Level is the least severe level logged: debug, info, warn or error.
+	Level string
+	// File is the file logs are written to, rotated as Rotation says; standard error when
+	// empty.
+	File     string
+	Rotation Rotation
+	// AuditFile is the file the audit log is appended to, which is never rotated; no
+	// audit log is kept when empty.
+	AuditFile string
+}
+
+// ParseLevel reads level names as slog does, such as "info" or "warn", in any case.
+func ParseLevel(text string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(text))); err != nil {
+		return level, fmt.Errorf("%q is not debug, info, warn or error", text)
+	}
+
+	return level, nil
+}
+
+// New returns a logger writing JSON lines to output, leaving out what is less severe
+// than level.
+func New(output io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(output, &slog.HandlerOptions{Level: level}))
+}
+
+// Open returns the logger config describes and what to close once nothing more will be
+// logged.
+func Open(config Config) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(config.Level)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(config.File) == 0 {
+		return New(os.Stderr, level), nothingToClose{}, nil
+	}
+
+	file, err := OpenRotatingFile(config.File, config.Rotation)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return New(file, level), file, nil
+}
+
+// nothingToClose stands in for standard error, which stays open.
+type nothingToClose struct{}
+
+func (nothingToClose) Close() error {
+	return nil
+}
@@ -0,0 +1,282 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingJSONWithLevels(t *testing.T) {
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Errorf("expected an unknown level to be refused")
+	}
+
+	level, err := ParseLevel("WARN")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+
+	logger := New(&output, level)
+	logger.Info("left out")
+	logger.Warn("disk nearly full", "free_bytes", 1024)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	if len(lines) != 1 {
+		t.Fatalf("expected only the warning to be logged, got %q", output.String())
+	}
+
+	var record map[string]interface{}
+
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record["level"] != "WARN" || record["msg"] != "disk nearly full" || record["free_bytes"] != float64(1024) {
+		t.Errorf("expected the warning as JSON, got %v", record)
+	}
+}
+
+func TestRotatingFilesBySizeAndAge(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestRotatingFilesBySizeAndAge")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "server.log")
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	file, err := OpenRotatingFile(filePath, Rotation{MaxBytes: 10, MaxAge: time.Hour, MaxBackups: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	file.now = func() time.Time { return now }
+	file.opened = now
+
+	write := func(text string) {
+		if _, err := file.Write([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("123456")
+	write("7890")
+
+	if backups, _ := Backups(filePath); len(backups) != 0 {
+		t.Errorf("expected no rotation while the file fits, got %v", backups)
+	}
+
+	now = now.Add(time.Second)
+	write("abc")
+
+	backups, err := Backups(filePath)
+
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected a write past the size to rotate, got %v %v", backups, err)
+	}
+
+	if data, _ := ioutil.ReadFile(backups[0]); string(data) != "1234567890" {
+		t.Errorf("expected the rotated file to keep what was written, got %q", data)
+	}
+
+	now = now.Add(time.Hour)
+	write("def")
+
+	now = now.Add(time.Hour)
+	write("ghi")
+
+	if backups, _ = Backups(filePath); len(backups) != 2 {
+		t.Fatalf("expected old files to be removed beyond two, got %v", backups)
+	}
+
+	if data, _ := ioutil.ReadFile(backups[0]); string(data) != "abc" {
+		t.Errorf("expected the oldest file to be the one removed, got %q", data)
+	}
+
+	if data, _ := ioutil.ReadFile(filePath); string(data) != "ghi" {
+		t.Errorf("expected the file to be written to after rotating by age, got %q", data)
+	}
+}
+
+func TestFailedRotationKeepsAppending(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestFailedRotationKeepsAppending")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "server.log")
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	file, err := OpenRotatingFile(filePath, Rotation{MaxBytes: 4})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	file.now = func() time.Time { return now }
+
+	// A directory with something in it cannot be replaced by the rotated file.
+	blocking := filePath + "." + now.Format(backupTimeLayout)
+
+	if err := os.MkdirAll(filepath.Join(blocking, "in the way"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for index, text := range []string{"abc", "def", "ghi"} {
+		_, err := file.Write([]byte(text))
+
+		if index == 1 && err == nil {
+			t.Error("expected the first failed rotation to be reported")
+		}
+
+		if index != 1 && err != nil {
+			t.Errorf("expected write %d to succeed, got %v", index, err)
+		}
+	}
+
+	if data, _ := ioutil.ReadFile(filePath); string(data) != "abcdefghi" {
+		t.Errorf("expected writes to go on being appended, got %q", data)
+	}
+
+	if err := os.RemoveAll(blocking); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Write([]byte("jkl")); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := ioutil.ReadFile(filePath); string(data) != "jkl" {
+		t.Errorf("expected the file to be rotated once it could be, got %q", data)
+	}
+}
+
+func TestRotatingByAgeAcrossRestarts(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestRotatingByAgeAcrossRestarts")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "server.log")
+
+	if err := ioutil.WriteFile(filePath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lastWritten := time.Now().Add(-2 * time.Hour)
+
+	if err := os.Chtimes(filePath, lastWritten, lastWritten); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenRotatingFile(filePath, Rotation{MaxAge: time.Hour})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	if _, err := file.Write([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	if backups, _ := Backups(filePath); len(backups) != 1 {
+		t.Errorf("expected a file last written before MaxAge to be rotated on reopening, got %v", backups)
+	}
+}
+
+func TestAuditLogShowsTampering(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestAuditLogShowsTampering")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "audit.log")
+	auditLog, err := OpenAuditLog(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []AuditEntry{
+		{Action: "create_pet", PetID: "1", PetName: "Shasta", Actor: "alice", RequestID: "r1"},
+		{Action: "create_pet", PetID: "2", PetName: "Gracie", Actor: "alice", RequestID: "r2"},
+	} {
+		if err := auditLog.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = auditLog.Close()
+
+	// The chain carries on from the entries already in the file.
+	if auditLog, err = OpenAuditLog(filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := auditLog.Record(AuditEntry{Action: "remove_pet", PetID: "1", Actor: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = auditLog.Close()
+
+	data, err := ioutil.ReadFile(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := VerifyAuditLog(bytes.NewReader(data))
+
+	if err != nil || last.Sequence != 3 || last.Action != "remove_pet" || last.Actor != "bob" {
+		t.Fatalf("expected three entries ending with bob's removal, got %+v %v", last, err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+
+	for description, tampered := range map[string]string{
+		"an entry changed": lines[0] + strings.Replace(lines[1], "alice", "mallory", 1) + lines[2],
+		"an entry removed": lines[0] + lines[2],
+		"entries swapped":  lines[1] + lines[0] + lines[2],
+	} {
+		if _, err := VerifyAuditLog(strings.NewReader(tampered)); !errors.Is(err, ErrAuditLogTampered) {
+			t.Errorf("expected %s to be noticed, got %v", description, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(filePath, []byte(lines[0]+lines[2]), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenAuditLog(filePath); !errors.Is(err, ErrAuditLogTampered) {
+		t.Errorf("expected a broken chain not to be carried on, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeLayout names rotated files after when they were rotated, so that their
+// names sort oldest first.
+const backupTimeLayout = "20060102T150405.000000"
+
+// Rotation says when a log file is moved aside for a new one, and how many of the
+// files moved aside are kept. Zero values mean no limit.
+type Rotation struct {
+	// MaxBytes is how large a file may grow.
+	MaxBytes int64
+	// MaxAge is how long a file is written to.
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept, the oldest being removed first.
+	MaxBackups int
+}
+
+// RotatingFile appends to a file, moving it aside to the file's name followed by the
+// time, such as "server.log.20261019T101500.000000", once it is too large or too old.
+// A file that cannot be moved aside goes on being appended to.
+type RotatingFile struct {
+	filePath string
+	rotation Rotation
+	file     *os.File
+	size     int64
+	opened   time.Time
+	// rotateFailed is set while rotating fails, so that the failure is reported once.
+	rotateFailed bool
+	closed       bool
+	now          func() time.Time
+	lock         sync.Mutex
+}
+
+func OpenRotatingFile(filePath string, rotation Rotation) (*RotatingFile, error) {
+	if len(filePath) == 0 {
+		return nil, fmt.Errorf("log file path may not be empty")
+	}
+
+	rotating := &RotatingFile{filePath: filePath, rotation: rotation, now: time.Now}
+
+	if err := rotating.open(); err != nil {
+		return nil, err
+	}
+
+	return rotating, nil
+}
+
+func (rotating *RotatingFile) open() error {
+	file, err := os.OpenFile(rotating.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	rotating.file, rotating.size, rotating.opened = file, info.Size(), rotating.now()
+
+	// A file already written to is as old as its last change, so that restarting does
+	// not put off rotating it.
+	if info.Size() > 0 {
+		rotating.opened = info.ModTime()
+	}
+
+	return nil
+}
+
+// Write appends data, rotating first when data would make the file too large or the
+// file is too old. A file is never rotated while empty, so one write larger than
+// MaxBytes still goes somewhere. When rotating fails data is appended all the same and
+// the error returned, but only by the first write to fail rotating; later writes try
+// again quietly until rotating works.
+func (rotating *RotatingFile) Write(data []byte) (int, error) {
+	rotating.lock.Lock()
+	defer rotating.lock.Unlock()
+
+	if rotating.closed {
+		return 0, os.ErrClosed
+	}
+
+	if rotating.file == nil {
+		if err := rotating.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	tooLarge := rotating.rotation.MaxBytes > 0 && rotating.size+int64(len(data)) > rotating.rotation.MaxBytes
+	tooOld := rotating.rotation.MaxAge > 0 && rotating.now().Sub(rotating.opened) >= rotating.rotation.MaxAge
+
+	var rotateErr error
+
+	if rotating.size > 0 && (tooLarge || tooOld) {
+		err := rotating.rotate()
+
+		if err != nil && !rotating.rotateFailed {
+			rotateErr = err
+		}
+
+		rotating.rotateFailed = err != nil
+
+		if rotating.file == nil {
+			return 0, err
+		}
+	}
+
+	written, err := rotating.file.Write(data)
+	rotating.size += int64(written)
+
+	if err == nil {
+		err = rotateErr
+	}
+
+	return written, err
+}
+
+// rotate moves the file aside, opens a new one and removes the rotated files beyond
+// MaxBackups. If the file cannot be moved aside it is opened again to go on appending
+// to. The caller must hold the lock.
+func (rotating *RotatingFile) rotate() error {
+	_ = rotating.file.Close()
+	rotating.file = nil
+
+	renameErr := os.Rename(rotating.filePath, rotating.filePath+"."+rotating.now().Format(backupTimeLayout))
+
+	if err := rotating.open(); err != nil {
+		return err
+	}
+
+	if renameErr != nil {
+		return fmt.Errorf("rotating %s: %w", rotating.filePath, renameErr)
+	}
+
+	return rotating.removeOldBackups()
+}
+
+func (rotating *RotatingFile) removeOldBackups() error {
+	if rotating.rotation.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := Backups(rotating.filePath)
+
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > rotating.rotation.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// Backups returns the files filePath was rotated to, oldest first.
+func Backups(filePath string) ([]string, error) {
+	matches, err := filepath.Glob(filePath + ".*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+
+	for _, match := range matches {
+		if _, err := time.Parse(backupTimeLayout, strings.TrimPrefix(match, filePath+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+
+	sort.Strings(backups)
+
+	return backups, nil
+}
+
+func (rotating *RotatingFile) Close() error {
+	rotating.lock.Lock()
+	defer rotating.lock.Unlock()
+
+	rotating.closed = true
+
+	if rotating.file == nil {
+		return nil
+	}
+
+	err := rotating.file.Close()
+	rotating.file = nil
+
+	return err
+}
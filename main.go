@@ -1,31 +1,272 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"petServer/auth"
+	"petServer/config"
 	"petServer/dataStore"
+	"petServer/health"
+	"petServer/logging"
+	"petServer/metrics"
+	"petServer/reminders"
 	"petServer/webServer"
+	"syscall"
+	"time"
+	// The Docker image is built from scratch, so appointment time zones need the
+	// zone database compiled in.
+	_ "time/tzdata"
+)
+
+// Exit codes of the server.
+const (
+	exitOK     = 0
+	exitForced = 1
+	exitError  = -1
 )
 
 func main() {
-	// TODO: Change filePath to something more appropriate.
-	store, err := dataStore.NewDataStore("/Users/doomer/tmp/pets.json")
+	configuration, arguments, err := config.Load(os.Args[1:], os.Environ())
+
+	if err == flag.ErrHelp {
+		_ = config.WriteUsage(os.Stderr)
+		os.Exit(2)
+	}
 
 	if err != nil {
-		log.Printf("error : %+v", err)
-		os.Exit(-1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	server, err := webServer.NewPetServer(":8080", store)
+	if len(arguments) > 0 {
+		if err := runCommand(arguments, configuration, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		return
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	os.Exit(run(configuration, signals))
+}
+
+// runCommand runs a command other than serving, writing what it did to output.
+func runCommand(arguments []string, configuration config.Config, output io.Writer) error {
+	switch arguments[0] {
+	case "keys":
+		return runKeysCommand(arguments[1:], configuration.Auth.KeyFilePath, output)
+	case "config":
+		if len(arguments) != 2 || arguments[1] != "print" {
+			return fmt.Errorf("usage:\n  petServer [flags] config print")
+		}
+
+		return configuration.Write(output)
+	case "audit":
+		if len(arguments) != 2 || arguments[1] != "verify" {
+			return fmt.Errorf("usage:\n  petServer [flags] audit verify")
+		}
+
+		return verifyAuditLog(configuration.Log.AuditFile, output)
+	default:
+		return fmt.Errorf("unknown command %q; run petServer -help for usage", arguments[0])
+	}
+}
+
+// verifyAuditLog checks the chain of the audit log in filePath and says how far it goes.
+func verifyAuditLog(filePath string, output io.Writer) error {
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	last, err := logging.VerifyAuditLog(file)
 
 	if err != nil {
-		log.Printf("Error: %+v", err)
-		os.Exit(-1)
+		return fmt.Errorf("%s: %w", filePath, err)
 	}
 
-	if err := server.Start(); err != http.ErrServerClosed {
-		log.Printf("Error: %+v\n", err)
-		os.Exit(-1)
+	_, err = fmt.Fprintf(output, "%s holds up to entry %d, %s at %s, with hash %s\n", filePath, last.Sequence, last.Action, last.Time.Format(time.RFC3339), last.Hash)
+
+	return err
+}
+
+// run serves until the server is closed or told to stop by a signal, returning the
+// exit code. SIGTERM and SIGINT shut the server down, letting requests in progress
+// finish and storing the data; a second signal during the shutdown exits at once.
+// SIGHUP reads the data and JWKS files again, unless there are changes to the data not
+// yet stored, which reading it would drop. API keys need no signal, as the key file is
+// read again whenever it changes.
+func run(configuration config.Config, signals <-chan os.Signal) int {
+	logger, logFile, err := logging.Open(configuration.Log)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %+v\n", err)
+		return exitError
+	}
+
+	defer logFile.Close()
+
+	previousLogger := slog.Default()
+	slog.SetDefault(logger)
+
+	defer slog.SetDefault(previousLogger)
+
+	store, err := dataStore.NewDataStore(configuration.Store)
+
+	if err != nil {
+		slog.Error("creating the store failed", "error", err)
+		return exitError
+	}
+
+	registry := metrics.NewRegistry()
+	registry.RegisterRuntimeMetrics()
+	store = dataStore.Instrument(store, registry)
+
+	if len(configuration.Log.AuditFile) > 0 {
+		auditLog, err := logging.OpenAuditLog(configuration.Log.AuditFile)
+
+		if err != nil {
+			slog.Error("opening the audit log failed", "error", err)
+			return exitError
+		}
+
+		defer auditLog.Close()
+
+		store = dataStore.Audit(store, auditLog)
+	}
+
+	server, err := webServer.NewPetServer(configuration.Server, store)
+
+	if err != nil {
+		slog.Error("creating the server failed", "error", err)
+		return exitError
+	}
+
+	server.EnableMetrics(registry)
+
+	keys, err := auth.NewKeyStore(configuration.Auth.KeyFilePath)
+
+	if err != nil {
+		slog.Error("reading the API keys failed", "error", err)
+		return exitError
+	}
+
+	jwtRoles, err := auth.ParseSubjectRoles(configuration.Auth.JWTRoles)
+
+	if err != nil {
+		slog.Error("reading the JWT roles failed", "error", err)
+		return exitError
+	}
+
+	// Without a mapping, the values of the role claim are taken to be role names.
+	if len(jwtRoles) == 0 {
+		jwtRoles = nil
+	}
+
+	tokens, err := auth.NewJWTValidator(configuration.Auth.JWKSFilePath, auth.JWTConfig{
+		Issuer:    configuration.Auth.JWTIssuer,
+		Audience:  configuration.Auth.JWTAudience,
+		ClockSkew: configuration.Auth.ClockSkew,
+		RoleClaim: configuration.Auth.JWTRoleClaim,
+		Roles:     jwtRoles,
+	})
+
+	if err != nil {
+		slog.Error("reading the JWKS failed", "error", err)
+		return exitError
+	}
+
+	clientCertRoles, err := auth.ParseSubjectRoles(configuration.Auth.ClientCertRoles)
+
+	if err != nil {
+		slog.Error("reading the client certificate roles failed", "error", err)
+		return exitError
+	}
+
+	server.Use(webServer.RequestIDMiddleware(), webServer.LoggingMiddleware(logger), webServer.TimingMiddleware("app"), webServer.RecoveryMiddleware(logger),
+		webServer.ClientCertificateMiddleware(auth.NewSubjectMapper(clientCertRoles, auth.NoRole)), webServer.AuthMiddleware(auth.DefaultPolicy(), keys, tokens))
+
+	notifier := reminders.NewLogNotifier(logger)
+
+	if len(configuration.Reminders.SMTPAddress) > 0 {
+		notifier, err = reminders.NewSMTPNotifier(configuration.Reminders.SMTPAddress, configuration.Reminders.SMTPFrom)
+
+		if err != nil {
+			slog.Error("creating the SMTP notifier failed", "error", err)
+			return exitError
+		}
+	}
+
+	scheduler, err := reminders.NewScheduler(store, notifier, configuration.Reminders.Window, configuration.Reminders.ScanInterval)
+
+	if err != nil {
+		slog.Error("creating the reminder scheduler failed", "error", err)
+		return exitError
+	}
+
+	server.AddService(scheduler)
+	server.HealthChecks().Register(health.Liveness, "reminder-scheduler", scheduler)
+
+	started := make(chan error, 1)
+
+	go func() {
+		started <- server.Start()
+	}()
+
+	shuttingDown := false
+
+	for {
+		select {
+		case err := <-started:
+			if err != http.ErrServerClosed {
+				slog.Error("serving failed", "error", err)
+				return exitError
+			}
+
+			// Start only returns once the shutdown has finished, so this just asks how it went.
+			if err := server.Shutdown(context.Background()); err != nil {
+				slog.Error("shutting down failed", "error", err)
+				return exitError
+			}
+
+			return exitOK
+		case received := <-signals:
+			switch {
+			case shuttingDown:
+				slog.Warn("received a signal while shutting down, exiting now", "signal", received.String())
+				return exitForced
+			case received == syscall.SIGHUP:
+				slog.Info("received a signal, reloading", "signal", received.String())
+
+				if store.UnsavedChanges() {
+					slog.Warn("not reloading the data, as it has changes not yet stored", "file", configuration.Store.FilePath)
+				} else if err := store.Load(); err != nil {
+					slog.Error("reloading the data failed, keeping the data read before", "file", configuration.Store.FilePath, "error", err)
+				}
+
+				if err := tokens.Reload(); err != nil {
+					slog.Error("reloading the JWKS failed", "file", configuration.Auth.JWKSFilePath, "error", err)
+				}
+			default:
+				slog.Info("received a signal, shutting down", "signal", received.String())
+				shuttingDown = true
+
+				go func() {
+					_ = server.Shutdown(context.Background())
+				}()
+			}
+		}
 	}
 }
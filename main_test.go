@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"petServer/auth"
+	"petServer/config"
+	"petServer/dataStore"
+	"petServer/logging"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startServer runs the server on a free port with its files in directory, delivering
+// signals sent to the process to it, and waits until it answers.
+func startServer(t *testing.T, directory string) (string, string, chan int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	configuration := config.Default()
+	configuration.Server.Address = address
+	configuration.Server.AdminAddress = "unix:" + filepath.Join(directory, "admin.sock")
+	configuration.Store.FilePath = filepath.Join(directory, "pets.json")
+	configuration.Auth.KeyFilePath = filepath.Join(directory, "pets.keys.json")
+	configuration.Auth.JWKSFilePath = filepath.Join(directory, "pets.jwks.json")
+	configuration.Log.File = filepath.Join(directory, "server.log")
+	configuration.Log.AuditFile = filepath.Join(directory, "pets.audit.log")
+
+	keys, err := auth.NewKeyStore(configuration.Auth.KeyFilePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _, err := keys.Create("tester", auth.Editor)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	exitCode := make(chan int, 1)
+
+	go func() {
+		exitCode <- run(configuration, signals)
+		signal.Stop(signals)
+	}()
+
+	url := "http://" + address
+
+	for attempt := 0; attempt < 200; attempt++ {
+		if status, _ := getPet(url, key, "nobody"); status != 0 {
+			return url, key, exitCode
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("server did not start")
+
+	return "", "", nil
+}
+
+// getPet returns the status GET /pet answers for name, or 0 when it cannot be reached,
+// and whether the answer names the pet.
+func getPet(url string, key string, name string) (int, bool) {
+	request, _ := http.NewRequest("GET", url+"/pet?name="+name, nil)
+	request.Header.Set("X-API-Key", key)
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		return 0, false
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	return response.StatusCode, err == nil && strings.Contains(string(body), `"`+name+`"`)
+}
+
+func sendSignal(t *testing.T, signal syscall.Signal) {
+	if err := syscall.Kill(os.Getpid(), signal); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForExit(t *testing.T, exitCode chan int) int {
+	select {
+	case code := <-exitCode:
+		return code
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit")
+		return 0
+	}
+}
+
+func TestSignalsReloadAndStopTheServer(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestSignalsReloadAndStopTheServer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	url, key, exitCode := startServer(t, directory)
+
+	// Another process changes the data file; SIGHUP makes the server read it again.
+	edited, err := dataStore.NewDataStore(dataStore.Config{FilePath: filepath.Join(directory, "pets.json")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited.AddPet("Gracie", "Spitz", 9)
+
+	if err := edited.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	sendSignal(t, syscall.SIGHUP)
+
+	for attempt := 0; ; attempt++ {
+		if _, found := getPet(url, key, "Gracie"); found {
+			break
+		}
+
+		if attempt == 200 {
+			t.Fatal("expected SIGHUP to reload the data file")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	request, _ := http.NewRequest("POST", url+"/pet", strings.NewReader(`{"name":"Buttons","age":2,"breed":"Terrier"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-Key", key)
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil || response.StatusCode >= 300 {
+		t.Fatalf("expected the pet to be added, got %v %v", response, err)
+	}
+
+	_ = response.Body.Close()
+
+	// Reloading now would drop Buttons, who is not stored yet.
+	sendSignal(t, syscall.SIGHUP)
+
+	for attempt := 0; ; attempt++ {
+		logged, _ := ioutil.ReadFile(filepath.Join(directory, "server.log"))
+
+		if strings.Contains(string(logged), `"msg":"not reloading the data, as it has changes not yet stored"`) {
+			break
+		}
+
+		if attempt == 200 {
+			t.Fatal("expected SIGHUP not to reload data with changes not yet stored")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+
+	if code := waitForExit(t, exitCode); code != exitOK {
+		t.Errorf("expected SIGTERM to exit with %d, got %d", exitOK, code)
+	}
+
+	stored, _ := dataStore.NewDataStore(dataStore.Config{FilePath: filepath.Join(directory, "pets.json")})
+
+	if err := stored.Load(); err != nil || len(stored.AllPets().Collection) != 2 {
+		t.Errorf("expected both pets to be stored on exit, got %v %v", stored.AllPets().Collection, err)
+	}
+
+	logged, err := ioutil.ReadFile(filepath.Join(directory, "server.log"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`"msg":"request","method":"POST","path":"/pet","status":201`,
+		`"caller":{"subject":"tester","role":"editor","method":"api-key"}`,
+		`"msg":"received a signal, shutting down","signal":"terminated"`,
+	} {
+		if !strings.Contains(string(logged), expected) {
+			t.Errorf("expected %s in the log, got %s", expected, logged)
+		}
+	}
+
+	var output bytes.Buffer
+
+	if err := runCommand([]string{"audit", "verify"}, config.Config{Log: logging.Config{AuditFile: filepath.Join(directory, "pets.audit.log")}}, &output); err != nil || !strings.Contains(output.String(), "up to entry 1, create_pet") {
+		t.Errorf("expected the audit log to hold the added pet, got %q %v", output.String(), err)
+	}
+}
+
+func TestSecondSignalForcesExit(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestSecondSignalForcesExit")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	url, key, exitCode := startServer(t, directory)
+
+	// A request whose body never ends keeps the shutdown waiting. The server asks for the
+	// body once the request is being handled.
+	connection, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer connection.Close()
+
+	fmt.Fprintf(connection, "PUT /pet HTTP/1.1\r\nHost: petServer\r\nContent-Type: application/json\r\nContent-Length: 100\r\nExpect: 100-continue\r\nX-API-Key: %s\r\n\r\n", key)
+
+	if line, err := bufio.NewReader(connection).ReadString('\n'); err != nil || !strings.Contains(line, "100 Continue") {
+		t.Fatalf("expected the server to ask for the body, got %q %v", line, err)
+	}
+
+	sendSignal(t, syscall.SIGINT)
+
+	select {
+	case code := <-exitCode:
+		t.Fatalf("expected the shutdown to wait for the request in progress, exited with %d", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sendSignal(t, syscall.SIGTERM)
+
+	if code := waitForExit(t, exitCode); code != exitForced {
+		t.Errorf("expected a second signal to exit with %d, got %d", exitForced, code)
+	}
+}
@@ -0,0 +1,357 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the
+// Prometheus text exposition format, without the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of what Registry.WriteTo writes.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets suit request latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can write its samples.
+type collector interface {
+	name() string
+	write(writer *bufio.Writer)
+}
+
+// Registry holds the metrics to expose.
+type Registry struct {
+	collectors map[string]collector
+	lock       sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register adds collector, or panics if another metric has its name, which is a
+// mistake in the program rather than something to handle.
+func (registry *Registry) register(collector collector) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if _, ok := registry.collectors[collector.name()]; ok {
+		panic(fmt.Sprintf("metric %s is already registered", collector.name()))
+	}
+
+	registry.collectors[collector.name()] = collector
+}
+
+// WriteTo writes every metric, sorted by name, in the text exposition format.
+func (registry *Registry) WriteTo(output io.Writer) (int64, error) {
+	registry.lock.Lock()
+	collectors := make([]collector, 0, len(registry.collectors))
+
+	for _, collector := range registry.collectors {
+		collectors = append(collectors, collector)
+	}
+
+	registry.lock.Unlock()
+
+	sort.Slice(collectors, func(i int, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+
+	counter := &countingWriter{writer: output}
+	writer := bufio.NewWriter(counter)
+
+	for _, collector := range collectors {
+		collector.write(writer)
+	}
+
+	err := writer.Flush()
+
+	return counter.written, err
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (counter *countingWriter) Write(data []byte) (int, error) {
+	written, err := counter.writer.Write(data)
+	counter.written += int64(written)
+
+	return written, err
+}
+
+// family is what every kind of metric shares: its name, help, type and label names,
+// and its values for each combination of label values.
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labelNames []string
+	values     map[string]*sample
+	lock       sync.Mutex
+}
+
+// sample is the value of a metric for one combination of label values. Histograms use
+// counts for their buckets, sum and count.
+type sample struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+func newFamily(name string, help string, kind string, labelNames []string) *family {
+	return &family{metricName: name, help: help, kind: kind, labelNames: labelNames, values: make(map[string]*sample)}
+}
+
+func (family *family) name() string {
+	return family.metricName
+}
+
+// sampleFor returns the sample for labelValues, which the caller must hold the lock for.
+func (family *family) sampleFor(labelValues []string) *sample {
+	if len(labelValues) != len(family.labelNames) {
+		panic(fmt.Sprintf("metric %s needs %d label values, not %d", family.metricName, len(family.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	value, ok := family.values[key]
+
+	if !ok {
+		value = &sample{labelValues: append([]string{}, labelValues...)}
+		family.values[key] = value
+	}
+
+	return value
+}
+
+func (family *family) writeHeader(writer *bufio.Writer) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", family.metricName, escapeHelp(family.help), family.metricName, family.kind)
+}
+
+// sortedSamples returns the samples in order of their label values, which the caller
+// must hold the lock for.
+func (family *family) sortedSamples() []*sample {
+	samples := make([]*sample, 0, len(family.values))
+
+	for _, value := range family.values {
+		samples = append(samples, value)
+	}
+
+	sort.Slice(samples, func(i int, j int) bool {
+		return strings.Join(samples[i].labelValues, "\xff") < strings.Join(samples[j].labelValues, "\xff")
+	})
+
+	return samples
+}
+
+// Counter only goes up, such as the number of requests answered.
+type Counter struct {
+	*family
+}
+
+func (registry *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+	counter := &Counter{newFamily(name, help, "counter", labelNames)}
+	registry.register(counter)
+
+	return counter
+}
+
+// Add adds delta, which may not be negative, to the counter for labelValues.
+func (counter *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s may not go down", counter.metricName))
+	}
+
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+
+	counter.sampleFor(labelValues).value += delta
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *Counter) write(writer *bufio.Writer) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+
+	counter.writeHeader(writer)
+
+	for _, sample := range counter.sortedSamples() {
+		writeSample(writer, counter.metricName, counter.labelNames, sample.labelValues, "", "", sample.value)
+	}
+}
+
+// Gauge goes up and down, such as the number of requests in progress.
+type Gauge struct {
+	*family
+}
+
+func (registry *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{newFamily(name, help, "gauge", labelNames)}
+	registry.register(gauge)
+
+	return gauge
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.lock.Lock()
+	defer gauge.lock.Unlock()
+
+	gauge.sampleFor(labelValues).value = value
+}
+
+func (gauge *Gauge) Add(delta float64, labelValues ...string) {
+	gauge.lock.Lock()
+	defer gauge.lock.Unlock()
+
+	gauge.sampleFor(labelValues).value += delta
+}
+
+func (gauge *Gauge) write(writer *bufio.Writer) {
+	gauge.lock.Lock()
+	defer gauge.lock.Unlock()
+
+	gauge.writeHeader(writer)
+
+	for _, sample := range gauge.sortedSamples() {
+		writeSample(writer, gauge.metricName, gauge.labelNames, sample.labelValues, "", "", sample.value)
+	}
+}
+
+// gaugeFunc reads its value when the metrics are written.
+type gaugeFunc struct {
+	*family
+	value func() float64
+}
+
+// NewGaugeFunc adds a gauge, without labels, whose value is read from value each time
+// the metrics are written.
+func (registry *Registry) NewGaugeFunc(name string, help string, value func() float64) {
+	registry.register(&gaugeFunc{family: newFamily(name, help, "gauge", nil), value: value})
+}
+
+func (gauge *gaugeFunc) write(writer *bufio.Writer) {
+	gauge.writeHeader(writer)
+	writeSample(writer, gauge.metricName, nil, nil, "", "", gauge.value())
+}
+
+// Histogram counts observations, such as latencies, into buckets.
+type Histogram struct {
+	*family
+	buckets []float64
+}
+
+// NewHistogram adds a histogram whose buckets have the given upper bounds, in
+// increasing order; DefaultBuckets when there are none.
+func (registry *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	histogram := &Histogram{family: newFamily(name, help, "histogram", labelNames), buckets: append([]float64{}, buckets...)}
+	sort.Float64s(histogram.buckets)
+	registry.register(histogram)
+
+	return histogram
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+
+	sample := histogram.sampleFor(labelValues)
+
+	if sample.counts == nil {
+		sample.counts = make([]uint64, len(histogram.buckets))
+	}
+
+	for index, bound := range histogram.buckets {
+		if value <= bound {
+			sample.counts[index]++
+		}
+	}
+
+	sample.sum += value
+	sample.count++
+}
+
+func (histogram *Histogram) write(writer *bufio.Writer) {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+
+	histogram.writeHeader(writer)
+
+	for _, sample := range histogram.sortedSamples() {
+		for index, bound := range histogram.buckets {
+			writeSample(writer, histogram.metricName+"_bucket", histogram.labelNames, sample.labelValues, "le", formatFloat(bound), float64(sample.counts[index]))
+		}
+
+		writeSample(writer, histogram.metricName+"_bucket", histogram.labelNames, sample.labelValues, "le", "+Inf", float64(sample.count))
+		writeSample(writer, histogram.metricName+"_sum", histogram.labelNames, sample.labelValues, "", "", sample.sum)
+		writeSample(writer, histogram.metricName+"_count", histogram.labelNames, sample.labelValues, "", "", float64(sample.count))
+	}
+}
+
+// writeSample writes one line, with extraLabel, such as a histogram bucket's le, after
+// the other labels when it is not empty.
+func writeSample(writer *bufio.Writer, name string, labelNames []string, labelValues []string, extraLabel string, extraValue string, value float64) {
+	writer.WriteString(name)
+
+	if len(labelNames) > 0 || len(extraLabel) > 0 {
+		writer.WriteByte('{')
+
+		for index, labelName := range labelNames {
+			if index > 0 {
+				writer.WriteByte(',')
+			}
+
+			fmt.Fprintf(writer, "%s=\"%s\"", labelName, escapeLabelValue(labelValues[index]))
+		}
+
+		if len(extraLabel) > 0 {
+			if len(labelNames) > 0 {
+				writer.WriteByte(',')
+			}
+
+			fmt.Fprintf(writer, "%s=\"%s\"", extraLabel, extraValue)
+		}
+
+		writer.WriteByte('}')
+	}
+
+	writer.WriteByte(' ')
+	writer.WriteString(formatFloat(value))
+	writer.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWritingTheTextFormat(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := registry.NewCounter("requests_total", "Requests answered.", "method", "path")
+	latency := registry.NewHistogram("latency_seconds", "How long requests took.", []float64{1, 0.1}, "method")
+	inFlight := registry.NewGauge("in_flight", "Requests in progress.")
+	registry.NewGaugeFunc("pets", "Pets in the store.\nCounted when scraped.", func() float64 { return 3 })
+
+	requests.Inc("GET", "/pet")
+	requests.Add(2, "GET", "/pet")
+	requests.Inc("POST", `/say "hi"\`)
+	latency.Observe(0.05, "GET")
+	latency.Observe(0.5, "GET")
+	latency.Observe(5, "GET")
+	inFlight.Add(2)
+	inFlight.Add(-1)
+
+	var output bytes.Buffer
+
+	if _, err := registry.WriteTo(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP in_flight Requests in progress.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds How long requests took.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="GET",le="0.1"} 1
+latency_seconds_bucket{method="GET",le="1"} 2
+latency_seconds_bucket{method="GET",le="+Inf"} 3
+latency_seconds_sum{method="GET"} 5.55
+latency_seconds_count{method="GET"} 3
+# HELP pets Pets in the store.\nCounted when scraped.
+# TYPE pets gauge
+pets 3
+# HELP requests_total Requests answered.
+# TYPE requests_total counter
+requests_total{method="GET",path="/pet"} 3
+requests_total{method="POST",path="/say \"hi\"\\"} 1
+`
+
+	if output.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, output.String())
+	}
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterRuntimeMetrics()
+
+	var output bytes.Buffer
+
+	if _, err := registry.WriteTo(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"\ngo_goroutines ", "\ngo_memstats_alloc_bytes ", "# TYPE go_gc_cycles_total counter", "go_info{version=\"go", "\nprocess_start_time_seconds "} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, output.String())
+		}
+	}
+}
+
+func TestRegisteringANameTwicePanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("requests_total", "Requests answered.")
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering requests_total twice to panic")
+		}
+	}()
+
+	registry.NewGauge("requests_total", "Requests answered.")
+}
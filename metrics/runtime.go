@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bufio"
+	"runtime"
+	"time"
+)
+
+// runtimeCollector writes the Go runtime's statistics, read once each time the metrics
+// are written, under the names the Prometheus client library uses.
+type runtimeCollector struct {
+	startTime time.Time
+}
+
+// RegisterRuntimeMetrics adds the Go runtime's statistics: goroutines, threads, memory,
+// garbage collection and when the process started.
+func (registry *Registry) RegisterRuntimeMetrics() {
+	registry.register(&runtimeCollector{startTime: time.Now()})
+}
+
+func (collector *runtimeCollector) name() string {
+	return "go_"
+}
+
+func (collector *runtimeCollector) write(writer *bufio.Writer) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	gauges := []struct {
+		name  string
+		help  string
+		kind  string
+		value float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine())},
+		{"go_threads", "Number of OS threads created.", "gauge", float64(threads)},
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge", float64(memStats.Alloc)},
+		{"go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", "counter", float64(memStats.TotalAlloc)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from the system.", "gauge", float64(memStats.Sys)},
+		{"go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", "gauge", float64(memStats.HeapInuse)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", "gauge", float64(memStats.HeapObjects)},
+		{"go_memstats_mallocs_total", "Total number of mallocs.", "counter", float64(memStats.Mallocs)},
+		{"go_memstats_frees_total", "Total number of frees.", "counter", float64(memStats.Frees)},
+		{"go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", "gauge", float64(memStats.LastGC) / 1e9},
+		{"go_gc_cycles_total", "Number of completed garbage collection cycles.", "counter", float64(memStats.NumGC)},
+		{"go_gc_pause_seconds_total", "Total time the world was stopped for garbage collection.", "counter", float64(memStats.PauseTotalNs) / 1e9},
+		{"process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "gauge", float64(collector.startTime.UnixNano()) / 1e9},
+	}
+
+	for _, gauge := range gauges {
+		family := family{metricName: gauge.name, help: gauge.help, kind: gauge.kind}
+		family.writeHeader(writer)
+		writeSample(writer, gauge.name, nil, nil, "", "", gauge.value)
+	}
+
+	family := family{metricName: "go_info", help: "Information about the Go environment.", kind: "gauge"}
+	family.writeHeader(writer)
+	writeSample(writer, "go_info", []string{"version"}, []string{runtime.Version()}, "", "", 1)
+}
@@ -0,0 +1,90 @@
+package reminders
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var ErrNoRecipients = errors.New("reminder has no recipients")
+
+// Reminder tells a pet's owners that one of its vaccinations is due.
+type Reminder struct {
+	Key           string
+	PetID         string
+	PetName       string
+	VaccinationID string
+	Vaccine       string
+	DueDate       string
+	Recipients    []string
+}
+
+type Notifier interface {
+	Notify(reminder Reminder) error
+}
+
+// NewLogNotifier returns a notifier that logs reminders to logger instead of sending
+// them, or to the default logger when logger is nil.
+func NewLogNotifier(logger *slog.Logger) Notifier {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &logNotifier{logger: logger}
+}
+
+type logNotifier struct {
+	logger *slog.Logger
+}
+
+func (notifier *logNotifier) Notify(reminder Reminder) error {
+	notifier.logger.Info("reminder", "pet_name", reminder.PetName, "pet_id", reminder.PetID, "vaccine", reminder.Vaccine, "due_date", reminder.DueDate,
+		"recipients", reminder.Recipients)
+
+	return nil
+}
+
+// NewSMTPNotifier returns a notifier that mails reminders through the unauthenticated
+// SMTP relay at address, such as a local mail transfer agent on localhost:25.
+func NewSMTPNotifier(address string, from string) (Notifier, error) {
+	if len(address) == 0 {
+		return nil, fmt.Errorf("address may not be empty")
+	}
+
+	if len(from) == 0 {
+		return nil, fmt.Errorf("from may not be empty")
+	}
+
+	return &smtpNotifier{address: address, from: from}, nil
+}
+
+type smtpNotifier struct {
+	address string
+	from    string
+}
+
+func (notifier *smtpNotifier) Notify(reminder Reminder) error {
+	if len(reminder.Recipients) == 0 {
+		return ErrNoRecipients
+	}
+
+	var message bytes.Buffer
+
+	fmt.Fprintf(&message, "From: %s\r\n", notifier.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(reminder.Recipients, ", "))
+	// The pet's name and the vaccine are typed in by users, so are encoded rather than
+	// put in the header as they are, where a line break would start another header.
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("%s is due for %s", reminder.PetName, reminder.Vaccine)))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&message, "\r\n")
+	fmt.Fprintf(&message, "%s's %s vaccination is due on %s.\r\n", reminder.PetName, reminder.Vaccine, reminder.DueDate)
+
+	return smtp.SendMail(notifier.address, nil, notifier.from, reminder.Recipients, message.Bytes())
+}
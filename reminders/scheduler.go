@@ -0,0 +1,195 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"petServer/dataStore"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultScanInterval = 24 * time.Hour
+
+// NewScheduler returns a scheduler that, every interval, reminds owners about the
+// vaccinations of their pets that fall due within window of the scan.
+func NewScheduler(store dataStore.DataStore, notifier Notifier, window time.Duration, interval time.Duration) (Scheduler, error) {
+	if store == nil {
+		return nil, fmt.Errorf("store may not be nil")
+	}
+
+	if notifier == nil {
+		return nil, fmt.Errorf("notifier may not be nil")
+	}
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+
+	return &scheduler{store: store, notifier: notifier, window: window, interval: interval}, nil
+}
+
+type Scheduler interface {
+	Start() error
+	Stop()
+	Scan(now time.Time) (int, error)
+	Check(ctx context.Context) error
+}
+
+var ErrSchedulerStopped = errors.New("scheduler is not running")
+
+type scheduler struct {
+	store    dataStore.DataStore
+	notifier Notifier
+	window   time.Duration
+	interval time.Duration
+	done     chan struct{}
+	lastRun  atomic.Int64 // when a scan last finished, in Unix nanoseconds
+	stopped  sync.WaitGroup
+	lock     sync.Mutex
+}
+
+// Start scans once straight away and then every interval until Stop is called.
+func (scheduler *scheduler) Start() error {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	if scheduler.done != nil {
+		return fmt.Errorf("scheduler already started")
+	}
+
+	scheduler.done = make(chan struct{})
+	scheduler.lastRun.Store(time.Now().UnixNano())
+	scheduler.stopped.Add(1)
+
+	go scheduler.run(scheduler.done)
+
+	return nil
+}
+
+func (scheduler *scheduler) Stop() {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	if scheduler.done == nil {
+		return
+	}
+
+	close(scheduler.done)
+	scheduler.stopped.Wait()
+	scheduler.done = nil
+}
+
+// Check returns an error when the scheduler is not running, or has not finished a scan
+// for two intervals, which means a scan is stuck. A scan that fails still counts as
+// finished, as the next one may well succeed.
+func (scheduler *scheduler) Check(ctx context.Context) error {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+
+	if scheduler.done == nil {
+		return ErrSchedulerStopped
+	}
+
+	if since := time.Since(time.Unix(0, scheduler.lastRun.Load())); since > 2*scheduler.interval {
+		return fmt.Errorf("no scan has finished for %s", since.Round(time.Second))
+	}
+
+	return nil
+}
+
+func (scheduler *scheduler) run(done chan struct{}) {
+	defer scheduler.stopped.Done()
+
+	ticker := time.NewTicker(scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := scheduler.Scan(time.Now()); err != nil {
+			slog.Error("reminder scan failed", "error", err)
+		}
+
+		scheduler.lastRun.Store(time.Now().UnixNano())
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan sends a reminder for every pet whose latest vaccination of each vaccine is due
+// by now plus the window, unless one was already sent for that vaccination. It
+// returns how many reminders were sent.
+func (scheduler *scheduler) Scan(now time.Time) (int, error) {
+	deadline := now.Add(scheduler.window)
+	sent := 0
+
+	var lastErr error
+
+	for petID, record := range scheduler.store.AllMedicalRecords() {
+		pets := scheduler.store.PetByID(petID)
+		pet, ok := pets.Collection[petID]
+
+		if !ok {
+			continue
+		}
+
+		for _, vaccination := range record.LatestVaccinations() {
+			dueDate, err := time.Parse(dataStore.BirthDateLayout, vaccination.DueDate)
+
+			if err != nil || dueDate.After(deadline) {
+				continue
+			}
+
+			key := fmt.Sprintf("vaccination/%s/%s/%s", petID, vaccination.ID, vaccination.DueDate)
+
+			if scheduler.store.ReminderSent(key) {
+				continue
+			}
+
+			reminder := Reminder{
+				Key:           key,
+				PetID:         petID,
+				PetName:       pet.Name,
+				VaccinationID: vaccination.ID,
+				Vaccine:       vaccination.Vaccine,
+				DueDate:       vaccination.DueDate,
+				Recipients:    scheduler.recipients(petID),
+			}
+
+			if err := scheduler.notifier.Notify(reminder); err != nil {
+				lastErr = err
+				continue
+			}
+
+			scheduler.store.MarkReminderSent(key, now)
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		if err := scheduler.store.Store(); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, lastErr
+}
+
+// recipients are the e-mail addresses of the pet's owners; emergency contacts are
+// left out.
+func (scheduler *scheduler) recipients(petID string) []string {
+	recipients := []string{}
+
+	for _, ownerOfPet := range scheduler.store.OwnersOfPet(petID) {
+		if ownerOfPet.Role != dataStore.EmergencyContactRole && len(ownerOfPet.Owner.Email) > 0 {
+			recipients = append(recipients, ownerOfPet.Owner.Email)
+		}
+	}
+
+	return recipients
+}
@@ -0,0 +1,335 @@
+package reminders
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"petServer/dataStore"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func nukeFiles(filePath string) {
+	for _, suffix := range []string{"", ".owners", ".medical", ".reminders"} {
+		_ = os.Remove(strings.TrimSuffix(filePath, ".json") + suffix + ".json")
+	}
+}
+
+// fakeSMTPServer accepts mail on a local port and keeps every message it is given.
+type fakeSMTPServer struct {
+	listener net.Listener
+	messages []string
+	lock     sync.Mutex
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeSMTPServer{listener: listener}
+
+	go server.serve()
+
+	return server
+}
+
+func (server *fakeSMTPServer) serve() {
+	for {
+		connection, err := server.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go server.converse(connection)
+	}
+}
+
+func (server *fakeSMTPServer) converse(connection net.Conn) {
+	defer connection.Close()
+
+	reader := bufio.NewReader(connection)
+	reply := func(line string) {
+		_, _ = connection.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost fake SMTP")
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 go ahead")
+
+			var message strings.Builder
+
+			for {
+				dataLine, err := reader.ReadString('\n')
+
+				if err != nil {
+					return
+				}
+
+				if dataLine == ".\r\n" {
+					break
+				}
+
+				message.WriteString(dataLine)
+			}
+
+			server.lock.Lock()
+			server.messages = append(server.messages, message.String())
+			server.lock.Unlock()
+
+			reply("250 queued")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (server *fakeSMTPServer) received() []string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	return append([]string{}, server.messages...)
+}
+
+func newStoreWithVaccination(t *testing.T, filePath string, dueDate string) dataStore.DataStore {
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pets := store.AddPet("Shasta", "Spitz", 9)
+
+	var petID string
+
+	for id := range pets.Collection {
+		petID = id
+	}
+
+	owner, err := store.AddOwner(dataStore.Owner{Name: "Pat", Email: "pat@example.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.LinkPetOwner(petID, owner.ID, dataStore.PrimaryOwnerRole); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.UpdateMedicalRecord(petID, func(record dataStore.MedicalRecord) (dataStore.MedicalRecord, error) {
+		record.Vaccinations = append(record.Vaccinations,
+			dataStore.Vaccination{Vaccine: "Rabies", DateGiven: "2023-03-01", DueDate: "2024-03-01"},
+			dataStore.Vaccination{Vaccine: "Rabies", DateGiven: "2024-03-01", DueDate: dueDate})
+		return record, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestSendingReminderOverSMTP(t *testing.T) {
+	const filePath = "TestSendingReminderOverSMTP.json"
+
+	defer nukeFiles(filePath)
+
+	smtpServer := newFakeSMTPServer(t)
+	defer smtpServer.listener.Close()
+
+	now := time.Date(2026, 2, 20, 9, 0, 0, 0, time.UTC)
+	store := newStoreWithVaccination(t, filePath, "2026-03-01")
+
+	notifier, err := NewSMTPNotifier(smtpServer.listener.Addr().String(), "clinic@example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler, err := NewScheduler(store, notifier, 14*24*time.Hour, DefaultScanInterval)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := scheduler.Scan(now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent != 1 {
+		t.Fatalf("expected 1 reminder, sent %d", sent)
+	}
+
+	messages := smtpServer.received()
+
+	if len(messages) != 1 || !strings.Contains(messages[0], "To: pat@example.com") || !strings.Contains(messages[0], "due on 2026-03-01") {
+		t.Errorf("unexpected messages: %q", messages)
+	}
+
+	// A restarted server must not send the same reminder again.
+	store2, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store2.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler2, _ := NewScheduler(store2, notifier, 14*24*time.Hour, DefaultScanInterval)
+
+	if sent, err := scheduler2.Scan(now.Add(24 * time.Hour)); sent != 0 || err != nil {
+		t.Errorf("expected no reminders after restart, sent %d with error %v", sent, err)
+	}
+}
+
+func TestReminderSubjectCannotAddHeaders(t *testing.T) {
+	smtpServer := newFakeSMTPServer(t)
+	defer smtpServer.listener.Close()
+
+	notifier, err := NewSMTPNotifier(smtpServer.listener.Addr().String(), "clinic@example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reminder := Reminder{PetName: "Shasta\r\nBcc: eve@example.com", Vaccine: "Rabies", DueDate: "2026-03-01", Recipients: []string{"pat@example.com"}}
+
+	if err := notifier.Notify(reminder); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := smtpServer.received()
+
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %q", messages)
+	}
+
+	if header, _, _ := strings.Cut(messages[0], "\r\n\r\n"); strings.Contains(header, "\nBcc:") || !strings.Contains(header, "Subject: =?utf-8?q?Shasta") {
+		t.Errorf("expected the subject to be encoded, got %q", header)
+	}
+}
+
+func TestReminderMessageHeaders(t *testing.T) {
+	smtpServer := newFakeSMTPServer(t)
+	defer smtpServer.listener.Close()
+
+	notifier, err := NewSMTPNotifier(smtpServer.listener.Addr().String(), "clinic@example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reminder := Reminder{PetName: "Zoë", Vaccine: "Rabies", DueDate: "2026-03-01", Recipients: []string{"pat@example.com", "sam@example.com"}}
+
+	if err := notifier.Notify(reminder); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := smtpServer.received()
+
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %q", messages)
+	}
+
+	header, _, _ := strings.Cut(messages[0], "\r\n\r\n")
+
+	if strings.Count(header, "To: ") != 1 || !strings.Contains(header, "To: pat@example.com, sam@example.com\r\n") {
+		t.Errorf("expected a single To header with both recipients, got %q", header)
+	}
+
+	if !strings.Contains(header, "MIME-Version: 1.0\r\n") || !strings.Contains(header, "Content-Type: text/plain; charset=utf-8") {
+		t.Errorf("expected the body to be declared UTF-8 text, got %q", header)
+	}
+}
+
+func TestVaccinationsOutsideWindowAreNotReminded(t *testing.T) {
+	const filePath = "TestVaccinationsOutsideWindowAreNotReminded.json"
+
+	defer nukeFiles(filePath)
+
+	store := newStoreWithVaccination(t, filePath, "2026-06-01")
+
+	scheduler, err := NewScheduler(store, &recordingNotifier{}, 14*24*time.Hour, DefaultScanInterval)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent, err := scheduler.Scan(time.Date(2026, 2, 20, 9, 0, 0, 0, time.UTC)); sent != 0 || err != nil {
+		t.Errorf("expected no reminders, sent %d with error %v", sent, err)
+	}
+}
+
+type recordingNotifier struct {
+	reminders []Reminder
+}
+
+func (notifier *recordingNotifier) Notify(reminder Reminder) error {
+	notifier.reminders = append(notifier.reminders, reminder)
+	return nil
+}
+
+func TestStartingAndStoppingScheduler(t *testing.T) {
+	const filePath = "TestStartingAndStoppingScheduler.json"
+
+	defer nukeFiles(filePath)
+
+	store := newStoreWithVaccination(t, filePath, time.Now().Format(dataStore.BirthDateLayout))
+	notifier := &recordingNotifier{}
+
+	scheduler, err := NewScheduler(store, notifier, time.Hour, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scheduler.Start(); err == nil {
+		t.Error("starting a running scheduler should fail")
+	}
+
+	if err := scheduler.Check(context.Background()); err != nil {
+		t.Errorf("expected a running scheduler to be healthy, got %v", err)
+	}
+
+	scheduler.Stop()
+	scheduler.Stop()
+
+	if err := scheduler.Check(context.Background()); err != ErrSchedulerStopped {
+		t.Errorf("expected a stopped scheduler to say so, got %v", err)
+	}
+
+	if len(notifier.reminders) != 1 || notifier.reminders[0].PetName != "Shasta" {
+		t.Errorf("expected the first scan to remind about Shasta, got %+v", notifier.reminders)
+	}
+}
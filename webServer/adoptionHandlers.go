@@ -0,0 +1,108 @@
+package webServer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"petServer/dataStore"
+)
+
+// adoptionResponse is a pet's adoption record together with where it may go next.
+type adoptionResponse struct {
+	dataStore.AdoptionRecord
+	Allowed []string `json:"allowed"`
+}
+
+type transitionRequest struct {
+	Status string `json:"status"`
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+// transitionError is the body of a 409 answer to a refused transition.
+type transitionError struct {
+	Error   string   `json:"error"`
+	Status  string   `json:"status,omitempty"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// adoptionHandler serves a pet's adoption status:
+//
+//	GET  /pets/{name}/status   the status, its history and the allowed next statuses
+//	POST /pets/{name}/status   move to {"status":..., "by":..., "reason":...}
+//
+// A transition made by an authenticated caller is recorded as made by its subject.
+type adoptionHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *adoptionHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	segments := pathSegments(httpRequest.URL.Path)
+
+	if len(segments) != 3 {
+		responseWriter.WriteHeader(404)
+		return fmt.Errorf("no such adoption resource: %s", httpRequest.URL.Path)
+	}
+
+	petID, status, err := resolvePetReference(handler.dataStore, segments[1])
+
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return err
+	}
+
+	switch httpRequest.Method {
+	case "GET":
+		record, allowed, err := handler.dataStore.AdoptionRecordOf(petID)
+
+		if err != nil {
+			responseWriter.WriteHeader(statusForStoreError(err))
+			return err
+		}
+
+		return writeResponse(responseWriter, httpRequest, 200, adoptionResponse{AdoptionRecord: record, Allowed: allowed})
+	case "POST":
+		return handler.transition(responseWriter, httpRequest, petID)
+	default:
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+}
+
+func (handler *adoptionHandler) transition(responseWriter http.ResponseWriter, httpRequest *http.Request, petID string) error {
+	var request transitionRequest
+
+	if err := readBody(responseWriter, httpRequest, &request); err != nil {
+		return err
+	}
+
+	if identity, ok := IdentityOf(httpRequest); ok && len(identity.Subject) > 0 {
+		request.By = identity.Subject
+	}
+
+	if len(request.Status) == 0 || len(request.By) == 0 {
+		responseWriter.WriteHeader(422)
+		return fmt.Errorf("a transition needs a status and who made it")
+	}
+
+	record, allowed, err := handler.dataStore.TransitionPet(petID, request.Status, request.By, request.Reason)
+
+	var invalidTransition *dataStore.InvalidTransitionError
+
+	switch {
+	case errors.As(err, &invalidTransition):
+		_ = writeResponse(responseWriter, httpRequest, 409, transitionError{Error: err.Error(), Status: invalidTransition.From, Allowed: invalidTransition.Allowed})
+		return err
+	case errors.Is(err, dataStore.ErrUnknownStatus):
+		responseWriter.WriteHeader(422)
+		return err
+	case errors.Is(err, dataStore.ErrTransitionBlocked):
+		_ = writeResponse(responseWriter, httpRequest, 409, transitionError{Error: err.Error()})
+		return err
+	case err != nil:
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
+
+	return writeResponse(responseWriter, httpRequest, 200, adoptionResponse{AdoptionRecord: record, Allowed: allowed})
+}
@@ -0,0 +1,70 @@
+package webServer
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestTransitioningAdoptionStatus(t *testing.T) {
+	const filePath = "TestTransitioningAdoptionStatus.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	store.AddPet("Shasta", "Spitz", 9)
+	store.AddPet("Gracie", "Spitz", 9)
+
+	recorder := serveRequest(t, mux, "POST", "/pets/Shasta/status", `{"status":"available","by":"alice","reason":"settled in"}`)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("transition returned wrong status code: got %v want %v: %s", status, http.StatusOK, recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "POST", "/pets/Gracie/status", `{"status":"adopted","by":"alice"}`)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Fatalf("invalid transition returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	var refusal transitionError
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &refusal); err != nil {
+		t.Fatal(err)
+	}
+
+	if refusal.Status != "intake" || len(refusal.Allowed) != 2 || refusal.Allowed[0] != "available" {
+		t.Errorf("expected the allowed next statuses in the refusal, got %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "POST", "/pets/Gracie/status", `{"status":"eaten","by":"alice"}`)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("transition to an unknown status returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	recorder = serveRequest(t, mux, "POST", "/pets/Shasta/status", `{"status":"adopted"}`)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("transition without who made it returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/pet?status=available", "")
+
+	if pets := decodePets(t, recorder); len(pets.Collection) != 1 {
+		t.Errorf("expected 1 available pet, got %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/pets/Shasta/status", "")
+
+	var response adoptionResponse
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Status != "available" || len(response.History) != 1 || response.History[0].By != "alice" {
+		t.Errorf("unexpected adoption record: %s", recorder.Body.String())
+	}
+}
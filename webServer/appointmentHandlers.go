@@ -0,0 +1,212 @@
+package webServer
+
+import (
+	"fmt"
+	"net/http"
+	"petServer/dataStore"
+	"time"
+)
+
+// localTimeLayout is accepted for appointment times that carry no UTC offset; they
+// are read in the appointment's time zone.
+const localTimeLayout = "2006-01-02T15:04"
+
+type appointmentRequest struct {
+	PetID    string `json:"pet_id"`
+	Kind     string `json:"kind"`
+	Resource string `json:"resource"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	TimeZone string `json:"time_zone"`
+	Notes    string `json:"notes"`
+}
+
+type appointmentsResponse struct {
+	Appointments []dataStore.Appointment `json:"appointments"`
+}
+
+// appointmentsHandler serves /appointments and /appointments/{id}. POST books, PUT on
+// an appointment reschedules it and DELETE cancels it.
+type appointmentsHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *appointmentsHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	segments := pathSegments(httpRequest.URL.Path)
+
+	if len(segments) > 2 {
+		responseWriter.WriteHeader(404)
+		return fmt.Errorf("no such appointment resource: %s", httpRequest.URL.Path)
+	}
+
+	id := ""
+
+	if len(segments) == 2 {
+		id = segments[1]
+	}
+
+	switch {
+	case len(id) == 0 && httpRequest.Method == "GET":
+		return handler.handleRange(responseWriter, httpRequest)
+	case len(id) == 0 && httpRequest.Method == "POST":
+		return handler.handleBook(responseWriter, httpRequest)
+	case len(id) > 0 && httpRequest.Method == "GET":
+		appointment, err := handler.dataStore.AppointmentByID(id)
+		return writeAppointment(responseWriter, httpRequest, 200, appointment, err)
+	case len(id) > 0 && httpRequest.Method == "PUT":
+		return handler.handleReschedule(responseWriter, httpRequest, id)
+	case len(id) > 0 && httpRequest.Method == "DELETE":
+		appointment, err := handler.dataStore.CancelAppointment(id)
+		return writeAppointment(responseWriter, httpRequest, 200, appointment, err)
+	default:
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+}
+
+// handleRange answers GET /appointments?from=&to=, where from and to are RFC 3339
+// times or dates and default to now and a week later.
+func (handler *appointmentsHandler) handleRange(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	query := httpRequest.URL.Query()
+
+	from := time.Now()
+	to := from.AddDate(0, 0, 7)
+
+	var err error
+
+	if value := query.Get("from"); len(value) > 0 {
+		if from, err = parseRangeTime(value); err != nil {
+			responseWriter.WriteHeader(400)
+			return err
+		}
+	}
+
+	if value := query.Get("to"); len(value) > 0 {
+		if to, err = parseRangeTime(value); err != nil {
+			responseWriter.WriteHeader(400)
+			return err
+		}
+	}
+
+	if !to.After(from) {
+		responseWriter.WriteHeader(400)
+		return fmt.Errorf("to must be after from")
+	}
+
+	return writeResponse(responseWriter, httpRequest, 200, appointmentsResponse{Appointments: handler.dataStore.AppointmentsBetween(from, to)})
+}
+
+func (handler *appointmentsHandler) handleBook(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	var request appointmentRequest
+
+	if err := readBody(responseWriter, httpRequest, &request); err != nil {
+		return err
+	}
+
+	start, end, err := parseAppointmentTimes(request)
+
+	if err != nil {
+		responseWriter.WriteHeader(422)
+		return err
+	}
+
+	appointment, err := handler.dataStore.BookAppointment(dataStore.Appointment{
+		PetID:    request.PetID,
+		Kind:     request.Kind,
+		Resource: request.Resource,
+		Start:    start,
+		End:      end,
+		TimeZone: request.TimeZone,
+		Notes:    request.Notes,
+	})
+
+	if err == nil {
+		responseWriter.Header().Set("Location", "/appointments/"+appointment.ID)
+	}
+
+	return writeAppointment(responseWriter, httpRequest, 201, appointment, err)
+}
+
+func (handler *appointmentsHandler) handleReschedule(responseWriter http.ResponseWriter, httpRequest *http.Request, id string) error {
+	appointment, err := handler.dataStore.AppointmentByID(id)
+
+	if err != nil {
+		return writeAppointment(responseWriter, httpRequest, 200, appointment, err)
+	}
+
+	request := appointmentRequest{TimeZone: appointment.TimeZone}
+
+	if err := readBody(responseWriter, httpRequest, &request); err != nil {
+		return err
+	}
+
+	start, end, err := parseAppointmentTimes(request)
+
+	if err != nil {
+		responseWriter.WriteHeader(422)
+		return err
+	}
+
+	appointment, err = handler.dataStore.RescheduleAppointment(id, start, end)
+
+	return writeAppointment(responseWriter, httpRequest, 200, appointment, err)
+}
+
+func writeAppointment(responseWriter http.ResponseWriter, httpRequest *http.Request, status int, appointment dataStore.Appointment, err error) error {
+	if err != nil {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
+
+	return writeResponse(responseWriter, httpRequest, status, appointment)
+}
+
+func parseAppointmentTimes(request appointmentRequest) (time.Time, time.Time, error) {
+	location, err := time.LoadLocation(request.TimeZone)
+
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown time zone %q", request.TimeZone)
+	}
+
+	start, err := parseAppointmentTime(request.Start, location)
+
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	end, err := parseAppointmentTime(request.End, location)
+
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return start, end, nil
+}
+
+func parseAppointmentTime(value string, location *time.Location) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.ParseInLocation(localTimeLayout, value, location)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC 3339 nor %s", value, localTimeLayout)
+	}
+
+	return parsed, nil
+}
+
+func parseRangeTime(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.Parse(dataStore.BirthDateLayout, value)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC 3339 nor %s", value, dataStore.BirthDateLayout)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,87 @@
+package webServer
+
+import (
+	"encoding/json"
+	"net/http"
+	"petServer/dataStore"
+	"testing"
+	"time"
+)
+
+func TestBookingAppointments(t *testing.T) {
+	const filePath = "TestBookingAppointments.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	shastaID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+	gracieID := petNamed(t, store.AddPet("Gracie", "Spitz", 9), "Gracie").ID
+
+	recorder := serveRequest(t, mux, "POST", "/appointments", `{"pet_id":"`+shastaID+`","kind":"grooming","start":"2026-03-02T10:00","end":"2026-03-02T11:00","time_zone":"America/Denver"}`)
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Fatalf("booking returned wrong status code: got %v want %v: %s", status, http.StatusCreated, recorder.Body.String())
+	}
+
+	var appointment dataStore.Appointment
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &appointment); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC); !appointment.Start.Equal(expected) {
+		t.Errorf("expected start %v, got %v", expected, appointment.Start)
+	}
+
+	if _, offset := appointment.Start.Zone(); offset != -7*60*60 {
+		t.Errorf("expected start to be shown in Denver time, got %v", appointment.Start)
+	}
+
+	// The only grooming table is taken, even though Gracie herself is free.
+	recorder = serveRequest(t, mux, "POST", "/appointments", `{"pet_id":"`+gracieID+`","kind":"grooming","start":"2026-03-02T17:30:00Z","end":"2026-03-02T18:30:00Z"}`)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("booking a full resource returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	recorder = serveRequest(t, mux, "PUT", "/appointments/"+appointment.ID, `{"start":"2026-03-02T12:00","end":"2026-03-02T13:00"}`)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("rescheduling returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	recorder = serveRequest(t, mux, "POST", "/appointments", `{"pet_id":"`+gracieID+`","kind":"grooming","start":"2026-03-02T17:30:00Z","end":"2026-03-02T18:30:00Z"}`)
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Errorf("booking a freed resource returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/appointments?from=2026-03-02&to=2026-03-03", "")
+
+	var appointments appointmentsResponse
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &appointments); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(appointments.Appointments) != 2 || appointments.Appointments[0].PetID != gracieID {
+		t.Errorf("unexpected appointments in range: %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "DELETE", "/appointments/"+appointment.ID, "")
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("cancelling returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if _, err := store.RemovePet(shastaID); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder = serveRequest(t, mux, "POST", "/appointments", `{"pet_id":"`+shastaID+`","kind":"vet","start":"2026-03-04T10:00:00Z","end":"2026-03-04T11:00:00Z"}`)
+
+	if status := recorder.Code; status != http.StatusNotFound {
+		t.Errorf("booking for a removed pet returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
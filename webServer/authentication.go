@@ -0,0 +1,141 @@
+package webServer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"petServer/auth"
+	"petServer/dataStore"
+	"strings"
+)
+
+// authRealm names the server in WWW-Authenticate challenges.
+const authRealm = "petServer"
+
+// APIKeyHeader carries an API key for clients that cannot send an Authorization header.
+const APIKeyHeader = "X-API-Key"
+
+// AuthMiddleware lets a request through only when policy's role for its method and
+// path is allowed by the identity one of authenticators finds for its credential,
+// given as "Authorization: Bearer <credential>" or in X-API-Key. Requests without a
+// credential, or with one no authenticator accepts, are answered with 401 and those
+// whose identity's role is not enough with 403, both with a Bearer challenge. Routes
+// that need no role are open to everyone. Requests without a credential that
+// ClientCertificateMiddleware found an identity for are judged by that identity.
+// Handlers find the identity with IdentityOf.
+func AuthMiddleware(policy *auth.Policy, authenticators ...auth.Authenticator) Middleware {
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			required := policy.RoleFor(httpRequest.Method, httpRequest.URL.Path)
+			credential := credentialOf(httpRequest)
+			identity, identified := IdentityOf(httpRequest)
+
+			if required == auth.NoRole && len(credential) == 0 {
+				return next.HandleRequest(responseWriter, httpRequest)
+			}
+
+			if len(credential) == 0 && !identified {
+				responseWriter.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+				responseWriter.WriteHeader(401)
+				return fmt.Errorf("%s %s needs credentials", httpRequest.Method, httpRequest.URL.Path)
+			}
+
+			if len(credential) > 0 {
+				var err error
+
+				if identity, err = authenticate(credential, authenticators); err != nil {
+					responseWriter.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\"", authRealm))
+					responseWriter.WriteHeader(401)
+					return err
+				}
+			}
+
+			if !identity.Role.Allows(required) {
+				responseWriter.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=\"insufficient_scope\", scope=%q", authRealm, required))
+				responseWriter.WriteHeader(403)
+				return fmt.Errorf("%s %s needs role %s, %s has role %s", httpRequest.Method, httpRequest.URL.Path, required, identity.Subject, identity.Role)
+			}
+
+			return next.HandleRequest(responseWriter, withIdentity(httpRequest, identity))
+		})
+	}
+}
+
+// ClientCertificateMiddleware identifies requests over TLS whose client certificate was
+// verified against the server's client CAs with certificates, for AuthMiddleware, which
+// must come after it, to judge. Certificates it refuses are answered with 401.
+func ClientCertificateMiddleware(certificates auth.CertificateAuthenticator) Middleware {
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			if httpRequest.TLS == nil || len(httpRequest.TLS.VerifiedChains) == 0 || len(httpRequest.TLS.VerifiedChains[0]) == 0 {
+				return next.HandleRequest(responseWriter, httpRequest)
+			}
+
+			identity, err := certificates.AuthenticateCertificate(httpRequest.TLS.VerifiedChains[0][0])
+
+			if err != nil {
+				responseWriter.WriteHeader(401)
+				return err
+			}
+
+			return next.HandleRequest(responseWriter, withIdentity(httpRequest, identity))
+		})
+	}
+}
+
+// IdentityOf returns who AuthMiddleware authenticated the request as, if anyone.
+func IdentityOf(httpRequest *http.Request) (auth.Identity, bool) {
+	identity, ok := httpRequest.Context().Value(identityContextKey).(auth.Identity)
+
+	return identity, ok
+}
+
+// withIdentity hands identity to the handlers and to the access log, which sees the
+// request before it is authenticated.
+func withIdentity(httpRequest *http.Request, identity auth.Identity) *http.Request {
+	if caller, ok := httpRequest.Context().Value(callerContextKey).(*auth.Identity); ok {
+		*caller = identity
+	}
+
+	return httpRequest.WithContext(context.WithValue(httpRequest.Context(), identityContextKey, identity))
+}
+
+// actingFor returns store acting for whoever httpRequest was authenticated as, so that
+// an audited store records who made its changes.
+func actingFor(store dataStore.DataStore, httpRequest *http.Request) dataStore.DataStore {
+	acting, ok := store.(dataStore.ActingStore)
+
+	if !ok {
+		return store
+	}
+
+	identity, _ := IdentityOf(httpRequest)
+
+	return acting.As(dataStore.Actor{Subject: identity.Subject, RequestID: RequestIDOf(httpRequest)})
+}
+
+func credentialOf(httpRequest *http.Request) string {
+	authorization := httpRequest.Header.Get("Authorization")
+
+	if scheme, credential, ok := strings.Cut(authorization, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(credential)
+	}
+
+	return strings.TrimSpace(httpRequest.Header.Get(APIKeyHeader))
+}
+
+// authenticate returns the identity the first authenticator to accept credential finds,
+// or the last authenticator's error.
+func authenticate(credential string, authenticators []auth.Authenticator) (auth.Identity, error) {
+	err := fmt.Errorf("no authenticators")
+
+	for _, authenticator := range authenticators {
+		var identity auth.Identity
+
+		if identity, err = authenticator.Authenticate(credential); err == nil {
+			return identity, nil
+		}
+	}
+
+	return auth.Identity{}, err
+}
@@ -0,0 +1,165 @@
+package webServer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"petServer/auth"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthorizingRequests(t *testing.T) {
+	const filePath = "TestAuthorizingRequests.json"
+
+	defer remove(filePath)
+
+	directory, err := ioutil.TempDir("", "TestAuthorizingRequests")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	keys, err := auth.NewKeyStore(filepath.Join(directory, "keys.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readerKey, _, _ := keys.Create("dashboard", auth.Reader)
+	editorKey, _, _ := keys.Create("frontDesk", auth.Editor)
+
+	_, store := newTestMux(t, filePath)
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := auth.DefaultPolicy()
+	policy.Require("GET", "/calendar.ics", auth.NoRole)
+
+	var seen auth.Identity
+
+	server.Use(AuthMiddleware(policy, keys))
+	server.Dispatcher().UseForMethod("PUT", func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			seen, _ = IdentityOf(httpRequest)
+			return next.HandleRequest(responseWriter, httpRequest)
+		})
+	})
+
+	mux := server.(*petServer).newMux()
+	adminMux := server.(*petServer).newAdminMux()
+	const petDefinition = `{"pets_collection":{"Shasta":{"age":9,"breed":"Spitz"}}}`
+
+	tests := []struct {
+		method    string
+		target    string
+		headers   map[string]string
+		status    int
+		challenge string
+	}{
+		{"GET", "/pet", nil, http.StatusUnauthorized, `Bearer realm="petServer"`},
+		{"GET", "/pet", map[string]string{"Authorization": "Bearer pet_nope"}, http.StatusUnauthorized, `error="invalid_token"`},
+		{"GET", "/pet", map[string]string{"Authorization": "Bearer " + readerKey}, http.StatusOK, ""},
+		{"GET", "/pet", map[string]string{APIKeyHeader: readerKey}, http.StatusOK, ""},
+		{"PUT", "/pet", map[string]string{"Authorization": "Bearer " + readerKey}, http.StatusForbidden, `error="insufficient_scope", scope="editor"`},
+		{"PUT", "/pet", map[string]string{"Authorization": "bearer " + editorKey}, http.StatusOK, ""},
+		{"PUT", "/close", map[string]string{"Authorization": "Bearer " + editorKey}, http.StatusForbidden, `scope="admin"`},
+		{"GET", "/calendar.ics?pet=Shasta", nil, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		body := ""
+
+		if test.method == "PUT" {
+			body = petDefinition
+		}
+
+		targetMux := mux
+
+		if test.target == "/close" {
+			targetMux = adminMux
+		}
+
+		recorder := negotiatedRequest(t, targetMux, test.method, test.target, test.headers, body)
+
+		if recorder.Code != test.status {
+			t.Errorf("%s %s %v: expected %v, got %v", test.method, test.target, test.headers, test.status, recorder.Code)
+		}
+
+		if challenge := recorder.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, test.challenge) || (len(test.challenge) == 0) != (len(challenge) == 0) {
+			t.Errorf("%s %s %v: expected a challenge with %q, got %q", test.method, test.target, test.headers, test.challenge, challenge)
+		}
+	}
+
+	if seen != (auth.Identity{Subject: "frontDesk", Role: auth.Editor, Method: "api-key"}) {
+		t.Errorf("expected handlers to see who made the PUT, got %+v", seen)
+	}
+}
+
+func TestTokenSubjectMakesStatusChanges(t *testing.T) {
+	const filePath = "TestTokenSubjectMakesStatusChanges.json"
+
+	defer remove(filePath)
+
+	directory, err := ioutil.TempDir("", "TestTokenSubjectMakesStatusChanges")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	secret := []byte("a secret of at least thirty-two bytes")
+	jwksFilePath := filepath.Join(directory, "jwks.json")
+	jwks := `{"keys":[{"kty":"oct","kid":"shared","k":"` + base64.RawURLEncoding.EncodeToString(secret) + `"}]}`
+
+	if err := ioutil.WriteFile(jwksFilePath, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := auth.NewJWTValidator(jwksFilePath, auth.JWTConfig{Audience: "petServer"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"shared"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"carol","aud":"petServer","exp":%d,"role":"editor"}`, time.Now().Add(time.Hour).Unix())))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	_, store := newTestMux(t, filePath)
+	store.AddPet("Shasta", "Spitz", 9)
+
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Use(AuthMiddleware(auth.DefaultPolicy(), tokens))
+
+	recorder := negotiatedRequest(t, server.(*petServer).newMux(), "POST", "/pets/Shasta/status", map[string]string{"Authorization": "Bearer " + token}, `{"status":"available","by":"mallory"}`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("transition returned wrong status code: got %v want %v: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+
+	record, _, err := store.AdoptionRecordOf(petNamed(t, store.AllPets(), "Shasta").ID)
+
+	if err != nil || len(record.History) != 1 || record.History[0].By != "carol" {
+		t.Errorf("expected the token's subject to have made the change, got %+v %v", record.History, err)
+	}
+}
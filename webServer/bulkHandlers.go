@@ -0,0 +1,398 @@
+package webServer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"petServer/codecs"
+	"petServer/dataStore"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const csvFormat = "csv"
+const ndjsonFormat = "ndjson"
+
+// maxNDJSONLine bounds the length of one pet in an NDJSON import.
+const maxNDJSONLine = 1 << 20
+
+// DefaultMaxImportBytes bounds import requests on servers that have not been given
+// another limit in their Config.
+const DefaultMaxImportBytes = 32 << 20
+
+// exportFlushRows is how many pets an export writes between flushes.
+const exportFlushRows = 100
+
+// exportFormats negotiates the format of an export; the codecs are only used for
+// their media types.
+var exportFormats = codecs.NewRegistry(
+	codecs.Codec{MediaType: "application/x-ndjson", Aliases: []string{"application/ndjson", "application/jsonl"}},
+	codecs.Codec{MediaType: "text/csv", Aliases: []string{"application/csv"}},
+)
+
+var bulkMediaTypes = map[string]string{
+	"text/csv":             csvFormat,
+	"application/csv":      csvFormat,
+	"application/x-ndjson": ndjsonFormat,
+	"application/ndjson":   ndjsonFormat,
+	"application/jsonl":    ndjsonFormat,
+}
+
+// importRow is the outcome of importing one CSV row or NDJSON line. Rows are numbered
+// from 1, which for CSV is the header.
+type importRow struct {
+	Row int `json:"row"`
+	dataStore.ImportOutcome
+}
+
+type importReport struct {
+	DryRun     bool        `json:"dry_run"`
+	OnConflict string      `json:"on_conflict"`
+	Created    int         `json:"created"`
+	Updated    int         `json:"updated"`
+	Skipped    int         `json:"skipped"`
+	Failed     int         `json:"failed"`
+	Rows       []importRow `json:"rows"`
+}
+
+// importHandler serves POST /pets/import, reading pets as CSV or NDJSON according to
+// the Content-Type. Parameters:
+//
+//	on_conflict=upsert|skip|fail   what to do with pets already in the store, default fail
+//	dry_run=true                   report what would happen without changing anything
+//	map=Column:field               read a CSV column as a pet field, or ignore it with Column:-
+//
+// The answer lists the outcome of every row. Rows that cannot be read or are invalid
+// are reported and left out; with on_conflict=fail a single conflict imports nothing
+// and is answered with 409. Requests larger than maxBytes are answered with 413.
+type importHandler struct {
+	dataStore dataStore.DataStore
+	maxBytes  int64
+}
+
+func (handler *importHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "POST" {
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+
+	query := httpRequest.URL.Query()
+	policy := dataStore.ConflictPolicy(query.Get("on_conflict"))
+
+	if len(policy) == 0 {
+		policy = dataStore.FailOnConflict
+	}
+
+	if !policy.Valid() {
+		responseWriter.WriteHeader(400)
+		return fmt.Errorf("on_conflict must be upsert, skip or fail, not %q", policy)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpRequest.Header.Get("Content-Type"))
+	httpRequest.Body = http.MaxBytesReader(responseWriter, httpRequest.Body, handler.maxBytes)
+
+	var pets []dataStore.Pet
+	var rows []importRow
+	var err error
+
+	switch bulkMediaTypes[mediaType] {
+	case csvFormat:
+		pets, rows, err = readCSVPets(httpRequest.Body, query["map"])
+	case ndjsonFormat:
+		pets, rows, err = readNDJSONPets(httpRequest.Body)
+	default:
+		responseWriter.Header().Set("Accept", "text/csv, application/x-ndjson")
+		responseWriter.WriteHeader(415)
+		return fmt.Errorf("unsupported Content-Type for import: %s", httpRequest.Header.Get("Content-Type"))
+	}
+
+	if err != nil {
+		writeBodyError(responseWriter, err, 400)
+		return err
+	}
+
+	report := importReport{DryRun: query.Get("dry_run") == "true", OnConflict: string(policy), Rows: []importRow{}}
+	outcomes, err := actingFor(handler.dataStore, httpRequest).ImportPets(pets, policy, report.DryRun)
+
+	if err != nil && err != dataStore.ErrImportConflict {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
+
+	outcomeIndex := 0
+
+	for _, row := range rows {
+		if len(row.Action) == 0 {
+			row.ImportOutcome = outcomes[outcomeIndex]
+			outcomeIndex++
+		}
+
+		switch row.Action {
+		case dataStore.CreatedImport:
+			report.Created++
+		case dataStore.UpdatedImport:
+			report.Updated++
+		case dataStore.SkippedImport:
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+
+		report.Rows = append(report.Rows, row)
+	}
+
+	if err == dataStore.ErrImportConflict {
+		return writeResponse(responseWriter, httpRequest, 409, report)
+	}
+
+	return writeResponse(responseWriter, httpRequest, 200, report)
+}
+
+// failedRow reports a row that could not be read.
+func failedRow(row int, err error) importRow {
+	return importRow{Row: row, ImportOutcome: dataStore.ImportOutcome{Action: dataStore.FailedImport, Error: err.Error()}}
+}
+
+// readCSVPets reads pets from CSV whose header names pet fields, either directly, in
+// any case and with spaces or dashes for underscores, or through mappings. Rows that
+// cannot be read are returned as failed rows; the others are returned without an
+// outcome, in the same order as the pets.
+func readCSVPets(reader io.Reader, mappings []string) ([]dataStore.Pet, []importRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	header, err = mapCSVHeader(header, mappings)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pets := []dataStore.Pet{}
+	rows := []importRow{}
+
+	for row := 2; ; row++ {
+		record, err := csvReader.Read()
+
+		if err == io.EOF {
+			return pets, rows, nil
+		}
+
+		var parseError *csv.ParseError
+
+		if errors.As(err, &parseError) {
+			rows = append(rows, failedRow(row, err))
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var pet dataStore.Pet
+
+		if err := codecs.DecodeRecord(header, record, &pet); err != nil {
+			rows = append(rows, failedRow(row, err))
+			continue
+		}
+
+		pets = append(pets, pet)
+		rows = append(rows, importRow{Row: row})
+	}
+}
+
+// mapCSVHeader turns CSV column names into pet field names, leaving an empty name for
+// ignored columns.
+func mapCSVHeader(header []string, mappings []string) ([]string, error) {
+	fields := make(map[string]bool)
+
+	for _, column := range petColumns() {
+		fields[column] = true
+	}
+
+	mapped := make(map[string]string)
+
+	for _, mapping := range mappings {
+		parts := strings.SplitN(mapping, ":", 2)
+
+		if len(parts) != 2 || (parts[1] != "-" && !fields[parts[1]]) {
+			return nil, fmt.Errorf("map must look like Column:field or Column:-, with field one of %s, not %q", strings.Join(petColumns(), ", "), mapping)
+		}
+
+		mapped[normalizeColumn(parts[0])] = parts[1]
+	}
+
+	result := make([]string, len(header))
+
+	for index, column := range header {
+		name := normalizeColumn(column)
+
+		if field, ok := mapped[name]; ok {
+			name = field
+		}
+
+		switch {
+		case name == "-":
+			result[index] = ""
+		case fields[name]:
+			result[index] = name
+		default:
+			return nil, fmt.Errorf("unknown CSV column %q: map it with map=%s:field or ignore it with map=%s:-", column, column, column)
+		}
+	}
+
+	return result, nil
+}
+
+func normalizeColumn(column string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(column)))
+}
+
+// readNDJSONPets reads one pet per line, reporting lines that are not a pet as failed
+// rows and skipping blank ones.
+func readNDJSONPets(reader io.Reader) ([]dataStore.Pet, []importRow, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+
+	pets := []dataStore.Pet{}
+	rows := []importRow{}
+
+	for row := 1; scanner.Scan(); row++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+
+		if len(line) == 0 {
+			continue
+		}
+
+		var pet dataStore.Pet
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&pet); err != nil {
+			rows = append(rows, failedRow(row, err))
+			continue
+		}
+
+		if decoder.More() {
+			rows = append(rows, failedRow(row, fmt.Errorf("more than one pet on the line")))
+			continue
+		}
+
+		pets = append(pets, pet)
+		rows = append(rows, importRow{Row: row})
+	}
+
+	return pets, rows, scanner.Err()
+}
+
+// petColumns lists the JSON names of the fields of a pet, in order.
+func petColumns() []string {
+	columns := []string{}
+	petType := reflect.TypeOf(dataStore.Pet{})
+
+	for index := 0; index < petType.NumField(); index++ {
+		columns = append(columns, strings.Split(petType.Field(index).Tag.Get("json"), ",")[0])
+	}
+
+	return columns
+}
+
+// exportHandler serves GET /pets/export, streaming every pet, oldest first, as CSV or
+// NDJSON chosen by the format parameter or else the Accept header, NDJSON by default.
+type exportHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *exportHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "GET" {
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+
+	format := httpRequest.URL.Query().Get("format")
+
+	if codec, ok := exportFormats.ForAccept(httpRequest.Header.Get("Accept")); ok && len(format) == 0 {
+		format = bulkMediaTypes[codec.MediaType]
+	}
+
+	pets := handler.dataStore.AllPets()
+	ids := make([]string, 0, len(pets.Collection))
+
+	for id := range pets.Collection {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	var write func(pet dataStore.Pet) error
+	var flush func() error
+
+	switch format {
+	case csvFormat:
+		csvWriter := csv.NewWriter(responseWriter)
+		write = func(pet dataStore.Pet) error {
+			record, err := codecs.EncodeRecord(petColumns(), pet)
+
+			if err != nil {
+				return err
+			}
+
+			return csvWriter.Write(record)
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+
+		responseWriter.Header().Set("Content-Type", "text/csv")
+
+		if err := csvWriter.Write(petColumns()); err != nil {
+			return err
+		}
+	case ndjsonFormat:
+		encoder := json.NewEncoder(responseWriter)
+		write = func(pet dataStore.Pet) error {
+			return encoder.Encode(pet)
+		}
+		flush = func() error {
+			return nil
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		responseWriter.WriteHeader(406)
+		return fmt.Errorf("format must be csv or ndjson, not %q, or Accept must allow one of them", format)
+	}
+
+	for index, id := range ids {
+		if err := write(pets.Collection[id]); err != nil {
+			return err
+		}
+
+		if (index+1)%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+
+			if flusher, ok := responseWriter.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+	}
+
+	return flush()
+}
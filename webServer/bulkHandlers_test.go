@@ -0,0 +1,138 @@
+package webServer
+
+import (
+	"encoding/json"
+	"net/http"
+	"petServer/dataStore"
+	"strings"
+	"testing"
+)
+
+func TestImportingPetsFromCSV(t *testing.T) {
+	const filePath = "TestImportingPetsFromCSV.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	csv := "Pet Name,Age,Breed,Kennel\nShasta,10,Spitz,A1\nButtons,2,Terrier,B2\nRex,old,Mutt,C3\n"
+	headers := map[string]string{"Content-Type": "text/csv"}
+
+	recorder := negotiatedRequest(t, mux, "POST", "/pets/import?map=Pet+Name:name", headers, csv)
+
+	if status := recorder.Code; status != http.StatusBadRequest {
+		t.Errorf("import with an unknown column returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	recorder = negotiatedRequest(t, mux, "POST", "/pets/import?map=Pet+Name:name&map=Kennel:-&dry_run=true", headers, csv)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("dry run with a conflict returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	recorder = negotiatedRequest(t, mux, "POST", "/pets/import?map=Pet+Name:name&map=Kennel:-&on_conflict=upsert", headers, csv)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("import returned wrong status code: got %v want %v: %s", status, http.StatusOK, recorder.Body.String())
+	}
+
+	var report importReport
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 1 || report.Updated != 1 || report.Failed != 1 || report.Rows[2].Row != 4 || len(report.Rows[2].Error) == 0 {
+		t.Errorf("unexpected import report: %s", recorder.Body.String())
+	}
+
+	if pet := petNamed(t, store.AllPets(), "Shasta"); pet.Age != 10 {
+		t.Errorf("expected Shasta to be updated to 10, got %d", pet.Age)
+	}
+}
+
+func TestImportsAreLimitedInSize(t *testing.T) {
+	const filePath = "TestImportsAreLimitedInSize.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewPetServer(Config{Address: ":0", MaxImportBytes: 256}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := server.(*petServer).newMux()
+	headers := map[string]string{"Content-Type": "text/csv"}
+
+	recorder := negotiatedRequest(t, mux, "POST", "/pets/import", headers, "name,age,breed\nShasta,9,Spitz\n")
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("import within the limit returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	recorder = negotiatedRequest(t, mux, "POST", "/pets/import", headers, "name,age,breed\n"+strings.Repeat("Buttons,2,Terrier\n", 20))
+
+	if status := recorder.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("import over the limit returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+	}
+
+	if pets := store.AllPets(); len(pets.Collection) != 1 {
+		t.Errorf("expected the oversized import to add nothing, got %d pets", len(pets.Collection))
+	}
+}
+
+func TestImportingAndExportingNDJSON(t *testing.T) {
+	const filePath = "TestImportingAndExportingNDJSON.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	ndjson := `{"name":"Shasta","age":9,"breed":"Spitz"}` + "\n\n" + `{"name":"Buttons","favorite_toy":"ball"}` + "\n" + `{"name":"Gracie","age":9,"breed":"Spitz"}`
+
+	recorder := negotiatedRequest(t, mux, "POST", "/pets/import", map[string]string{"Content-Type": "application/x-ndjson"}, ndjson)
+
+	var report importReport
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 2 || report.Failed != 1 || report.Rows[1].Row != 3 {
+		t.Errorf("unexpected import report: %s", recorder.Body.String())
+	}
+
+	recorder = negotiatedRequest(t, mux, "GET", "/pets/export", map[string]string{"Accept": "text/csv"}, "")
+
+	shasta := petNamed(t, store.AllPets(), "Shasta")
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+
+	if len(lines) != 3 || lines[0] != strings.Join(petColumns(), ",") || !containsString(lines[1:], shasta.ID+",Shasta,9,Spitz,,,,,,,,,") {
+		t.Errorf("unexpected CSV export: %s", recorder.Body.String())
+	}
+
+	recorder = negotiatedRequest(t, mux, "GET", "/pets/export?format=ndjson", nil, "")
+
+	if lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n"); len(lines) != 2 || recorder.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("unexpected NDJSON export: %s", recorder.Body.String())
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+
+	return false
+}
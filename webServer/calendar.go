@@ -0,0 +1,285 @@
+package webServer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"petServer/dataStore"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const calendarProductID = "-//petServer//Pet calendar//EN"
+const calendarUIDDomain = "petserver"
+const calendarTimeLayout = "20060102T150405Z"
+const calendarDateLayout = "20060102"
+
+// calendarEvent is one VEVENT. All-day events have Date set instead of Start and End.
+type calendarEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Date        time.Time
+	Cancelled   bool
+}
+
+// calendarHandler serves GET /calendar.ics with every appointment and vaccination due
+// date, optionally only those of one pet (?pet=) or one owner's pets (?owner=).
+type calendarHandler struct {
+	dataStore dataStore.DataStore
+
+	// versions remembers, for each feed, when its current content was first seen, so
+	// Last-Modified and DTSTAMP only move when the events do. Feeds are keyed as
+	// selectPets names them, so there is at most one for each pet and owner.
+	versions map[string]feedVersion
+	lock     sync.Mutex
+}
+
+type feedVersion struct {
+	etag     string
+	modified time.Time
+}
+
+func newCalendarHandler(dataStore dataStore.DataStore) *calendarHandler {
+	return &calendarHandler{dataStore: dataStore, versions: make(map[string]feedVersion)}
+}
+
+func (handler *calendarHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "GET" && httpRequest.Method != "HEAD" {
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+
+	feed, petIDs, status, err := handler.selectPets(httpRequest)
+
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return err
+	}
+
+	events := handler.events(petIDs, time.Now())
+
+	contentHash := sha256.Sum256([]byte(renderCalendar(events, time.Time{})))
+	etag := `W/"` + hex.EncodeToString(contentHash[:16]) + `"`
+	lastModified := handler.modifiedAt(feed, etag)
+
+	responseWriter.Header().Set("ETag", etag)
+	responseWriter.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	responseWriter.Header().Set("Cache-Control", "no-cache")
+
+	if notModified(httpRequest, etag, lastModified) {
+		responseWriter.WriteHeader(304)
+		return nil
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+
+	if httpRequest.Method == "HEAD" {
+		return nil
+	}
+
+	_, _ = responseWriter.Write([]byte(renderCalendar(events, lastModified)))
+
+	return nil
+}
+
+// modifiedAt returns when feed first had the content identified by etag.
+func (handler *calendarHandler) modifiedAt(feed string, etag string) time.Time {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+
+	version, ok := handler.versions[feed]
+
+	if !ok || version.etag != etag {
+		version = feedVersion{etag: etag, modified: time.Now().UTC().Truncate(time.Second)}
+		handler.versions[feed] = version
+	}
+
+	return version.modified
+}
+
+func notModified(httpRequest *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := httpRequest.Header.Get("If-None-Match"); len(ifNoneMatch) > 0 {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(httpRequest.Header.Get("If-Modified-Since"))
+
+	return err == nil && !lastModified.After(ifModifiedSince)
+}
+
+// selectPets names the feed asked for and returns the IDs of the pets it covers, or nil
+// for every pet.
+func (handler *calendarHandler) selectPets(httpRequest *http.Request) (string, map[string]bool, int, error) {
+	query := httpRequest.URL.Query()
+
+	if reference := query.Get("pet"); len(reference) > 0 {
+		petID, status, err := resolvePetReference(handler.dataStore, reference)
+
+		if err != nil {
+			return "", nil, status, err
+		}
+
+		return "pet " + petID, map[string]bool{petID: true}, 0, nil
+	}
+
+	if ownerID := query.Get("owner"); len(ownerID) > 0 {
+		pets, err := handler.dataStore.PetsOfOwner(ownerID)
+
+		if err != nil {
+			return "", nil, statusForStoreError(err), err
+		}
+
+		petIDs := make(map[string]bool)
+
+		for petID := range pets.Collection {
+			petIDs[petID] = true
+		}
+
+		return "owner " + ownerID, petIDs, 0, nil
+	}
+
+	return "all", nil, 0, nil
+}
+
+// events lists the appointments from a month ago to a year ahead and the due date of
+// the latest vaccination of each vaccine, ordered by UID so the feed is stable.
+func (handler *calendarHandler) events(petIDs map[string]bool, now time.Time) []calendarEvent {
+	pets := handler.dataStore.AllPets()
+	events := []calendarEvent{}
+
+	for _, appointment := range handler.dataStore.AppointmentsBetween(now.AddDate(0, -1, 0), now.AddDate(1, 0, 0)) {
+		if petIDs != nil && !petIDs[appointment.PetID] {
+			continue
+		}
+
+		petName := pets.Collection[appointment.PetID].Name
+
+		events = append(events, calendarEvent{
+			UID:         "appointment-" + appointment.ID + "@" + calendarUIDDomain,
+			Summary:     fmt.Sprintf("%s: %s (%s)", petName, appointment.Kind, appointment.Resource),
+			Description: appointment.Notes,
+			Start:       appointment.Start,
+			End:         appointment.End,
+			Cancelled:   appointment.Status == dataStore.CancelledAppointment,
+		})
+	}
+
+	for petID, record := range handler.dataStore.AllMedicalRecords() {
+		if petIDs != nil && !petIDs[petID] {
+			continue
+		}
+
+		for _, vaccination := range record.LatestVaccinations() {
+			dueDate, err := time.Parse(dataStore.BirthDateLayout, vaccination.DueDate)
+
+			if err != nil {
+				continue
+			}
+
+			events = append(events, calendarEvent{
+				UID:         "vaccination-" + petID + "-" + vaccination.ID + "@" + calendarUIDDomain,
+				Summary:     fmt.Sprintf("%s: %s vaccination due", pets.Collection[petID].Name, vaccination.Vaccine),
+				Description: "Last given " + vaccination.DateGiven,
+				Date:        dueDate,
+			})
+		}
+	}
+
+	sort.Slice(events, func(i int, j int) bool {
+		return events[i].UID < events[j].UID
+	})
+
+	return events
+}
+
+// renderCalendar writes events as an RFC 5545 VCALENDAR stamped with stamp.
+func renderCalendar(events []calendarEvent, stamp time.Time) string {
+	var calendar strings.Builder
+
+	writeLine := func(line string) {
+		calendar.WriteString(foldCalendarLine(line))
+		calendar.WriteString("\r\n")
+	}
+
+	writeLine("BEGIN:VCALENDAR")
+	writeLine("VERSION:2.0")
+	writeLine("PRODID:" + calendarProductID)
+	writeLine("CALSCALE:GREGORIAN")
+
+	for _, event := range events {
+		writeLine("BEGIN:VEVENT")
+		writeLine("UID:" + escapeCalendarText(event.UID))
+		writeLine("DTSTAMP:" + stamp.UTC().Format(calendarTimeLayout))
+
+		if event.Date.IsZero() {
+			writeLine("DTSTART:" + event.Start.UTC().Format(calendarTimeLayout))
+			writeLine("DTEND:" + event.End.UTC().Format(calendarTimeLayout))
+		} else {
+			writeLine("DTSTART;VALUE=DATE:" + event.Date.Format(calendarDateLayout))
+			writeLine("DTEND;VALUE=DATE:" + event.Date.AddDate(0, 0, 1).Format(calendarDateLayout))
+		}
+
+		writeLine("SUMMARY:" + escapeCalendarText(event.Summary))
+
+		if len(event.Description) > 0 {
+			writeLine("DESCRIPTION:" + escapeCalendarText(event.Description))
+		}
+
+		if event.Cancelled {
+			writeLine("STATUS:CANCELLED")
+		} else {
+			writeLine("STATUS:CONFIRMED")
+		}
+
+		writeLine("END:VEVENT")
+	}
+
+	writeLine("END:VCALENDAR")
+
+	return calendar.String()
+}
+
+// escapeCalendarText escapes a TEXT value as RFC 5545 section 3.3.11 requires.
+func escapeCalendarText(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+	return replacer.Replace(text)
+}
+
+// foldCalendarLine splits a content line into lines of at most 75 octets, each
+// continuation starting with a space, without splitting a UTF-8 character.
+func foldCalendarLine(line string) string {
+	const maxOctets = 75
+
+	var folded strings.Builder
+
+	lineOctets := 0
+
+	for _, character := range line {
+		size := len(string(character))
+
+		if lineOctets+size > maxOctets {
+			folded.WriteString("\r\n ")
+			lineOctets = 1
+		}
+
+		folded.WriteRune(character)
+		lineOctets += size
+	}
+
+	return folded.String()
+}
@@ -0,0 +1,138 @@
+package webServer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"petServer/dataStore"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarTextIsEscapedAndFolded(t *testing.T) {
+	if escaped := escapeCalendarText("Bath, trim; nails\\paws\nbring treats"); escaped != `Bath\, trim\; nails\\paws\nbring treats` {
+		t.Errorf("unexpected escaping: %s", escaped)
+	}
+
+	line := "SUMMARY:" + strings.Repeat("é", 60)
+	folded := foldCalendarLine(line)
+
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > 75 {
+			t.Errorf("folded line is %d octets long: %q", len(part), part)
+		}
+	}
+
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != line {
+		t.Errorf("unfolding did not give back the original line: %q", unfolded)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	const filePath = "TestCalendarFeed.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	shastaID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+	gracieID := petNamed(t, store.AddPet("Gracie", "Spitz", 9), "Gracie").ID
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+
+	appointment, err := store.BookAppointment(dataStore.Appointment{PetID: shastaID, Kind: "grooming", Start: start, End: start.Add(time.Hour), Notes: "Bath, trim"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveRequest(t, mux, "POST", "/pets/"+gracieID+"/medical/vaccinations", `{"vaccine":"rabies","date_given":"2025-05-01","due_date":"2026-05-01"}`)
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Fatalf("adding a vaccination returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/calendar.ics", "")
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	body := recorder.Body.String()
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:appointment-" + appointment.ID + "@petserver\r\n",
+		"DTSTART:" + start.UTC().Format(calendarTimeLayout) + "\r\n",
+		"DESCRIPTION:Bath\\, trim\r\n",
+		"DTSTART;VALUE=DATE:20260501\r\n",
+		"SUMMARY:Gracie: rabies vaccination due\r\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected calendar to contain %q:\n%s", expected, body)
+		}
+	}
+
+	etag := recorder.Header().Get("ETag")
+
+	request, _ := http.NewRequest("GET", "/calendar.ics", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	if status := recorder.Code; status != http.StatusNotModified {
+		t.Errorf("unchanged calendar returned wrong status code: got %v want %v", status, http.StatusNotModified)
+	}
+
+	if _, err := store.CancelAppointment(appointment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("changed calendar returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if !strings.Contains(recorder.Body.String(), "STATUS:CANCELLED") {
+		t.Errorf("expected the cancelled appointment to stay in the feed as cancelled:\n%s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/calendar.ics?pet=Gracie", "")
+
+	if strings.Contains(recorder.Body.String(), "appointment-") || !strings.Contains(recorder.Body.String(), "vaccination-") {
+		t.Errorf("expected only Gracie's events:\n%s", recorder.Body.String())
+	}
+}
+
+func TestCalendarRemembersOneVersionPerFeed(t *testing.T) {
+	const filePath = "TestCalendarRemembersOneVersionPerFeed.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shastaID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+	handler := newCalendarHandler(store)
+
+	for _, target := range []string{"/calendar.ics?pet=Shasta", "/calendar.ics?pet=" + shastaID, "/calendar.ics?pet=Shasta&cache-buster=1", "/calendar.ics", "/calendar.ics?x=2"} {
+		request, err := http.NewRequest("GET", target, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := handler.HandleRequest(httptest.NewRecorder(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(handler.versions) != 2 {
+		t.Errorf("expected the versions of 2 feeds to be remembered, got %d", len(handler.versions))
+	}
+}
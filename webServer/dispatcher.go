@@ -1,11 +1,35 @@
 package webServer
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"petServer/dataStore"
+	"strings"
 )
 
+// ErrNoMatchingHandler is returned, after answering 404, when none of the handlers for
+// a request's method match it.
+var ErrNoMatchingHandler = errors.New("no handler matches the request")
+
+// ErrMethodNotAllowed is returned, after answering 405, for methods the dispatcher has
+// no handlers for.
+var ErrMethodNotAllowed = errors.New("method not allowed")
+
+// Matcher is implemented by handlers that only handle some requests, chosen by path,
+// query, headers or anything else about the request. Handlers that do not implement
+// it match every request for their method.
+type Matcher interface {
+	Matches(httpRequest *http.Request) bool
+}
+
+// Observer is implemented by handlers that want to know about requests they match but
+// do not answer because an earlier handler matched too. Observe is called once the
+// answer has been given, with its status and the error the answering handler returned.
+type Observer interface {
+	Observe(httpRequest *http.Request, status int, err error)
+}
+
 func NewDispatcher(dataStore dataStore.DataStore) (Dispatcher, error) {
 	if dataStore == nil {
 		return nil, fmt.Errorf("dataStore may not be nil")
@@ -13,14 +37,32 @@ func NewDispatcher(dataStore dataStore.DataStore) (Dispatcher, error) {
 	putHandlers := []HttpRequestHandler{&putHandler{dataStore: dataStore}}
 	getHandlers := []HttpRequestHandler{&getHandler{dataStore: dataStore}}
 	deleteHandlers := []HttpRequestHandler{&deleteHandler{dataStore: dataStore}}
+	patchHandlers := []HttpRequestHandler{&patchHandler{dataStore: dataStore}}
+	postHandlers := []HttpRequestHandler{&postHandler{dataStore: dataStore}}
 
-	return &dispatcher{putHandlers: putHandlers, getHandlers: getHandlers, deleteHandlers: deleteHandlers}, nil
+	return &dispatcher{
+		putHandlers:    putHandlers,
+		getHandlers:    getHandlers,
+		deleteHandlers: deleteHandlers,
+		patchHandlers:  patchHandlers,
+		postHandlers:   postHandlers,
+	}, nil
 }
 
+// Dispatcher hands each request to the first of the handlers for its method that
+// matches it, which alone answers; later handlers that match are told about it if they
+// are Observers. Handlers are consulted in the order they were added, but always
+// before the built-in handler for the method, so that an added handler can take over
+// the requests it matches. Requests no handler matches are answered with 404, and
+// methods without handlers with 405.
 type Dispatcher interface {
 	AddPutHandler(postHandler PutHandler)
 	AddGetHandler(getHandler GetHandler)
 	AddDeleteHandler(deleteHandler DeleteHandler)
+	AddPatchHandler(patchHandler PatchHandler)
+	AddPostHandler(postHandler PostHandler)
+	Use(middlewares ...Middleware)
+	UseForMethod(method string, middlewares ...Middleware)
 	HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error
 }
 
@@ -28,39 +70,130 @@ type dispatcher struct {
 	putHandlers    []HttpRequestHandler
 	getHandlers    []HttpRequestHandler
 	deleteHandlers []HttpRequestHandler
+	patchHandlers  []HttpRequestHandler
+	postHandlers   []HttpRequestHandler
+
+	middlewares       []Middleware
+	methodMiddlewares map[string][]Middleware
 }
 
 func (dispatcher *dispatcher) AddPutHandler(putHandler PutHandler) {
-	dispatcher.putHandlers = append(dispatcher.putHandlers, putHandler)
+	dispatcher.putHandlers = addBeforeBuiltIn(dispatcher.putHandlers, putHandler)
 }
 
 func (dispatcher *dispatcher) AddGetHandler(getHandler GetHandler) {
-	dispatcher.getHandlers = append(dispatcher.getHandlers, getHandler)
+	dispatcher.getHandlers = addBeforeBuiltIn(dispatcher.getHandlers, getHandler)
 }
 
 func (dispatcher *dispatcher) AddDeleteHandler(deleteHandler DeleteHandler) {
-	dispatcher.deleteHandlers = append(dispatcher.deleteHandlers, deleteHandler)
+	dispatcher.deleteHandlers = addBeforeBuiltIn(dispatcher.deleteHandlers, deleteHandler)
+}
+
+func (dispatcher *dispatcher) AddPatchHandler(patchHandler PatchHandler) {
+	dispatcher.patchHandlers = addBeforeBuiltIn(dispatcher.patchHandlers, patchHandler)
+}
+
+func (dispatcher *dispatcher) AddPostHandler(postHandler PostHandler) {
+	dispatcher.postHandlers = addBeforeBuiltIn(dispatcher.postHandlers, postHandler)
+}
+
+// addBeforeBuiltIn adds handler after the other added handlers but before the built-in
+// one, which is always last.
+func addBeforeBuiltIn(handlers []HttpRequestHandler, handler HttpRequestHandler) []HttpRequestHandler {
+	builtIn := handlers[len(handlers)-1]
+
+	return append(append(handlers[:len(handlers)-1:len(handlers)-1], handler), builtIn)
+}
+
+// Use wraps every request the dispatcher handles in middlewares. Middlewares run in the
+// order they are added, the first seeing the request first and the answer last, and
+// all of them run before those added with UseForMethod.
+func (dispatcher *dispatcher) Use(middlewares ...Middleware) {
+	dispatcher.middlewares = append(dispatcher.middlewares, middlewares...)
+}
+
+// UseForMethod wraps the handlers for one method, such as "PUT", in middlewares, which
+// run in the order they are added after those added with Use.
+func (dispatcher *dispatcher) UseForMethod(method string, middlewares ...Middleware) {
+	if dispatcher.methodMiddlewares == nil {
+		dispatcher.methodMiddlewares = make(map[string][]Middleware)
+	}
+
+	dispatcher.methodMiddlewares[method] = append(dispatcher.methodMiddlewares[method], middlewares...)
 }
 
 func (dispatcher *dispatcher) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
-	switch httpRequest.Method {
+	handler := HttpRequestHandlerFunc(dispatcher.dispatch)
+	middlewares := append(append([]Middleware{}, dispatcher.middlewares...), dispatcher.methodMiddlewares[httpRequest.Method]...)
+
+	return chain(handler, middlewares...).HandleRequest(responseWriter, httpRequest)
+}
+
+func (dispatcher *dispatcher) dispatch(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	handlers, ok := dispatcher.handlersFor(httpRequest.Method)
+
+	if !ok {
+		responseWriter.Header().Set("Allow", "DELETE, GET, PATCH, POST, PUT")
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("%w: %s", ErrMethodNotAllowed, httpRequest.Method)
+	}
+
+	return dispatcher.handleRequest(responseWriter, httpRequest, handlers)
+}
+
+func (dispatcher *dispatcher) handlersFor(method string) ([]HttpRequestHandler, bool) {
+	switch method {
 	case "PUT":
-		return dispatcher.handleRequest(responseWriter, httpRequest, dispatcher.putHandlers)
+		return dispatcher.putHandlers, true
 	case "GET":
-		return dispatcher.handleRequest(responseWriter, httpRequest, dispatcher.getHandlers)
+		return dispatcher.getHandlers, true
 	case "DELETE":
-		return dispatcher.handleRequest(responseWriter, httpRequest, dispatcher.deleteHandlers)
+		return dispatcher.deleteHandlers, true
+	case "POST":
+		return dispatcher.postHandlers, true
+	case "PATCH":
+		return dispatcher.patchHandlers, true
 	default:
-		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+		return nil, false
 	}
 }
 
+// handleRequest lets the first handler that matches the request answer it, then tells
+// the other matching Observers how it went.
 func (dispatcher *dispatcher) handleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request, httpRequestHandlers []HttpRequestHandler) error {
-	for _, handler := range httpRequestHandlers {
-		if err := handler.HandleRequest(responseWriter, httpRequest); err != nil {
-			return err
+	for index, handler := range httpRequestHandlers {
+		if !matches(handler, httpRequest) {
+			continue
+		}
+
+		if answering, ok := httpRequest.Context().Value(answeringHandlerContextKey).(*string); ok {
+			*answering = handlerName(handler)
 		}
+
+		tracker := trackResponse(responseWriter)
+		err := handler.HandleRequest(tracker, httpRequest)
+
+		for _, other := range httpRequestHandlers[index+1:] {
+			if observer, ok := other.(Observer); ok && matches(other, httpRequest) {
+				observer.Observe(httpRequest, tracker.statusOrOK(), err)
+			}
+		}
+
+		return err
 	}
 
-	return nil
+	responseWriter.WriteHeader(404)
+
+	return fmt.Errorf("%w: %s %s", ErrNoMatchingHandler, httpRequest.Method, httpRequest.URL.RequestURI())
+}
+
+// handlerName names a handler by its type, such as "webServer.getHandler".
+func handlerName(handler HttpRequestHandler) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", handler), "*")
+}
+
+func matches(handler HttpRequestHandler, httpRequest *http.Request) bool {
+	matcher, ok := handler.(Matcher)
+
+	return !ok || matcher.Matches(httpRequest)
 }
@@ -0,0 +1,116 @@
+package webServer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// legacyGetHandler answers GETs asking for the legacy format.
+type legacyGetHandler struct{}
+
+func (handler *legacyGetHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return handler.HandleGet(responseWriter, httpRequest)
+}
+
+func (handler *legacyGetHandler) HandleGet(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	responseWriter.WriteHeader(200)
+	_, err := fmt.Fprint(responseWriter, "legacy")
+
+	return err
+}
+
+func (handler *legacyGetHandler) Matches(httpRequest *http.Request) bool {
+	return httpRequest.Header.Get("X-Format") == "legacy"
+}
+
+// auditingGetHandler answers GETs with a name that no earlier handler matched, and
+// hears about those an earlier handler answered.
+type auditingGetHandler struct {
+	observed []string
+}
+
+func (handler *auditingGetHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return handler.HandleGet(responseWriter, httpRequest)
+}
+
+func (handler *auditingGetHandler) HandleGet(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	responseWriter.WriteHeader(200)
+	_, err := fmt.Fprint(responseWriter, "audited")
+
+	return err
+}
+
+func (handler *auditingGetHandler) Matches(httpRequest *http.Request) bool {
+	return len(httpRequest.URL.Query().Get("name")) > 0
+}
+
+func (handler *auditingGetHandler) Observe(httpRequest *http.Request, status int, err error) {
+	handler.observed = append(handler.observed, fmt.Sprintf("%s %d %v", httpRequest.URL.RequestURI(), status, err != nil))
+}
+
+func TestFirstMatchingHandlerOwnsTheResponse(t *testing.T) {
+	const filePath = "TestFirstMatchingHandlerOwnsTheResponse.json"
+
+	defer remove(filePath)
+
+	_, store := newTestMux(t, filePath)
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := &legacyGetHandler{}
+	auditing := &auditingGetHandler{}
+
+	server.Dispatcher().AddGetHandler(legacy)
+	server.Dispatcher().AddGetHandler(auditing)
+
+	mux := server.(*petServer).newMux()
+
+	recorder := negotiatedRequest(t, mux, "GET", "/pet?name=Shasta", map[string]string{"X-Format": "legacy"}, "")
+
+	if recorder.Body.String() != "legacy" {
+		t.Errorf("expected only the legacy handler to answer, got %q", recorder.Body.String())
+	}
+
+	recorder = negotiatedRequest(t, mux, "GET", "/pet?name=Shasta", nil, "")
+
+	if recorder.Body.String() != "audited" {
+		t.Errorf("expected only the auditing handler to answer, got %q", recorder.Body.String())
+	}
+
+	recorder = negotiatedRequest(t, mux, "GET", "/pet", nil, "")
+
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "Shasta") {
+		t.Errorf("expected the built-in handler to answer, got %v %q", recorder.Code, recorder.Body.String())
+	}
+
+	if expected := "/pet?name=Shasta 200 false"; len(auditing.observed) != 1 || auditing.observed[0] != expected {
+		t.Errorf("expected the auditing handler to observe %q, got %q", expected, auditing.observed)
+	}
+}
+
+func TestDispatcherAnswersWhenNothingMatches(t *testing.T) {
+	dispatcher := &dispatcher{getHandlers: []HttpRequestHandler{&legacyGetHandler{}}}
+
+	recorder := httptest.NewRecorder()
+	err := dispatcher.HandleRequest(recorder, httptest.NewRequest("GET", "/pet", nil))
+
+	if recorder.Code != http.StatusNotFound || err == nil {
+		t.Errorf("expected 404 when no handler matches, got %v %v", recorder.Code, err)
+	}
+
+	recorder = httptest.NewRecorder()
+	err = dispatcher.HandleRequest(recorder, httptest.NewRequest("OPTIONS", "/pet", nil))
+
+	if recorder.Code != http.StatusMethodNotAllowed || len(recorder.Header().Get("Allow")) == 0 || err == nil {
+		t.Errorf("expected 405 with Allow for OPTIONS, got %v %v", recorder.Code, recorder.Header())
+	}
+}
@@ -0,0 +1,102 @@
+package webServer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"petServer/dataStore"
+	"petServer/health"
+	"time"
+)
+
+// probeTimeout bounds how long the checks for a probe may take, well within the
+// timeouts orchestrators probe with.
+const probeTimeout = 5 * time.Second
+
+var ErrDraining = errors.New("server is shutting down")
+
+// registerHealthChecks makes readiness depend on the store and on the server not
+// shutting down.
+func (server *petServer) registerHealthChecks() {
+	dataStore.RegisterHealthChecks(server.dataStore, server.healthChecks)
+	server.healthChecks.Register(health.Readiness, "not-draining", health.CheckerFunc(server.checkNotDraining))
+}
+
+// checkNotDraining fails as soon as a shutdown begins, so that no new requests are sent
+// to a server about to stop taking them.
+func (server *petServer) checkNotDraining(ctx context.Context) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if server.shuttingDown {
+		return ErrDraining
+	}
+
+	return nil
+}
+
+// handleHealthz says that the process is up and answering, without running any checks.
+func (server *petServer) handleHealthz(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if err := checkProbeMethod(responseWriter, httpRequest); err != nil {
+		return err
+	}
+
+	return writeHealthReport(responseWriter, httpRequest, health.Report{Status: health.StatusOK, Checks: []health.Result{}})
+}
+
+// handleLivez runs the liveness checks, which fail when the process should be restarted.
+func (server *petServer) handleLivez(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return server.runProbe(responseWriter, httpRequest, health.Liveness)
+}
+
+// handleReadyz runs the readiness checks along with the liveness ones, as a process that
+// is not alive is not ready either.
+func (server *petServer) handleReadyz(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return server.runProbe(responseWriter, httpRequest, health.Liveness, health.Readiness)
+}
+
+func (server *petServer) runProbe(responseWriter http.ResponseWriter, httpRequest *http.Request, probes ...health.Probe) error {
+	if err := checkProbeMethod(responseWriter, httpRequest); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(httpRequest.Context(), probeTimeout)
+	defer cancel()
+
+	return writeHealthReport(responseWriter, httpRequest, server.healthChecks.Run(ctx, probes...))
+}
+
+func checkProbeMethod(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "GET" && httpRequest.Method != "HEAD" {
+		responseWriter.Header().Set("Allow", "GET, HEAD")
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("probes must be GET or HEAD, not %s", httpRequest.Method)
+	}
+
+	return nil
+}
+
+// writeHealthReport answers with report as indented JSON, for people to read as well,
+// and 200 when it is ok or 503 when it is not, which is all a probe looks at.
+func writeHealthReport(responseWriter http.ResponseWriter, httpRequest *http.Request, report health.Report) error {
+	status := http.StatusOK
+
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Header().Set("Cache-Control", "no-store")
+	responseWriter.WriteHeader(status)
+
+	if httpRequest.Method == "HEAD" {
+		return nil
+	}
+
+	encoder := json.NewEncoder(responseWriter)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
@@ -0,0 +1,151 @@
+package webServer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"petServer/auth"
+	"petServer/dataStore"
+	"petServer/health"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// probe asks url for a health report, returning its status and the status of each check.
+func probe(t *testing.T, url string) (int, map[string]string) {
+	response, err := http.Get(url)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	var report health.Report
+
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := make(map[string]string)
+
+	for _, result := range report.Checks {
+		checks[result.Name] = result.Status + result.Error
+	}
+
+	return response.StatusCode, checks
+}
+
+func TestProbingHealthReadinessAndLiveness(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestProbingHealthReadinessAndLiveness")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filepath.Join(directory, "pets.json")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewPetServer(Config{Address: "127.0.0.1:0", ShutdownDelay: 500 * time.Millisecond}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Probes are answered without credentials.
+	server.Use(AuthMiddleware(auth.DefaultPolicy()))
+
+	var stuck atomic.Bool
+
+	server.HealthChecks().Register(health.Liveness, "scheduler", health.CheckerFunc(func(ctx context.Context) error {
+		if stuck.Load() {
+			return errors.New("stuck")
+		}
+
+		return nil
+	}))
+
+	recorder := httptest.NewRecorder()
+	server.(*petServer).newMux().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a server whose store is not loaded yet not to be ready, got %v", recorder.Code)
+	}
+
+	url, _, started := startTestServer(t, server, directory)
+
+	if status, checks := probe(t, url+"/healthz"); status != http.StatusOK || len(checks) != 0 {
+		t.Errorf("expected /healthz to answer 200 without checks, got %v %v", status, checks)
+	}
+
+	if status, checks := probe(t, url+"/livez"); status != http.StatusOK || len(checks) != 1 || checks["scheduler"] != "ok" {
+		t.Errorf("expected /livez to run the liveness checks, got %v %v", status, checks)
+	}
+
+	status, checks := probe(t, url+"/readyz")
+	expected := map[string]string{"scheduler": "ok", "store-loaded": "ok", "data-file-writable": "ok", "not-draining": "ok"}
+
+	if status != http.StatusOK || len(checks) != len(expected) {
+		t.Errorf("expected /readyz to pass every check, got %v %v", status, checks)
+	}
+
+	for name, result := range expected {
+		if checks[name] != result {
+			t.Errorf("expected check %s to be %s, got %q", name, result, checks[name])
+		}
+	}
+
+	stuck.Store(true)
+
+	if status, checks := probe(t, url+"/readyz"); status != http.StatusServiceUnavailable || checks["scheduler"] != "failingstuck" {
+		t.Errorf("expected a failing liveness check to fail readiness too, got %v %v", status, checks)
+	}
+
+	stuck.Store(false)
+
+	if response, err := http.Post(url+"/readyz", "application/json", nil); err != nil || response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST /readyz to get 405, got %v %v", response, err)
+	}
+
+	go func() {
+		_ = server.Shutdown(context.Background())
+	}()
+
+	// Readiness fails while the server goes on serving for the shutdown delay.
+	for attempt := 0; ; attempt++ {
+		status, checks := probe(t, url+"/readyz")
+
+		if status == http.StatusServiceUnavailable {
+			if checks["not-draining"] != "failing"+ErrDraining.Error() {
+				t.Errorf("expected readiness to fail for draining, got %v", checks)
+			}
+
+			break
+		}
+
+		if attempt == 50 {
+			t.Fatal("expected readiness to fail once shutting down")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if status, _ := probe(t, url+"/healthz"); status != http.StatusOK {
+		t.Errorf("expected the process to be alive while draining, got %v", status)
+	}
+
+	if err := <-started; err != http.ErrServerClosed {
+		t.Errorf("expected the server to close, got %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package webServer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+const jsonPatchContentType = "application/json-patch+json"
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation does not match.
+var errPatchTestFailed = errors.New("json patch test operation failed")
+
+// applyMergePatch applies an RFC 7396 merge patch to target and returns the result.
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = applyMergePatch(targetObject[name], value)
+		}
+	}
+
+	return targetObject
+}
+
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies the RFC 6902 operations to doc in order. The first failing
+// operation aborts the whole patch.
+func applyJSONPatch(doc interface{}, operations []patchOperation) (interface{}, error) {
+	var err error
+
+	for index, operation := range operations {
+		doc, err = applyPatchOperation(doc, operation)
+
+		if err != nil {
+			if err == errPatchTestFailed {
+				return nil, err
+			}
+			return nil, fmt.Errorf("operation %d (%s): %v", index, operation.Op, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func applyPatchOperation(doc interface{}, operation patchOperation) (interface{}, error) {
+	if operation.Path == nil {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	path, err := parseJSONPointer(*operation.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+
+		var value interface{}
+
+		if err := json.Unmarshal(*operation.Value, &value); err != nil {
+			return nil, err
+		}
+
+		switch operation.Op {
+		case "add":
+			return addValue(doc, path, value)
+		case "replace":
+			if _, err := removeValue(doc, path); err != nil {
+				return nil, err
+			}
+			return addValue(doc, path, value)
+		default:
+			current, err := getValue(doc, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !reflect.DeepEqual(current, value) {
+				return nil, errPatchTestFailed
+			}
+
+			return doc, nil
+		}
+	case "remove":
+		return removeValue(doc, path)
+	case "move", "copy":
+		if operation.From == nil {
+			return nil, fmt.Errorf("missing from")
+		}
+
+		from, err := parseJSONPointer(*operation.From)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := getValue(doc, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == "move" {
+			if isProperPrefix(from, path) {
+				return nil, fmt.Errorf("cannot move a value into one of its children")
+			}
+
+			if doc, err = removeValue(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+
+		return addValue(doc, path, value)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", operation.Op)
+	}
+}
+
+func parseJSONPointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return []string{}, nil
+	}
+
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for index, token := range tokens {
+		tokens[index] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+func isProperPrefix(prefix []string, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+
+	for index := range prefix {
+		if prefix[index] != path[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	current := doc
+
+	for _, token := range path {
+		switch container := current.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", token)
+			}
+
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			current = container[index]
+		default:
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+	}
+
+	return current, nil
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[token] = value
+		return doc, nil
+	case []interface{}:
+		index := len(container)
+
+		if token != "-" {
+			if index, err = arrayIndex(token, len(container)); err != nil {
+				return nil, err
+			}
+		}
+
+		container = append(container, nil)
+		copy(container[index+1:], container[index:])
+		container[index] = value
+
+		return replaceParent(doc, path[:len(path)-1], container)
+	default:
+		return nil, fmt.Errorf("cannot add to a non-container value")
+	}
+}
+
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := container[token]; !ok {
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+
+		delete(container, token)
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container)-1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		container = append(container[:index], container[index+1:]...)
+
+		return replaceParent(doc, path[:len(path)-1], container)
+	default:
+		return nil, fmt.Errorf("path member %q not found", token)
+	}
+}
+
+// replaceParent stores an array that may have been reallocated back into its parent.
+func replaceParent(doc interface{}, path []string, array []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[token] = array
+	case []interface{}:
+		index, err := arrayIndex(token, len(container)-1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		container[index] = array
+	}
+
+	return doc, nil
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	if len(token) == 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	index, err := strconv.Atoi(token)
+
+	if err != nil || index < 0 || index > max {
+		return 0, fmt.Errorf("array index %q out of range", token)
+	}
+
+	return index, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typedValue))
+		for name, member := range typedValue {
+			result[name] = deepCopy(member)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(typedValue))
+		for index, member := range typedValue {
+			result[index] = deepCopy(member)
+		}
+		return result
+	default:
+		return value
+	}
+}
@@ -0,0 +1,257 @@
+package webServer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"petServer/dataStore"
+)
+
+var errMedicalEntryNotFound = errors.New("medical entry not found")
+
+// medicalHandler serves a pet's medical record:
+//
+//	GET    /pets/{name}/medical                    the whole record
+//	GET    /pets/{name}/medical/{kind}             one kind of entry
+//	POST   /pets/{name}/medical/{kind}             add an entry
+//	PUT    /pets/{name}/medical/{kind}/{entryID}   replace an entry
+//	DELETE /pets/{name}/medical/{kind}/{entryID}   remove an entry
+//
+// where kind is vaccinations, medications, allergies or visit_notes.
+type medicalHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *medicalHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	segments := pathSegments(httpRequest.URL.Path)
+
+	petID, status, err := resolvePetReference(handler.dataStore, segments[1])
+
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return err
+	}
+
+	record, err := handler.dataStore.MedicalRecordOf(petID)
+
+	if err != nil {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
+
+	if len(segments) == 3 {
+		if httpRequest.Method != "GET" {
+			responseWriter.WriteHeader(405)
+			return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+		}
+
+		return writeResponse(responseWriter, httpRequest, 200, record)
+	}
+
+	kind := segments[3]
+
+	if medicalEntries(record, kind) == nil || len(segments) > 5 {
+		responseWriter.WriteHeader(404)
+		return fmt.Errorf("no such medical resource: %s", httpRequest.URL.Path)
+	}
+
+	switch {
+	case len(segments) == 4 && httpRequest.Method == "GET":
+		return writeResponse(responseWriter, httpRequest, 200, medicalEntries(record, kind))
+	case len(segments) == 4 && httpRequest.Method == "POST":
+		return handler.updateRecord(responseWriter, httpRequest, petID, kind, "", 201)
+	case len(segments) == 5 && httpRequest.Method == "PUT":
+		return handler.updateRecord(responseWriter, httpRequest, petID, kind, segments[4], 200)
+	case len(segments) == 5 && httpRequest.Method == "DELETE":
+		_, err := handler.dataStore.UpdateMedicalRecord(petID, func(record dataStore.MedicalRecord) (dataStore.MedicalRecord, error) {
+			return removeMedicalEntry(record, kind, segments[4])
+		})
+
+		if err != nil {
+			responseWriter.WriteHeader(statusForMedicalError(err))
+			return err
+		}
+
+		responseWriter.WriteHeader(204)
+		return nil
+	default:
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+}
+
+// updateRecord adds the entry in the request body, or replaces the entry with entryID
+// when one is given, and answers with the entries of that kind.
+func (handler *medicalHandler) updateRecord(responseWriter http.ResponseWriter, httpRequest *http.Request, petID string, kind string, entryID string, status int) error {
+	codec, err := bodyCodec(responseWriter, httpRequest)
+
+	if err != nil {
+		return err
+	}
+
+	body, err := readBodyBytes(responseWriter, httpRequest)
+
+	if err != nil {
+		return err
+	}
+
+	decode := func(entry interface{}) error {
+		return codec.Decode(bytes.NewReader(body), entry)
+	}
+
+	record, err := handler.dataStore.UpdateMedicalRecord(petID, func(record dataStore.MedicalRecord) (dataStore.MedicalRecord, error) {
+		if len(entryID) > 0 {
+			var err error
+
+			if record, err = removeMedicalEntry(record, kind, entryID); err != nil {
+				return record, err
+			}
+		}
+
+		return addMedicalEntry(record, kind, entryID, decode)
+	})
+
+	if err != nil {
+		responseWriter.WriteHeader(statusForMedicalError(err))
+		return err
+	}
+
+	return writeResponse(responseWriter, httpRequest, status, medicalEntries(record, kind))
+}
+
+func statusForMedicalError(err error) int {
+	switch {
+	case errors.Is(err, errMedicalEntryNotFound):
+		return 404
+	case errors.Is(err, dataStore.ErrInvalidMedicalRecord):
+		return 422
+	case statusForStoreError(err) == 500:
+		// Anything else came from decoding the entry.
+		return 400
+	default:
+		return statusForStoreError(err)
+	}
+}
+
+// medicalEntries returns the entries of the given kind, or nil for an unknown kind.
+func medicalEntries(record dataStore.MedicalRecord, kind string) interface{} {
+	switch kind {
+	case "vaccinations":
+		return record.Vaccinations
+	case "medications":
+		return record.Medications
+	case "allergies":
+		return record.Allergies
+	case "visit_notes":
+		return record.VisitNotes
+	default:
+		return nil
+	}
+}
+
+// addMedicalEntry decodes an entry of the given kind with decode and appends it to
+// record with the given ID, leaving the store to assign one when id is empty.
+func addMedicalEntry(record dataStore.MedicalRecord, kind string, id string, decode func(entry interface{}) error) (dataStore.MedicalRecord, error) {
+	switch kind {
+	case "vaccinations":
+		var vaccination dataStore.Vaccination
+
+		if err := decode(&vaccination); err != nil {
+			return record, err
+		}
+
+		vaccination.ID = id
+		record.Vaccinations = append(record.Vaccinations, vaccination)
+	case "medications":
+		var medication dataStore.Medication
+
+		if err := decode(&medication); err != nil {
+			return record, err
+		}
+
+		medication.ID = id
+		record.Medications = append(record.Medications, medication)
+	case "allergies":
+		var allergy dataStore.Allergy
+
+		if err := decode(&allergy); err != nil {
+			return record, err
+		}
+
+		allergy.ID = id
+		record.Allergies = append(record.Allergies, allergy)
+	case "visit_notes":
+		var visitNote dataStore.VisitNote
+
+		if err := decode(&visitNote); err != nil {
+			return record, err
+		}
+
+		visitNote.ID = id
+		record.VisitNotes = append(record.VisitNotes, visitNote)
+	}
+
+	return record, nil
+}
+
+func removeMedicalEntry(record dataStore.MedicalRecord, kind string, id string) (dataStore.MedicalRecord, error) {
+	found := false
+
+	switch kind {
+	case "vaccinations":
+		vaccinations := []dataStore.Vaccination{}
+
+		for _, vaccination := range record.Vaccinations {
+			if vaccination.ID == id {
+				found = true
+			} else {
+				vaccinations = append(vaccinations, vaccination)
+			}
+		}
+
+		record.Vaccinations = vaccinations
+	case "medications":
+		medications := []dataStore.Medication{}
+
+		for _, medication := range record.Medications {
+			if medication.ID == id {
+				found = true
+			} else {
+				medications = append(medications, medication)
+			}
+		}
+
+		record.Medications = medications
+	case "allergies":
+		allergies := []dataStore.Allergy{}
+
+		for _, allergy := range record.Allergies {
+			if allergy.ID == id {
+				found = true
+			} else {
+				allergies = append(allergies, allergy)
+			}
+		}
+
+		record.Allergies = allergies
+	case "visit_notes":
+		visitNotes := []dataStore.VisitNote{}
+
+		for _, visitNote := range record.VisitNotes {
+			if visitNote.ID == id {
+				found = true
+			} else {
+				visitNotes = append(visitNotes, visitNote)
+			}
+		}
+
+		record.VisitNotes = visitNotes
+	}
+
+	if !found {
+		return record, errMedicalEntryNotFound
+	}
+
+	return record, nil
+}
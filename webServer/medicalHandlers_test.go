@@ -0,0 +1,70 @@
+package webServer
+
+import (
+	"encoding/json"
+	"net/http"
+	"petServer/dataStore"
+	"testing"
+)
+
+func TestRecordingVaccinations(t *testing.T) {
+	const filePath = "TestRecordingVaccinations.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	recorder := serveRequest(t, mux, "POST", "/pets/Shasta/medical/vaccinations", `{"vaccine":"Rabies","date_given":"2025-03-01","due_date":"2026-03-01","administered_by":"Dr. Lee"}`)
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Fatalf("adding vaccination returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var vaccinations []dataStore.Vaccination
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &vaccinations); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vaccinations) != 1 || len(vaccinations[0].ID) == 0 || vaccinations[0].Vaccine != "Rabies" {
+		t.Fatalf("unexpected vaccinations: %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "PUT", "/pets/Shasta/medical/vaccinations/"+vaccinations[0].ID, `{"vaccine":"Rabies","date_given":"2025-03-01","due_date":"2028-03-01"}`)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("replacing vaccination returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	recorder = serveRequest(t, mux, "POST", "/pets/Shasta/medical/allergies", `{"reaction":"hives"}`)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("adding invalid allergy returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/pets/Shasta/medical", "")
+
+	var record dataStore.MedicalRecord
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(record.Vaccinations) != 1 || record.Vaccinations[0].DueDate != "2028-03-01" || len(record.Allergies) != 0 {
+		t.Errorf("unexpected medical record: %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "DELETE", "/pets/Shasta/medical/vaccinations/"+vaccinations[0].ID, "")
+
+	if status := recorder.Code; status != http.StatusNoContent {
+		t.Errorf("removing vaccination returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/pets/Shasta/medical/rumours", "")
+
+	if status := recorder.Code; status != http.StatusNotFound {
+		t.Errorf("unknown kind returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,70 @@
+package webServer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"petServer/metrics"
+	"strconv"
+	"time"
+)
+
+// MetricsMiddleware counts and times requests in registry by route, the dispatcher
+// handler that answered, if any, method and status, and keeps track of how many are in
+// progress. It must be outside every middleware that may answer, so that their answers
+// are counted too.
+func MetricsMiddleware(registry *metrics.Registry) Middleware {
+	labels := []string{"route", "handler", "method", "status"}
+	requests := registry.NewCounter("petserver_http_requests_total", "Requests answered.", labels...)
+	durations := registry.NewHistogram("petserver_http_request_duration_seconds", "How long answering requests took.", metrics.DefaultBuckets, labels...)
+	inFlight := registry.NewGauge("petserver_http_requests_in_flight", "Requests being answered.")
+	inFlight.Set(0)
+
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			start := time.Now()
+
+			inFlight.Add(1)
+			defer inFlight.Add(-1)
+
+			answering := new(string)
+			tracker := trackResponse(responseWriter)
+			err := next.HandleRequest(tracker, httpRequest.WithContext(context.WithValue(httpRequest.Context(), answeringHandlerContextKey, answering)))
+
+			labelValues := []string{RouteOf(httpRequest), *answering, metricsMethod(httpRequest.Method), strconv.Itoa(tracker.statusOrOK())}
+			requests.Inc(labelValues...)
+			durations.Observe(time.Since(start).Seconds(), labelValues...)
+
+			return err
+		})
+	}
+}
+
+// metricsMethod keeps made-up methods from adding a label value each.
+func metricsMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS":
+		return method
+	default:
+		return "other"
+	}
+}
+
+func (server *petServer) handleMetrics(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "GET" && httpRequest.Method != "HEAD" {
+		responseWriter.Header().Set("Allow", "GET, HEAD")
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("metrics must be read with GET, not %s", httpRequest.Method)
+	}
+
+	responseWriter.Header().Set("Content-Type", metrics.ContentType)
+	responseWriter.WriteHeader(200)
+
+	if httpRequest.Method == "HEAD" {
+		return nil
+	}
+
+	_, err := server.metricsRegistry.WriteTo(responseWriter)
+
+	return err
+}
@@ -0,0 +1,87 @@
+package webServer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"petServer/dataStore"
+	"petServer/metrics"
+	"strings"
+	"testing"
+)
+
+func TestMeasuringRequestsAndTheStore(t *testing.T) {
+	const filePath = "TestMeasuringRequestsAndTheStore.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := metrics.NewRegistry()
+	store = dataStore.Instrument(store, registry)
+	store.AddPet("Shasta", "Spitz", 9)
+
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.EnableMetrics(registry)
+	server.Dispatcher().AddGetHandler(&legacyGetHandler{})
+
+	mux := server.(*petServer).newMux()
+
+	negotiatedRequest(t, mux, "GET", "/pet?name=Shasta", map[string]string{"X-Format": "legacy"}, "")
+	negotiatedRequest(t, mux, "GET", "/pet?name=Shasta", nil, "")
+	negotiatedRequest(t, mux, "GET", "/pet?name=Shasta", nil, "")
+	negotiatedRequest(t, mux, "BREW", "/pet", nil, "")
+	serveRequest(t, mux, "GET", "/owners", "")
+
+	if err := store.Store(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filePath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Load(); err == nil {
+		t.Fatal("expected loading a broken file to fail")
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("expected the metrics, got %v %v", recorder.Code, recorder.Header())
+	}
+
+	for _, expected := range []string{
+		`petserver_http_requests_total{route="/pet",handler="webServer.legacyGetHandler",method="GET",status="200"} 1`,
+		`petserver_http_requests_total{route="/pet",handler="webServer.getHandler",method="GET",status="200"} 2`,
+		`petserver_http_requests_total{route="/pet",handler="",method="other",status="405"} 1`,
+		`petserver_http_requests_total{route="/owners",handler="",method="GET",status="200"} 1`,
+		`petserver_http_request_duration_seconds_count{route="/pet",handler="webServer.getHandler",method="GET",status="200"} 2`,
+		"petserver_http_requests_in_flight 1\n",
+		"petserver_pets 1\n",
+		`petserver_store_operation_duration_seconds_count{operation="store"} 1`,
+		`petserver_store_operation_failures_total{operation="store"} 0`,
+		`petserver_store_operation_failures_total{operation="load"} 1`,
+	} {
+		if !strings.Contains(recorder.Body.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, recorder.Body.String())
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("POST", "/metrics", nil))
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST /metrics to get 405, got %v", recorder.Code)
+	}
+}
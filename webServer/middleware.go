@@ -0,0 +1,260 @@
+package webServer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"petServer/auth"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps a handler in logic that runs around it, such as logging or
+// authorization. A middleware may answer the request itself instead of calling next.
+type Middleware func(next HttpRequestHandler) HttpRequestHandler
+
+// HttpRequestHandlerFunc lets an ordinary function serve as an HttpRequestHandler.
+type HttpRequestHandlerFunc func(responseWriter http.ResponseWriter, httpRequest *http.Request) error
+
+func (handler HttpRequestHandlerFunc) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return handler(responseWriter, httpRequest)
+}
+
+// chain wraps handler in middlewares, the first being the outermost, so that the
+// middlewares see a request in the order they are given and its answer in reverse.
+func chain(handler HttpRequestHandler, middlewares ...Middleware) HttpRequestHandler {
+	for index := len(middlewares) - 1; index >= 0; index-- {
+		handler = middlewares[index](handler)
+	}
+
+	return handler
+}
+
+// responseTracker remembers the status a handler answered with and how much it wrote,
+// and can run a hook just before the header goes out.
+type responseTracker struct {
+	http.ResponseWriter
+	status       int
+	written      int64
+	beforeHeader func(header http.Header)
+}
+
+func trackResponse(responseWriter http.ResponseWriter) *responseTracker {
+	return &responseTracker{ResponseWriter: responseWriter}
+}
+
+func (tracker *responseTracker) WriteHeader(status int) {
+	if tracker.status != 0 {
+		return
+	}
+
+	tracker.status = status
+
+	if tracker.beforeHeader != nil {
+		tracker.beforeHeader(tracker.Header())
+	}
+
+	tracker.ResponseWriter.WriteHeader(status)
+}
+
+func (tracker *responseTracker) Write(data []byte) (int, error) {
+	if tracker.status == 0 {
+		tracker.WriteHeader(200)
+	}
+
+	count, err := tracker.ResponseWriter.Write(data)
+	tracker.written += int64(count)
+
+	return count, err
+}
+
+// Flush keeps streaming handlers, such as the export, streaming through middleware.
+func (tracker *responseTracker) Flush() {
+	if tracker.status == 0 {
+		tracker.WriteHeader(200)
+	}
+
+	if flusher, ok := tracker.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (tracker *responseTracker) Unwrap() http.ResponseWriter {
+	return tracker.ResponseWriter
+}
+
+// answered reports whether the handler has started its answer.
+func (tracker *responseTracker) answered() bool {
+	return tracker.status != 0
+}
+
+// statusOrOK is the status the client got, 200 when the handler wrote nothing at all.
+func (tracker *responseTracker) statusOrOK() int {
+	if tracker.status == 0 {
+		return 200
+	}
+
+	return tracker.status
+}
+
+// RequestIDHeader carries the ID of a request in and out.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs taken from clients.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware gives every request an ID, taking the client's X-Request-ID when
+// it is printable and not too long, and otherwise making one up. The ID is echoed in
+// the response and available to later middleware and handlers from RequestIDOf.
+func RequestIDMiddleware() Middleware {
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			id := httpRequest.Header.Get(RequestIDHeader)
+
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+
+			responseWriter.Header().Set(RequestIDHeader, id)
+
+			return next.HandleRequest(responseWriter, httpRequest.WithContext(context.WithValue(httpRequest.Context(), requestIDContextKey, id)))
+		})
+	}
+}
+
+// RequestIDOf returns the ID RequestIDMiddleware gave the request, or "" when it did not
+// go through it.
+func RequestIDOf(httpRequest *http.Request) string {
+	id, _ := httpRequest.Context().Value(requestIDContextKey).(string)
+
+	return id
+}
+
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, character := range id {
+		if character < '!' || character > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+
+	return hex.EncodeToString(random)
+}
+
+// LoggingMiddleware writes an access log entry for every request to logger with its
+// method, path, status, size, latency, request ID and caller, and the error the handler
+// returned, if any. Answers with a 4xx status are logged as warnings and with a 5xx
+// status as errors. The caller is whoever AuthMiddleware, which must come after it,
+// authenticated. A nil logger logs to the default logger.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			start := time.Now()
+			tracker := trackResponse(responseWriter)
+			caller := &auth.Identity{}
+
+			err := next.HandleRequest(tracker, httpRequest.WithContext(context.WithValue(httpRequest.Context(), callerContextKey, caller)))
+
+			status := tracker.statusOrOK()
+			attributes := []slog.Attr{
+				slog.String("method", httpRequest.Method),
+				slog.String("path", httpRequest.URL.RequestURI()),
+				slog.Int("status", status),
+				slog.Int64("bytes", tracker.written),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("request_id", RequestIDOf(httpRequest)),
+			}
+
+			if len(caller.Subject) > 0 {
+				attributes = append(attributes, slog.Group("caller", "subject", caller.Subject, "role", string(caller.Role), "method", caller.Method))
+			}
+
+			if err != nil {
+				attributes = append(attributes, slog.String("error", err.Error()))
+			}
+
+			level := slog.LevelInfo
+
+			if status >= 500 {
+				level = slog.LevelError
+			} else if status >= 400 {
+				level = slog.LevelWarn
+			}
+
+			logger.LogAttrs(httpRequest.Context(), level, "request", attributes...)
+
+			return err
+		})
+	}
+}
+
+// RecoveryMiddleware turns a panic in the handlers it wraps into a 500 answer, when the
+// handler had not started one, and an error, logging the stack to logger. A nil logger
+// logs to the default logger.
+func RecoveryMiddleware(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) (err error) {
+			tracker := trackResponse(responseWriter)
+
+			defer func() {
+				recovered := recover()
+
+				if recovered == nil {
+					return
+				}
+
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				logger.Error("panic serving request", "method", httpRequest.Method, "path", httpRequest.URL.RequestURI(), "request_id", RequestIDOf(httpRequest),
+					"panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+
+				if !tracker.answered() {
+					tracker.WriteHeader(500)
+				}
+
+				err = fmt.Errorf("panic: %v", recovered)
+			}()
+
+			return next.HandleRequest(tracker, httpRequest)
+		})
+	}
+}
+
+// TimingMiddleware reports how long the handlers it wraps took to start their answer
+// in a Server-Timing header named name.
+func TimingMiddleware(name string) Middleware {
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			start := time.Now()
+			tracker := trackResponse(responseWriter)
+			tracker.beforeHeader = func(header http.Header) {
+				header.Add("Server-Timing", fmt.Sprintf("%s;dur=%.3f", name, float64(time.Since(start).Microseconds())/1000))
+			}
+
+			return next.HandleRequest(tracker, httpRequest)
+		})
+	}
+}
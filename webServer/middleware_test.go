@@ -0,0 +1,261 @@
+package webServer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"petServer/auth"
+	"petServer/dataStore"
+	"petServer/logging"
+	"strings"
+	"testing"
+)
+
+// tracing records the name of the middleware as it sees the request and the answer.
+func tracing(trace *[]string, name string) Middleware {
+	return func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			*trace = append(*trace, name)
+			err := next.HandleRequest(responseWriter, httpRequest)
+			*trace = append(*trace, "/"+name)
+
+			return err
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	const filePath = "TestMiddlewareOrder.json"
+
+	defer remove(filePath)
+
+	_, store := newTestMux(t, filePath)
+	trace := []string{}
+
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Use(tracing(&trace, "server1"), tracing(&trace, "server2"))
+	server.UseForRoute("/pet", tracing(&trace, "route"))
+	server.UseForRoute("/owners", tracing(&trace, "owners"))
+	server.Dispatcher().UseForMethod("GET", tracing(&trace, "get"))
+	server.Dispatcher().UseForMethod("PUT", tracing(&trace, "put"))
+	server.Dispatcher().Use(tracing(&trace, "dispatcher"))
+
+	mux := server.(*petServer).newMux()
+	serveRequest(t, mux, "GET", "/pet", "")
+
+	expected := "server1 server2 route dispatcher get /get /dispatcher /route /server2 /server1"
+
+	if strings.Join(trace, " ") != expected {
+		t.Errorf("expected middleware to run as %q, got %q", expected, strings.Join(trace, " "))
+	}
+
+	trace = []string{}
+	serveRequest(t, mux, "GET", "/appointments", "")
+
+	if expected := "server1 server2 /server2 /server1"; strings.Join(trace, " ") != expected {
+		t.Errorf("expected middleware to run as %q, got %q", expected, strings.Join(trace, " "))
+	}
+}
+
+func TestMiddlewareCanAnswerInsteadOfHandlers(t *testing.T) {
+	const filePath = "TestMiddlewareCanAnswerInsteadOfHandlers.json"
+
+	defer remove(filePath)
+
+	_, store := newTestMux(t, filePath)
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Dispatcher().UseForMethod("DELETE", func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			responseWriter.WriteHeader(403)
+			return fmt.Errorf("deleting is not allowed")
+		})
+	})
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	recorder := serveRequest(t, server.(*petServer).newMux(), "DELETE", "/pet?name=Shasta", "")
+
+	if recorder.Code != http.StatusForbidden || len(store.AllPets().Collection) != 1 {
+		t.Errorf("expected the middleware to refuse the DELETE, got %v", recorder.Code)
+	}
+}
+
+func TestBuiltInMiddleware(t *testing.T) {
+	var logged bytes.Buffer
+
+	logger := slog.New(slog.NewJSONHandler(&logged, nil))
+	panicking := HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+		panic("kaboom")
+	})
+	handler := chain(panicking, RequestIDMiddleware(), LoggingMiddleware(logger), TimingMiddleware("app"), RecoveryMiddleware(logger))
+
+	request := httptest.NewRequest("GET", "/pet?name=Shasta", nil)
+	request.Header.Set(RequestIDHeader, "abc-123")
+
+	recorder := httptest.NewRecorder()
+
+	if err := handler.HandleRequest(recorder, request); err == nil || !strings.Contains(err.Error(), "kaboom") {
+		t.Errorf("expected the panic to be returned as an error, got %v", err)
+	}
+
+	if recorder.Code != 500 || recorder.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("expected a 500 with the request ID, got %v %v", recorder.Code, recorder.Header())
+	}
+
+	if !strings.Contains(recorder.Header().Get("Server-Timing"), "app;dur=") {
+		t.Errorf("expected a Server-Timing header, got %v", recorder.Header())
+	}
+
+	for _, expected := range []string{
+		`"level":"ERROR","msg":"panic serving request","method":"GET","path":"/pet?name=Shasta","request_id":"abc-123","panic":"kaboom","stack":"goroutine`,
+		`"level":"ERROR","msg":"request","method":"GET","path":"/pet?name=Shasta","status":500,"bytes":0,"latency_ms":`,
+		`"request_id":"abc-123","error":"panic: kaboom"}`,
+	} {
+		if !strings.Contains(logged.String(), expected) {
+			t.Errorf("expected %s in the log, got %s", expected, logged.String())
+		}
+	}
+
+	request = httptest.NewRequest("GET", "/pet", nil)
+	request.Header.Set(RequestIDHeader, "has spaces")
+
+	recorder = httptest.NewRecorder()
+
+	_ = chain(HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+		if RequestIDOf(httpRequest) != responseWriter.Header().Get(RequestIDHeader) {
+			t.Errorf("expected handlers to see the request ID")
+		}
+
+		return nil
+	}), RequestIDMiddleware()).HandleRequest(recorder, request)
+
+	if id := recorder.Header().Get(RequestIDHeader); len(id) != 32 {
+		t.Errorf("expected an invalid request ID to be replaced, got %q", id)
+	}
+}
+
+func TestAccessAndAuditLogsNameTheCaller(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestAccessAndAuditLogsNameTheCaller")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	keys, err := auth.NewKeyStore(filepath.Join(directory, "keys.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	editorKey, _, _ := keys.Create("frontDesk", auth.Editor)
+
+	auditFilePath := filepath.Join(directory, "audit.log")
+	auditLog, err := logging.OpenAuditLog(auditFilePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer auditLog.Close()
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filepath.Join(directory, "pets.json")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = dataStore.Audit(store, auditLog)
+	store.AddPet("Shasta", "Spitz", 9)
+
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logged bytes.Buffer
+
+	server.Use(RequestIDMiddleware(), LoggingMiddleware(slog.New(slog.NewJSONHandler(&logged, nil))), AuthMiddleware(auth.DefaultPolicy(), keys))
+	mux := server.(*petServer).newMux()
+
+	recorder := negotiatedRequest(t, mux, "DELETE", "/pet?name=Shasta", map[string]string{APIKeyHeader: editorKey, RequestIDHeader: "req-1"}, "")
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the DELETE to succeed, got %v", recorder.Code)
+	}
+
+	negotiatedRequest(t, mux, "GET", "/pet", nil, "")
+
+	type accessEntry struct {
+		Level     string  `json:"level"`
+		Msg       string  `json:"msg"`
+		Method    string  `json:"method"`
+		Path      string  `json:"path"`
+		Status    int     `json:"status"`
+		Bytes     int64   `json:"bytes"`
+		LatencyMS float64 `json:"latency_ms"`
+		RequestID string  `json:"request_id"`
+		Caller    struct {
+			Subject string `json:"subject"`
+			Role    string `json:"role"`
+			Method  string `json:"method"`
+		} `json:"caller"`
+		Error string `json:"error"`
+	}
+
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("expected an entry per request, got %s", logged.String())
+	}
+
+	var deleted, refused accessEntry
+
+	if err := json.Unmarshal([]byte(lines[0]), &deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &refused); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted.Level != "INFO" || deleted.Msg != "request" || deleted.Method != "DELETE" || deleted.Path != "/pet?name=Shasta" || deleted.Status != 200 ||
+		deleted.Bytes != int64(recorder.Body.Len()) || deleted.LatencyMS < 0 || deleted.RequestID != "req-1" ||
+		deleted.Caller.Subject != "frontDesk" || deleted.Caller.Role != "editor" || deleted.Caller.Method != "api-key" {
+		t.Errorf("unexpected access log entry for the DELETE: %s", lines[0])
+	}
+
+	if refused.Level != "WARN" || refused.Status != 401 || len(refused.Caller.Subject) != 0 || len(refused.Error) == 0 || len(refused.RequestID) != 32 {
+		t.Errorf("unexpected access log entry for the refused GET: %s", lines[1])
+	}
+
+	data, err := ioutil.ReadFile(auditFilePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := logging.VerifyAuditLog(bytes.NewReader(data))
+
+	if err != nil || last.Sequence != 2 || last.Action != dataStore.RemovePetAction || last.PetName != "Shasta" || last.Actor != "frontDesk" || last.RequestID != "req-1" {
+		t.Errorf("expected the removal to be audited as made by frontDesk, got %+v %v", last, err)
+	}
+}
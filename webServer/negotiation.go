@@ -0,0 +1,178 @@
+package webServer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"petServer/codecs"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	codecsContextKey contextKey = iota
+	bodyLimitContextKey
+	requestIDContextKey
+	identityContextKey
+	routeContextKey
+	answeringHandlerContextKey
+	callerContextKey
+)
+
+// DefaultMaxBodyBytes bounds request bodies on servers that have not been given
+// another limit with SetMaxBodyBytes.
+const DefaultMaxBodyBytes = 1 << 20
+
+// defaultCodecs serves requests that did not come through a petServer, as in tests
+// that call handlers directly.
+var defaultCodecs = codecs.NewDefaultRegistry()
+
+// withCodecs makes registry the one writeResponse and readBody negotiate with.
+func withCodecs(httpRequest *http.Request, registry *codecs.Registry) *http.Request {
+	return httpRequest.WithContext(context.WithValue(httpRequest.Context(), codecsContextKey, registry))
+}
+
+func codecsOf(httpRequest *http.Request) *codecs.Registry {
+	if registry, ok := httpRequest.Context().Value(codecsContextKey).(*codecs.Registry); ok {
+		return registry
+	}
+
+	return defaultCodecs
+}
+
+// withBodyLimit makes limit the most readBody will read of a request body.
+func withBodyLimit(httpRequest *http.Request, limit int64) *http.Request {
+	return httpRequest.WithContext(context.WithValue(httpRequest.Context(), bodyLimitContextKey, limit))
+}
+
+func bodyLimitOf(httpRequest *http.Request) int64 {
+	if limit, ok := httpRequest.Context().Value(bodyLimitContextKey).(int64); ok {
+		return limit
+	}
+
+	return DefaultMaxBodyBytes
+}
+
+// acceptable answers 406 and returns false when no codec suits the request's Accept
+// header.
+func acceptable(responseWriter http.ResponseWriter, httpRequest *http.Request) bool {
+	if _, ok := codecsOf(httpRequest).ForAccept(httpRequest.Header.Get("Accept")); ok {
+		return true
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	responseWriter.WriteHeader(406)
+	_, _ = fmt.Fprintf(responseWriter, "acceptable media types: %s\n", strings.Join(codecsOf(httpRequest).MediaTypes(), ", "))
+
+	return false
+}
+
+// writeResponse encodes value in the format the request's Accept header prefers,
+// answering 406 if there is none.
+func writeResponse(responseWriter http.ResponseWriter, httpRequest *http.Request, status int, value interface{}) error {
+	codec, ok := codecsOf(httpRequest).ForAccept(httpRequest.Header.Get("Accept"))
+
+	if !ok {
+		acceptable(responseWriter, httpRequest)
+		return fmt.Errorf("no acceptable media type in %q", httpRequest.Header.Get("Accept"))
+	}
+
+	var encoded bytes.Buffer
+
+	if err := codec.Encode(&encoded, value); err != nil {
+		responseWriter.WriteHeader(500)
+		return err
+	}
+
+	responseWriter.Header().Set("Content-Type", codec.MediaType)
+	responseWriter.Header().Add("Vary", "Accept")
+	responseWriter.WriteHeader(status)
+	_, _ = responseWriter.Write(encoded.Bytes())
+
+	return nil
+}
+
+// bodyCodec returns the codec for the request body's Content-Type, answering 415 if
+// there is none.
+func bodyCodec(responseWriter http.ResponseWriter, httpRequest *http.Request) (codecs.Codec, error) {
+	codec, ok := codecsOf(httpRequest).ForContentType(httpRequest.Header.Get("Content-Type"))
+
+	if !ok {
+		responseWriter.Header().Set("Accept", strings.Join(codecsOf(httpRequest).MediaTypes(), ", "))
+		responseWriter.WriteHeader(415)
+		return codecs.Codec{}, fmt.Errorf("unsupported Content-Type: %s", httpRequest.Header.Get("Content-Type"))
+	}
+
+	return codec, nil
+}
+
+// limitBody bounds the request body by the request's body limit, answering 413 and
+// returning false straight away when the Content-Length is already over it.
+func limitBody(responseWriter http.ResponseWriter, httpRequest *http.Request) bool {
+	limit := bodyLimitOf(httpRequest)
+
+	if httpRequest.ContentLength > limit {
+		responseWriter.WriteHeader(413)
+		return false
+	}
+
+	httpRequest.Body = http.MaxBytesReader(responseWriter, httpRequest.Body, limit)
+
+	return true
+}
+
+// writeBodyError answers 413 when err comes from a body over its limit and status
+// otherwise.
+func writeBodyError(responseWriter http.ResponseWriter, err error, status int) {
+	var tooLarge *http.MaxBytesError
+
+	if errors.As(err, &tooLarge) {
+		status = 413
+	}
+
+	responseWriter.WriteHeader(status)
+}
+
+// readBodyBytes reads the whole request body, answering 413 if it is over the
+// request's body limit.
+func readBodyBytes(responseWriter http.ResponseWriter, httpRequest *http.Request) ([]byte, error) {
+	if !limitBody(responseWriter, httpRequest) {
+		return nil, fmt.Errorf("request body of %d bytes is over the limit of %d", httpRequest.ContentLength, bodyLimitOf(httpRequest))
+	}
+
+	body, err := ioutil.ReadAll(httpRequest.Body)
+
+	if err != nil {
+		writeBodyError(responseWriter, err, 400)
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// readBody decodes the request body into value in the format its Content-Type names
+// as it is read, answering 415 for formats there is no codec for, 413 if the body is
+// over the request's body limit and 400 if it cannot be decoded, has fields value has
+// no place for or has anything after the value.
+func readBody(responseWriter http.ResponseWriter, httpRequest *http.Request, value interface{}) error {
+	codec, err := bodyCodec(responseWriter, httpRequest)
+
+	if err != nil {
+		return err
+	}
+
+	if !limitBody(responseWriter, httpRequest) {
+		return fmt.Errorf("request body of %d bytes is over the limit of %d", httpRequest.ContentLength, bodyLimitOf(httpRequest))
+	}
+
+	if err := codec.Decode(httpRequest.Body, value); err != nil {
+		writeBodyError(responseWriter, err, 400)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package webServer
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"petServer/codecs"
+	"petServer/dataStore"
+	"strings"
+	"testing"
+	"time"
+)
+
+func negotiatedRequest(t *testing.T, mux *http.ServeMux, method string, target string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, target, strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestNegotiatingResponseFormats(t *testing.T) {
+	const filePath = "TestNegotiatingResponseFormats.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	shastaID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+
+	recorder := negotiatedRequest(t, mux, "GET", "/pet", map[string]string{"Accept": "text/html;q=0.9, text/csv"}, "")
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("expected CSV, got %s", contentType)
+	}
+
+	if expected := "id,name,age,breed\n" + shastaID + ",Shasta,9,Spitz\n"; recorder.Body.String() != expected {
+		t.Errorf("expected %q, got %q", expected, recorder.Body.String())
+	}
+
+	recorder = negotiatedRequest(t, mux, "GET", "/pet", map[string]string{"Accept": "application/x-msgpack"}, "")
+
+	var pets dataStore.PetsCollection
+
+	if err := codecs.MessagePack.Decode(bytes.NewReader(recorder.Body.Bytes()), &pets); err != nil {
+		t.Fatal(err)
+	}
+
+	if pets.Collection[shastaID].Breed != "Spitz" {
+		t.Errorf("unexpected pets from MessagePack: %+v", pets)
+	}
+
+	recorder = negotiatedRequest(t, mux, "GET", "/pet", map[string]string{"Accept": "text/html"}, "")
+
+	if status := recorder.Code; status != http.StatusNotAcceptable {
+		t.Errorf("unacceptable GET returned wrong status code: got %v want %v", status, http.StatusNotAcceptable)
+	}
+
+	recorder = negotiatedRequest(t, mux, "POST", "/pet", map[string]string{"Accept": "text/html"}, `{"name":"Gracie"}`)
+
+	if status := recorder.Code; status != http.StatusNotAcceptable {
+		t.Errorf("unacceptable POST returned wrong status code: got %v want %v", status, http.StatusNotAcceptable)
+	}
+
+	if len(store.OnePet("Gracie").Collection) != 0 {
+		t.Error("expected an unacceptable POST not to create a pet")
+	}
+}
+
+func TestDecodingRequestFormats(t *testing.T) {
+	const filePath = "TestDecodingRequestFormats.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	yaml := "pets_collection:\n  Buttons:\n    age: 2\n    breed: Terrier\n"
+	recorder := negotiatedRequest(t, mux, "PUT", "/pet", map[string]string{"Content-Type": "application/yaml", "Accept": "application/xml"}, yaml)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("YAML PUT returned wrong status code: got %v want %v: %s", status, http.StatusOK, recorder.Body.String())
+	}
+
+	if !strings.Contains(recorder.Body.String(), "<breed>Terrier</breed>") {
+		t.Errorf("expected an XML answer, got %s", recorder.Body.String())
+	}
+
+	if pet := petNamed(t, store.AllPets(), "Buttons"); pet.Age != 2 {
+		t.Errorf("expected Buttons to be 2, got %d", pet.Age)
+	}
+
+	recorder = negotiatedRequest(t, mux, "PUT", "/pet", map[string]string{"Content-Type": "text/csv"}, "name,age,breed\nGracie,9,Spitz\n")
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("CSV PUT returned wrong status code: got %v want %v: %s", status, http.StatusOK, recorder.Body.String())
+	}
+
+	if pet := petNamed(t, store.AllPets(), "Gracie"); pet.Breed != "Spitz" {
+		t.Errorf("expected Gracie to be a Spitz, got %s", pet.Breed)
+	}
+
+	recorder = negotiatedRequest(t, mux, "PUT", "/pet", map[string]string{"Content-Type": "text/plain"}, "Buttons is 3")
+
+	if status := recorder.Code; status != http.StatusUnsupportedMediaType {
+		t.Errorf("text PUT returned wrong status code: got %v want %v", status, http.StatusUnsupportedMediaType)
+	}
+}
+
+// slowReader hands out its text a few bytes at a time with a pause before each read.
+type slowReader struct {
+	text  string
+	pause time.Duration
+}
+
+func (reader *slowReader) Read(buffer []byte) (int, error) {
+	if len(reader.text) == 0 {
+		return 0, io.EOF
+	}
+
+	time.Sleep(reader.pause)
+
+	count := copy(buffer[:min(len(buffer), 4)], reader.text)
+	reader.text = reader.text[count:]
+
+	return count, nil
+}
+
+func TestReadingRequestBodies(t *testing.T) {
+	const filePath = "TestReadingRequestBodies.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetMaxBodyBytes(256)
+
+	httpServer := httptest.NewServer(server.(*petServer).newMux())
+	defer httpServer.Close()
+
+	const petDefinition = `{"pets_collection":{"Shasta":{"age":9,"breed":"Spitz"}}}`
+
+	oversized := `{"pets_collection":{"Shasta":{"age":9,"breed":"` + strings.Repeat("Spitz", 100) + `"}}}`
+
+	tests := []struct {
+		name   string
+		body   io.Reader
+		length int64
+		status int
+	}{
+		{"sized", strings.NewReader(petDefinition), int64(len(petDefinition)), http.StatusOK},
+		{"chunked", strings.NewReader(petDefinition), -1, http.StatusOK},
+		{"slow", &slowReader{text: petDefinition, pause: time.Millisecond}, -1, http.StatusOK},
+		{"oversized", strings.NewReader(oversized), int64(len(oversized)), http.StatusRequestEntityTooLarge},
+		{"oversized chunked", strings.NewReader(oversized), -1, http.StatusRequestEntityTooLarge},
+		{"unknown field", strings.NewReader(`{"pets_collection":{},"owner":"alice"}`), -1, http.StatusBadRequest},
+		{"trailing garbage", strings.NewReader(petDefinition + `{}`), -1, http.StatusBadRequest},
+		{"truncated", strings.NewReader(petDefinition[:20]), -1, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest("PUT", httpServer.URL+"/pet", test.body)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			request.ContentLength = test.length
+			request.Header.Set("Content-Type", "application/json")
+
+			response, err := http.DefaultClient.Do(request)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_ = response.Body.Close()
+
+			if response.StatusCode != test.status {
+				t.Errorf("PUT returned wrong status code: got %v want %v", response.StatusCode, test.status)
+			}
+		})
+	}
+
+	if pet := petNamed(t, store.AllPets(), "Shasta"); pet.Breed != "Spitz" {
+		t.Errorf("expected the oversized PUT to leave Shasta a Spitz, got %q", pet.Breed)
+	}
+
+	request, err := http.NewRequest("PATCH", httpServer.URL+"/pet?name=Shasta", strings.NewReader(`{"breed":"`+strings.Repeat("Spitz", 100)+`"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Content-Type", "application/merge-patch+json")
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = response.Body.Close()
+
+	if response.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized PATCH returned wrong status code: got %v want %v", response.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,186 @@
+package webServer
+
+import (
+	"fmt"
+	"net/http"
+	"petServer/dataStore"
+)
+
+type ownersResponse struct {
+	Owners map[string]dataStore.Owner `json:"owners"`
+}
+
+type petOwnersResponse struct {
+	Owners []dataStore.OwnerOfPet `json:"owners"`
+}
+
+type ownerLinkRequest struct {
+	PetID string `json:"pet_id"`
+	Role  string `json:"role"`
+}
+
+// ownersHandler serves /owners, /owners/{id} and, through ownerPetsHandler,
+// /owners/{id}/pets.
+type ownersHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *ownersHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	segments := pathSegments(httpRequest.URL.Path)
+
+	if len(segments) == 3 && segments[2] == "pets" {
+		ownerPets := &ownerPetsHandler{dataStore: handler.dataStore}
+		return ownerPets.HandleRequest(responseWriter, httpRequest)
+	}
+
+	if len(segments) > 2 {
+		responseWriter.WriteHeader(404)
+		return fmt.Errorf("no such owner resource: %s", httpRequest.URL.Path)
+	}
+
+	id := ""
+
+	if len(segments) == 2 {
+		id = segments[1]
+	}
+
+	switch {
+	case len(id) == 0 && httpRequest.Method == "GET":
+		return writeResponse(responseWriter, httpRequest, 200, ownersResponse{Owners: handler.dataStore.AllOwners()})
+	case len(id) == 0 && httpRequest.Method == "POST":
+		return handler.handleAddOwner(responseWriter, httpRequest)
+	case len(id) > 0 && httpRequest.Method == "GET":
+		owner, err := handler.dataStore.OwnerByID(id)
+
+		if err != nil {
+			responseWriter.WriteHeader(statusForStoreError(err))
+			return err
+		}
+
+		return writeResponse(responseWriter, httpRequest, 200, owner)
+	case len(id) > 0 && httpRequest.Method == "PUT":
+		return handler.handleUpdateOwner(responseWriter, httpRequest, id)
+	case len(id) > 0 && httpRequest.Method == "DELETE":
+		if err := handler.dataStore.RemoveOwner(id); err != nil {
+			responseWriter.WriteHeader(statusForStoreError(err))
+			return err
+		}
+
+		responseWriter.WriteHeader(204)
+		return nil
+	default:
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+}
+
+func (handler *ownersHandler) handleAddOwner(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	var owner dataStore.Owner
+
+	if err := readBody(responseWriter, httpRequest, &owner); err != nil {
+		return err
+	}
+
+	owner, err := handler.dataStore.AddOwner(owner)
+
+	if err != nil {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
+
+	responseWriter.Header().Set("Location", "/owners/"+owner.ID)
+
+	return writeResponse(responseWriter, httpRequest, 201, owner)
+}
+
+func (handler *ownersHandler) handleUpdateOwner(responseWriter http.ResponseWriter, httpRequest *http.Request, id string) error {
+	var owner dataStore.Owner
+
+	if err := readBody(responseWriter, httpRequest, &owner); err != nil {
+		return err
+	}
+
+	owner.ID = id
+
+	owner, err := handler.dataStore.UpdateOwner(owner)
+
+	if err != nil {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
+
+	return writeResponse(responseWriter, httpRequest, 200, owner)
+}
+
+// ownerPetsHandler serves /owners/{id}/pets: GET lists the owner's pets, POST links a
+// pet to the owner and DELETE with a pet_id parameter unlinks it.
+type ownerPetsHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *ownerPetsHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	ownerID := pathSegments(httpRequest.URL.Path)[1]
+
+	switch httpRequest.Method {
+	case "GET":
+		petsCollection, err := handler.dataStore.PetsOfOwner(ownerID)
+
+		if err != nil {
+			responseWriter.WriteHeader(statusForStoreError(err))
+			return err
+		}
+
+		return writePets(responseWriter, httpRequest, petsCollection)
+	case "POST":
+		var link ownerLinkRequest
+
+		if err := readBody(responseWriter, httpRequest, &link); err != nil {
+			return err
+		}
+
+		if len(link.Role) == 0 {
+			link.Role = dataStore.PrimaryOwnerRole
+		}
+
+		if err := handler.dataStore.LinkPetOwner(link.PetID, ownerID, link.Role); err != nil {
+			responseWriter.WriteHeader(statusForStoreError(err))
+			return err
+		}
+
+		petsCollection, _ := handler.dataStore.PetsOfOwner(ownerID)
+
+		return writePets(responseWriter, httpRequest, petsCollection)
+	case "DELETE":
+		if err := handler.dataStore.UnlinkPetOwner(httpRequest.URL.Query().Get("pet_id"), ownerID); err != nil {
+			responseWriter.WriteHeader(statusForStoreError(err))
+			return err
+		}
+
+		responseWriter.WriteHeader(204)
+		return nil
+	default:
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+}
+
+// petOwnersHandler serves GET /pets/{name}/owners.
+type petOwnersHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *petOwnersHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "GET" {
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+
+	petID, status, err := resolvePetReference(handler.dataStore, pathSegments(httpRequest.URL.Path)[1])
+
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return err
+	}
+
+	return writeResponse(responseWriter, httpRequest, 200, petOwnersResponse{Owners: handler.dataStore.OwnersOfPet(petID)})
+}
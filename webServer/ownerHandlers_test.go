@@ -0,0 +1,145 @@
+package webServer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"petServer/dataStore"
+	"strings"
+	"testing"
+)
+
+func newTestMux(t *testing.T, filePath string) (*http.ServeMux, dataStore.DataStore) {
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	server, err := NewPetServer(Config{Address: ":0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server.(*petServer).newMux(), store
+}
+
+func serveRequest(t *testing.T, mux *http.ServeMux, method string, target string, body string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, target, strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestLinkingOwnersToPets(t *testing.T) {
+	const filePath = "TestLinkingOwnersToPets.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	petID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+
+	recorder := serveRequest(t, mux, "POST", "/owners", `{"name":"Pat","phone":"555-0100"}`)
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Fatalf("creating owner returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var owner dataStore.Owner
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &owner); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder = serveRequest(t, mux, "POST", "/owners/"+owner.ID+"/pets", `{"pet_id":"`+petID+`","role":"primary"}`)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("linking returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/pets/Shasta/owners", "")
+
+	var petOwners petOwnersResponse
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &petOwners); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(petOwners.Owners) != 1 || petOwners.Owners[0].Owner.Name != "Pat" || petOwners.Owners[0].Role != "primary" {
+		t.Errorf("unexpected owners of pet: %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/owners/"+owner.ID+"/pets", "")
+
+	if petNamed(t, decodePets(t, recorder), "Shasta").ID != petID {
+		t.Errorf("unexpected pets of owner: %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "DELETE", "/pet?id="+petID, "")
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("deleting pet returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if petsCollection, _ := store.PetsOfOwner(owner.ID); len(petsCollection.Collection) != 0 {
+		t.Error("removing a pet did not remove its owner links")
+	}
+}
+
+func TestRemovingOwnedPetIsBlocked(t *testing.T) {
+	const filePath = "TestRemovingOwnedPetIsBlocked.json"
+
+	defer remove(filePath)
+
+	mux, store := newTestMux(t, filePath)
+
+	store.SetPetRemovalPolicy(dataStore.BlockPetRemoval)
+
+	petID := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+
+	owner, err := store.AddOwner(dataStore.Owner{Name: "Pat"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.LinkPetOwner(petID, owner.ID, dataStore.EmergencyContactRole); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serveRequest(t, mux, "DELETE", "/pet?name=Shasta", "")
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("deleting owned pet returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	recorder = serveRequest(t, mux, "DELETE", "/owners/"+owner.ID, "")
+
+	if status := recorder.Code; status != http.StatusNoContent {
+		t.Errorf("deleting owner returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+
+	recorder = serveRequest(t, mux, "DELETE", "/pet?name=Shasta", "")
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("deleting unowned pet returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+}
+
+func decodePets(t *testing.T, recorder *httptest.ResponseRecorder) dataStore.PetsCollection {
+	var petsCollection dataStore.PetsCollection
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &petsCollection); err != nil {
+		t.Fatalf("could not decode %s: %v", recorder.Body.String(), err)
+	}
+
+	return petsCollection
+}
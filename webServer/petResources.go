@@ -0,0 +1,37 @@
+package webServer
+
+import (
+	"fmt"
+	"net/http"
+	"petServer/dataStore"
+)
+
+// petResourcesHandler serves /pets/{name}/{resource} by handing each request to the
+// handler registered for its resource.
+type petResourcesHandler struct {
+	resources map[string]HttpRequestHandler
+}
+
+func newPetResourcesHandler(dataStore dataStore.DataStore) *petResourcesHandler {
+	return &petResourcesHandler{
+		resources: map[string]HttpRequestHandler{
+			"owners":  &petOwnersHandler{dataStore: dataStore},
+			"medical": &medicalHandler{dataStore: dataStore},
+			"status":  &adoptionHandler{dataStore: dataStore},
+			"photos":  &photosHandler{dataStore: dataStore},
+		},
+	}
+}
+
+func (handler *petResourcesHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	segments := pathSegments(httpRequest.URL.Path)
+
+	if len(segments) >= 3 {
+		if resourceHandler, ok := handler.resources[segments[2]]; ok {
+			return resourceHandler.HandleRequest(responseWriter, httpRequest)
+		}
+	}
+
+	responseWriter.WriteHeader(404)
+	return fmt.Errorf("no such pet resource: %s", httpRequest.URL.Path)
+}
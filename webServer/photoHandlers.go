@@ -0,0 +1,186 @@
+package webServer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"petServer/dataStore"
+)
+
+// maxPhotoUploadBytes bounds the size of a whole upload request to /pets/{name}/photos.
+const maxPhotoUploadBytes = 10 << 20
+
+// photoFormField is the multipart field photos are uploaded in.
+const photoFormField = "photo"
+
+// photosHandler serves a pet's photos:
+//
+//	GET    /pets/{name}/photos                  the photos' descriptions
+//	POST   /pets/{name}/photos                  upload multipart "photo" files
+//	GET    /pets/{name}/photos/{id}             the photo itself
+//	GET    /pets/{name}/photos/{id}/thumbnail   its thumbnail
+//	DELETE /pets/{name}/photos/{id}             remove the photo
+type photosHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *photosHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	segments := pathSegments(httpRequest.URL.Path)
+
+	petID, status, err := resolvePetReference(handler.dataStore, segments[1])
+
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return err
+	}
+
+	switch {
+	case len(segments) == 3 && httpRequest.Method == "GET":
+		photos, err := handler.dataStore.PhotosOf(petID)
+
+		if err != nil {
+			responseWriter.WriteHeader(statusForPhotoError(err))
+			return err
+		}
+
+		return writeResponse(responseWriter, httpRequest, 200, photos)
+	case len(segments) == 3 && httpRequest.Method == "POST":
+		return handler.upload(responseWriter, httpRequest, petID)
+	case len(segments) == 4 && httpRequest.Method == "GET":
+		return handler.servePhoto(responseWriter, httpRequest, petID, segments[3], false)
+	case len(segments) == 5 && segments[4] == "thumbnail" && httpRequest.Method == "GET":
+		return handler.servePhoto(responseWriter, httpRequest, petID, segments[3], true)
+	case len(segments) == 4 && httpRequest.Method == "DELETE":
+		if err := handler.dataStore.RemovePhoto(petID, segments[3]); err != nil {
+			responseWriter.WriteHeader(statusForPhotoError(err))
+			return err
+		}
+
+		responseWriter.WriteHeader(204)
+		return nil
+	case len(segments) > 5 || (len(segments) == 5 && segments[4] != "thumbnail"):
+		responseWriter.WriteHeader(404)
+		return fmt.Errorf("no such photo resource: %s", httpRequest.URL.Path)
+	default:
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("do not know how to handle request of type: %s", httpRequest.Method)
+	}
+}
+
+// upload stores every file in the request's photo field, answering 413 if the request
+// is larger than maxPhotoUploadBytes.
+func (handler *photosHandler) upload(responseWriter http.ResponseWriter, httpRequest *http.Request, petID string) error {
+	httpRequest.Body = http.MaxBytesReader(responseWriter, httpRequest.Body, maxPhotoUploadBytes)
+
+	if err := httpRequest.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+
+		if errors.As(err, &tooLarge) {
+			responseWriter.WriteHeader(413)
+		} else {
+			responseWriter.WriteHeader(400)
+		}
+
+		return err
+	}
+
+	defer func() {
+		_ = httpRequest.MultipartForm.RemoveAll()
+	}()
+
+	files := httpRequest.MultipartForm.File[photoFormField]
+
+	if len(files) == 0 {
+		responseWriter.WriteHeader(400)
+		return fmt.Errorf("no %s files in upload", photoFormField)
+	}
+
+	photos := []dataStore.Photo{}
+
+	for _, fileHeader := range files {
+		file, err := fileHeader.Open()
+
+		if err != nil {
+			responseWriter.WriteHeader(500)
+			return err
+		}
+
+		data, err := ioutil.ReadAll(file)
+		_ = file.Close()
+
+		if err != nil {
+			responseWriter.WriteHeader(500)
+			return err
+		}
+
+		photo, err := handler.dataStore.AddPhoto(petID, data)
+
+		if err != nil {
+			responseWriter.WriteHeader(statusForPhotoError(err))
+			return err
+		}
+
+		photos = append(photos, photo)
+	}
+
+	responseWriter.Header().Set("Location", httpRequest.URL.Path+"/"+photos[0].ID)
+
+	return writeResponse(responseWriter, httpRequest, 201, photos)
+}
+
+// servePhoto answers with a photo or its thumbnail. Since a photo's ID is the hash of
+// its content, what is served under one URL never changes and may be cached forever.
+func (handler *photosHandler) servePhoto(responseWriter http.ResponseWriter, httpRequest *http.Request, petID string, photoID string, thumbnail bool) error {
+	filePath, contentType, err := handler.dataStore.PhotoFile(petID, photoID, thumbnail)
+
+	if err != nil {
+		responseWriter.WriteHeader(statusForPhotoError(err))
+		return err
+	}
+
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		responseWriter.WriteHeader(500)
+		return err
+	}
+
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+
+	if err != nil {
+		responseWriter.WriteHeader(500)
+		return err
+	}
+
+	etag := `"` + photoID + `"`
+
+	if thumbnail {
+		etag = `"` + photoID + `-thumbnail"`
+	}
+
+	responseWriter.Header().Set("Content-Type", contentType)
+	responseWriter.Header().Set("X-Content-Type-Options", "nosniff")
+	responseWriter.Header().Set("ETag", etag)
+	responseWriter.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+
+	http.ServeContent(responseWriter, httpRequest, "", fileInfo.ModTime(), file)
+
+	return nil
+}
+
+func statusForPhotoError(err error) int {
+	switch {
+	case errors.Is(err, dataStore.ErrPhotoNotFound):
+		return 404
+	case errors.Is(err, dataStore.ErrUnsupportedPhoto):
+		return 415
+	case errors.Is(err, dataStore.ErrInvalidPhoto):
+		return 422
+	default:
+		return statusForStoreError(err)
+	}
+}
@@ -0,0 +1,120 @@
+package webServer
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"petServer/dataStore"
+	"strings"
+	"testing"
+)
+
+func photoUploadRequest(t *testing.T, target string, data []byte) *http.Request {
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(photoFormField, "photo.jpg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = part.Write(data)
+	_ = writer.Close()
+
+	request, err := http.NewRequest("POST", target, &body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return request
+}
+
+func TestUploadingPhotos(t *testing.T) {
+	const filePath = "TestUploadingPhotos.json"
+
+	defer remove(filePath)
+	defer os.RemoveAll("TestUploadingPhotos.photos")
+
+	mux, store := newTestMux(t, filePath)
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	picture := image.NewRGBA(image.Rect(0, 0, 400, 400))
+	picture.Set(10, 10, color.White)
+
+	var encoded bytes.Buffer
+
+	if err := jpeg.Encode(&encoded, picture, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, photoUploadRequest(t, "/pets/Shasta/photos", encoded.Bytes()))
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Fatalf("upload returned wrong status code: got %v want %v: %s", status, http.StatusCreated, recorder.Body.String())
+	}
+
+	var photos []dataStore.Photo
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &photos); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(photos) != 1 || photos[0].ContentType != "image/jpeg" || photos[0].Width != 400 {
+		t.Fatalf("unexpected photos: %s", recorder.Body.String())
+	}
+
+	recorder = serveRequest(t, mux, "GET", "/pets/Shasta/photos/"+photos[0].ID+"/thumbnail", "")
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("getting thumbnail returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "image/jpeg" {
+		t.Errorf("expected a JPEG thumbnail, got %s", contentType)
+	}
+
+	if cacheControl := recorder.Header().Get("Cache-Control"); !strings.Contains(cacheControl, "immutable") || !strings.HasPrefix(cacheControl, "private") {
+		t.Errorf("expected the thumbnail to be cacheable by the client alone, got %q", cacheControl)
+	}
+
+	request, _ := http.NewRequest("GET", "/pets/Shasta/photos/"+photos[0].ID, nil)
+	request.Header.Set("If-None-Match", `"`+photos[0].ID+`"`)
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	if status := recorder.Code; status != http.StatusNotModified {
+		t.Errorf("getting cached photo returned wrong status code: got %v want %v", status, http.StatusNotModified)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, photoUploadRequest(t, "/pets/Shasta/photos", []byte("#!/bin/sh\necho not a photo\n")))
+
+	if status := recorder.Code; status != http.StatusUnsupportedMediaType {
+		t.Errorf("uploading a script returned wrong status code: got %v want %v", status, http.StatusUnsupportedMediaType)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, photoUploadRequest(t, "/pets/Shasta/photos", make([]byte, maxPhotoUploadBytes+1)))
+
+	if status := recorder.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("uploading a huge file returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+	}
+
+	recorder = serveRequest(t, mux, "DELETE", "/pets/Shasta/photos/"+photos[0].ID, "")
+
+	if status := recorder.Code; status != http.StatusNoContent {
+		t.Errorf("deleting photo returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+}
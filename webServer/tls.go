@@ -0,0 +1,217 @@
+package webServer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig says how a PetServer serves HTTPS. It serves plain HTTP when CertFile and
+// KeyFile are empty.
+type TLSConfig struct {
+	// CertFile and KeyFile hold the server's certificate chain and private key in PEM.
+	// They are read again when they change, so rotated certificates need no restart.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, when set, holds the CAs in PEM that client certificates must be
+	// signed by. Clients need not present one unless RequireClientCert is set.
+	ClientCAFile      string
+	RequireClientCert bool
+	// RedirectAddress, when set, is a host and port on which plain HTTP requests are
+	// redirected to HTTPS.
+	RedirectAddress string
+}
+
+// Enabled reports whether the server serves HTTPS.
+func (config TLSConfig) Enabled() bool {
+	return len(config.CertFile) > 0 || len(config.KeyFile) > 0
+}
+
+// Check returns an error when settings are missing that others need.
+func (config TLSConfig) Check() error {
+	switch {
+	case len(config.CertFile) == 0 && len(config.KeyFile) > 0:
+		return fmt.Errorf("a TLS key file needs a certificate file")
+	case len(config.KeyFile) == 0 && len(config.CertFile) > 0:
+		return fmt.Errorf("a TLS certificate file needs a key file")
+	case !config.Enabled() && len(config.ClientCAFile) > 0:
+		return fmt.Errorf("client certificates can only be checked when serving TLS")
+	case !config.Enabled() && len(config.RedirectAddress) > 0:
+		return fmt.Errorf("redirecting to HTTPS needs TLS")
+	case config.RequireClientCert && len(config.ClientCAFile) == 0:
+		return fmt.Errorf("requiring client certificates needs a client CA file")
+	}
+
+	return nil
+}
+
+// modernCipherSuites are the TLS 1.2 suites offered: forward secret and authenticated
+// encryption only. TLS 1.3 suites are not configurable and are all modern.
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// fileStamp tells whether a file changed since it was read.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// certificateReloader hands each TLS handshake the certificate, key and client CAs last
+// read from their files, reading them again first if any changed. Files that cannot be
+// read leave those read before in use until they change again.
+type certificateReloader struct {
+	config      TLSConfig
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	stamps      map[string]fileStamp
+	lock        sync.Mutex
+}
+
+func newCertificateReloader(config TLSConfig) (*certificateReloader, error) {
+	reloader := &certificateReloader{config: config}
+
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (reloader *certificateReloader) files() []string {
+	files := []string{reloader.config.CertFile, reloader.config.KeyFile}
+
+	if len(reloader.config.ClientCAFile) > 0 {
+		files = append(files, reloader.config.ClientCAFile)
+	}
+
+	return files
+}
+
+// reload reads the files again if any changed since they were last read.
+func (reloader *certificateReloader) reload() error {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	stamps := make(map[string]fileStamp)
+	changed := reloader.certificate == nil
+
+	for _, filePath := range reloader.files() {
+		info, err := os.Stat(filePath)
+
+		if err != nil {
+			return err
+		}
+
+		stamps[filePath] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		changed = changed || stamps[filePath] != reloader.stamps[filePath]
+	}
+
+	if !changed {
+		return nil
+	}
+
+	// A file that is being replaced is tried once, then again only once it changes.
+	reloader.stamps = stamps
+
+	certificate, err := tls.LoadX509KeyPair(reloader.config.CertFile, reloader.config.KeyFile)
+
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate %s: %w", reloader.config.CertFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+
+	if len(reloader.config.ClientCAFile) > 0 {
+		pemData, err := ioutil.ReadFile(reloader.config.ClientCAFile)
+
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+
+		if !clientCAs.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("loading client CAs: no certificates in %s", reloader.config.ClientCAFile)
+		}
+	}
+
+	reloader.certificate, reloader.clientCAs = &certificate, clientCAs
+
+	return nil
+}
+
+// tlsConfig returns the configuration to serve with, which asks for the configuration of
+// each handshake so that the files in use can change.
+func (reloader *certificateReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: reloader.configForClient,
+	}
+}
+
+func (reloader *certificateReloader) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	if err := reloader.reload(); err != nil {
+		slog.Warn("reloading the TLS certificate failed, keeping the files read before", "error", err)
+	}
+
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	config := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CipherSuites:     modernCipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		Certificates:     []tls.Certificate{*reloader.certificate},
+		NextProtos:       []string{"h2", "http/1.1"},
+	}
+
+	if reloader.clientCAs != nil {
+		config.ClientCAs = reloader.clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+
+		if reloader.config.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
+}
+
+// redirectHandler sends requests to the same host and path over HTTPS on httpsPort.
+// GETs and HEADs are moved permanently; other methods get 308 so that clients repeat
+// them with their bodies.
+func redirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) {
+		host := httpRequest.Host
+
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+
+		if httpsPort != "443" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), httpsPort)
+		}
+
+		status := http.StatusPermanentRedirect
+
+		if httpRequest.Method == "GET" || httpRequest.Method == "HEAD" {
+			status = http.StatusMovedPermanently
+		}
+
+		http.Redirect(responseWriter, httpRequest, "https://"+host+httpRequest.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,318 @@
+package webServer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"petServer/auth"
+	"petServer/dataStore"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate is a certificate made for a test with the key it was made with.
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pemData     []byte
+	keyPEMData  []byte
+}
+
+// newTestCertificate makes a certificate for commonName signed by parent, or a CA
+// certificate signing itself when parent is nil.
+func newTestCertificate(t *testing.T, commonName string, parent *testCertificate) testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.certificate, parent.key
+	}
+
+	derData, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(derData)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyData, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCertificate{
+		certificate: certificate,
+		key:         key,
+		pemData:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derData}),
+		keyPEMData:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyData}),
+	}
+}
+
+func (certificate testCertificate) tlsCertificate(t *testing.T) tls.Certificate {
+	pair, err := tls.X509KeyPair(certificate.pemData, certificate.keyPEMData)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pair
+}
+
+// writeServerCertificate replaces the server's certificate and key, making sure they
+// look changed even to file systems with coarse modification times.
+func writeServerCertificate(t *testing.T, certificate testCertificate, certFile string, keyFile string, modTime time.Time) {
+	for filePath, data := range map[string][]byte{certFile: certificate.pemData, keyFile: certificate.keyPEMData} {
+		if err := ioutil.WriteFile(filePath, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestServingTLSWithClientCertificates(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestServingTLSWithClientCertificates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	authority := newTestCertificate(t, "Pet CA", nil)
+	serverCertificate := newTestCertificate(t, "petServer", &authority)
+	client := newTestCertificate(t, "ops-bot", &authority)
+	stranger := newTestCertificate(t, "ops-bot", nil)
+
+	certFile := filepath.Join(directory, "server.pem")
+	keyFile := filepath.Join(directory, "server.key")
+	clientCAFile := filepath.Join(directory, "clients.pem")
+
+	writeServerCertificate(t, serverCertificate, certFile, keyFile, time.Now().Add(-time.Minute))
+
+	if err := ioutil.WriteFile(clientCAFile, authority.pemData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filepath.Join(directory, "pets.json")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig := TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCAFile, RedirectAddress: freeAddress(t)}
+
+	if _, err := NewPetServer(Config{Address: "127.0.0.1:0", TLS: TLSConfig{CertFile: certFile}}, store); err == nil {
+		t.Errorf("expected a certificate without a key to be refused")
+	}
+
+	server, err := NewPetServer(Config{Address: "127.0.0.1:0", TLS: tlsConfig}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Use(
+		ClientCertificateMiddleware(auth.NewSubjectMapper(map[string]auth.Role{"ops-bot": auth.Reader}, auth.NoRole)),
+		AuthMiddleware(auth.DefaultPolicy()),
+	)
+
+	url, _, started := startTestServer(t, server, directory)
+	url = strings.Replace(url, "http://", "https://", 1)
+
+	defer func() {
+		_ = server.Shutdown(context.Background())
+		<-started
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.certificate)
+
+	newClient := func(certificates []tls.Certificate, maxVersion uint16, cipherSuites []uint16) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certificates,
+			MaxVersion:   maxVersion,
+			CipherSuites: cipherSuites,
+		}}}
+	}
+
+	get := func(client *http.Client) (*http.Response, error) {
+		response, err := client.Get(url + "/pet")
+
+		if err == nil {
+			_ = response.Body.Close()
+		}
+
+		return response, err
+	}
+
+	response, err := get(newClient([]tls.Certificate{client.tlsCertificate(t)}, 0, nil))
+
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("expected a client certificate mapped to reader to read pets, got %v %v", response, err)
+	}
+
+	if response.TLS.PeerCertificates[0].SerialNumber.Cmp(serverCertificate.certificate.SerialNumber) != 0 {
+		t.Errorf("expected the server to present its certificate")
+	}
+
+	if response, err := get(newClient(nil, 0, nil)); err != nil || response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a client without credentials to get 401, got %v %v", response, err)
+	}
+
+	strangerClient := newClient(nil, 0, nil)
+	strangerClient.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		certificate := stranger.tlsCertificate(t)
+		return &certificate, nil
+	}
+
+	if response, err := get(strangerClient); err == nil {
+		t.Errorf("expected a certificate from another CA to be refused, got %v", response.StatusCode)
+	}
+
+	if _, err := get(newClient(nil, tls.VersionTLS11, nil)); err == nil {
+		t.Errorf("expected TLS 1.1 to be refused")
+	}
+
+	if _, err := get(newClient(nil, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA})); err == nil {
+		t.Errorf("expected a CBC cipher suite to be refused")
+	}
+
+	// Rotating the certificate takes effect on the next connection.
+	rotated := newTestCertificate(t, "petServer", &authority)
+	writeServerCertificate(t, rotated, certFile, keyFile, time.Now())
+
+	response, err = get(newClient([]tls.Certificate{client.tlsCertificate(t)}, 0, nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.TLS.PeerCertificates[0].SerialNumber.Cmp(rotated.certificate.SerialNumber) != 0 {
+		t.Errorf("expected the rotated certificate to be served without a restart")
+	}
+
+	// A broken certificate leaves the one read before in use.
+	if err := ioutil.WriteFile(certFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if response, err := get(newClient([]tls.Certificate{client.tlsCertificate(t)}, 0, nil)); err != nil || response.StatusCode != http.StatusOK {
+		t.Errorf("expected the certificate read before to stay in use, got %v %v", response, err)
+	}
+
+	noRedirects := &http.Client{CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	_, httpsPort, _ := net.SplitHostPort(strings.TrimPrefix(url, "https://"))
+
+	for method, expectedStatus := range map[string]int{"GET": http.StatusMovedPermanently, "POST": http.StatusPermanentRedirect} {
+		request, _ := http.NewRequest(method, "http://"+tlsConfig.RedirectAddress+"/pet?name=Shasta", nil)
+		response, err := noRedirects.Do(request)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = response.Body.Close()
+
+		if response.StatusCode != expectedStatus || response.Header.Get("Location") != "https://127.0.0.1:"+httpsPort+"/pet?name=Shasta" {
+			t.Errorf("expected %s to be redirected to HTTPS with %d, got %d %s", method, expectedStatus, response.StatusCode, response.Header.Get("Location"))
+		}
+	}
+}
+
+func TestRequiringClientCertificates(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestRequiringClientCertificates")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	authority := newTestCertificate(t, "Pet CA", nil)
+	certFile := filepath.Join(directory, "server.pem")
+	keyFile := filepath.Join(directory, "server.key")
+	clientCAFile := filepath.Join(directory, "clients.pem")
+
+	writeServerCertificate(t, newTestCertificate(t, "petServer", &authority), certFile, keyFile, time.Now())
+
+	if err := ioutil.WriteFile(clientCAFile, authority.pemData, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (TLSConfig{CertFile: certFile, KeyFile: keyFile, RequireClientCert: true}).Check(); err == nil {
+		t.Errorf("expected requiring client certificates without a CA to be refused")
+	}
+
+	reloader, err := newCertificateReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCAFile, RequireClientCert: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := reloader.configForClient(&tls.ClientHelloInfo{})
+
+	if err != nil || config.ClientAuth != tls.RequireAndVerifyClientCert || config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("expected client certificates to be required, got %+v %v", config, err)
+	}
+}
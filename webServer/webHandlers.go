@@ -1,11 +1,15 @@
 package webServer
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"petServer/dataStore"
+	"strings"
 )
 
 type HttpRequestHandler interface {
@@ -26,44 +30,78 @@ func (handler *putHandler) HandleRequest(responseWriter http.ResponseWriter, htt
 }
 
 func (handler *putHandler) HandlePut(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
-	contentLength := httpRequest.ContentLength
-	body := make([]byte, contentLength)
-	_, err := httpRequest.Body.Read(body)
+	var settingsCollection dataStore.PetsCollection
 
-	if err != nil && err != io.EOF {
-		responseWriter.WriteHeader(500)
+	if err := readBody(responseWriter, httpRequest, &settingsCollection); err != nil {
 		return err
 	}
 
-	var settingsCollection dataStore.PetsCollection
-	err = json.Unmarshal(body, &settingsCollection)
+	// Entries keyed by the ID of an existing pet replace that pet; any other key is
+	// taken to be a pet name, as in files written before pets had IDs.
+	pets := make([]dataStore.Pet, 0, len(settingsCollection.Collection))
 
-	if err != nil {
-		responseWriter.WriteHeader(500)
-		return err
+	for key, pet := range settingsCollection.Collection {
+		if len(handler.dataStore.PetByID(key).Collection) > 0 {
+			pet.ID = key
+		} else {
+			pet.ID = ""
+
+			if len(pet.Name) == 0 {
+				pet.Name = key
+			}
+		}
+
+		pets = append(pets, pet)
 	}
 
-	for name, settings := range settingsCollection.Collection {
-		handler.dataStore.AddPet(name, settings.Breed, settings.Age)
+	if _, err := actingFor(handler.dataStore, httpRequest).PutPets(pets); err != nil {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
 	}
 
-	return getAllSettings(handler.dataStore, responseWriter)
+	return getAllSettings(handler.dataStore, responseWriter, httpRequest)
 }
 
-func getAllSettings(dataStore dataStore.DataStore, responseWriter http.ResponseWriter) error {
-	pets := dataStore.AllPets()
+func getAllSettings(dataStore dataStore.DataStore, responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return writePets(responseWriter, httpRequest, dataStore.AllPets())
+}
 
-	result, err := json.Marshal(pets)
+type PostHandler interface {
+	HttpRequestHandler
+	HandlePost(responseWriter http.ResponseWriter, httpRequest *http.Request) error
+}
+
+type postHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *postHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return handler.HandlePost(responseWriter, httpRequest)
+}
+
+// HandlePost creates a single pet under a new ID and never replaces one; use PUT to
+// replace. The name must be unused unless allow_duplicate_name=true is given.
+func (handler *postHandler) HandlePost(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	var pet dataStore.Pet
+
+	if err := readBody(responseWriter, httpRequest, &pet); err != nil {
+		return err
+	}
+
+	allowDuplicateName := httpRequest.URL.Query().Get("allow_duplicate_name") == "true"
+
+	petsCollection, err := actingFor(handler.dataStore, httpRequest).CreatePet(pet, allowDuplicateName)
 
 	if err != nil {
-		responseWriter.WriteHeader(500)
+		responseWriter.WriteHeader(statusForStoreError(err))
 		return err
 	}
 
-	responseWriter.Header().Set("Content-Type", "application/json")
-	_, _ = responseWriter.Write(result)
+	for id := range petsCollection.Collection {
+		responseWriter.Header().Set("Location", "/pet?id="+url.QueryEscape(id))
+	}
 
-	return nil
+	return writeResponse(responseWriter, httpRequest, 201, petsCollection)
 }
 
 type GetHandler interface {
@@ -80,33 +118,119 @@ func (handler *getHandler) HandleRequest(responseWriter http.ResponseWriter, htt
 }
 
 func (handler *getHandler) HandleGet(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if status := httpRequest.URL.Query().Get("status"); len(status) > 0 {
+		return handler.handleGetByStatus(responseWriter, httpRequest, status)
+	}
+
+	if id := httpRequest.URL.Query().Get("id"); len(id) > 0 {
+		return writePets(responseWriter, httpRequest, handler.dataStore.PetByID(id))
+	}
+
 	name := httpRequest.URL.Query().Get("name")
 
 	if len(name) == 0 {
-		return handler.handleGetAllSettings(responseWriter)
+		return handler.handleGetAllSettings(responseWriter, httpRequest)
 	}
 
-	return handler.handleGetOneSetting(responseWriter, name)
+	return handler.handleGetOneSetting(responseWriter, httpRequest, name)
 }
 
-func (handler *getHandler) handleGetAllSettings(responseWriter http.ResponseWriter) error {
-	return getAllSettings(handler.dataStore, responseWriter)
+func (handler *getHandler) handleGetAllSettings(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return getAllSettings(handler.dataStore, responseWriter, httpRequest)
 }
 
-func (handler *getHandler) handleGetOneSetting(responseWriter http.ResponseWriter, name string) error {
-	pet := handler.dataStore.OnePet(name)
+func (handler *getHandler) handleGetOneSetting(responseWriter http.ResponseWriter, httpRequest *http.Request, name string) error {
+	return writePets(responseWriter, httpRequest, handler.dataStore.OnePet(name))
+}
 
-	result, err := json.Marshal(pet)
+// handleGetByStatus answers with the pets in the given adoption status, narrowed down
+// to those with the id or name parameter when there is one.
+func (handler *getHandler) handleGetByStatus(responseWriter http.ResponseWriter, httpRequest *http.Request, status string) error {
+	pets := handler.dataStore.PetsWithStatus(status)
+	query := httpRequest.URL.Query()
 
-	if err != nil {
-		responseWriter.WriteHeader(500)
-		return err
+	for id, pet := range pets.Collection {
+		if (len(query.Get("id")) > 0 && id != query.Get("id")) || (len(query.Get("name")) > 0 && pet.Name != query.Get("name")) {
+			delete(pets.Collection, id)
+		}
+	}
+
+	return writePets(responseWriter, httpRequest, pets)
+}
+
+func writePets(responseWriter http.ResponseWriter, httpRequest *http.Request, petsCollection dataStore.PetsCollection) error {
+	return writeResponse(responseWriter, httpRequest, 200, petsCollection)
+}
+
+// statusForStoreError maps errors returned by the data store to HTTP status codes.
+func statusForStoreError(err error) int {
+	switch {
+	case errors.Is(err, dataStore.ErrPetNotFound), errors.Is(err, dataStore.ErrOwnerNotFound), errors.Is(err, dataStore.ErrAppointmentNotFound):
+		return 404
+	case errors.Is(err, dataStore.ErrPetExists), errors.Is(err, dataStore.ErrMicrochipExists), errors.Is(err, dataStore.ErrPrimaryOwnerExists), errors.Is(err, dataStore.ErrPetHasOwners):
+		return 409
+	case errors.Is(err, dataStore.ErrAppointmentOverlap), errors.Is(err, dataStore.ErrResourceFull):
+		return 409
+	case errors.Is(err, dataStore.ErrInvalidPet), errors.Is(err, dataStore.ErrInvalidOwner), errors.Is(err, dataStore.ErrInvalidAppointment), errors.Is(err, dataStore.ErrImmutableID):
+		return 422
+	default:
+		return 500
 	}
+}
 
-	responseWriter.Header().Set("Content-Type", "application/json")
-	_, _ = responseWriter.Write(result)
+// pathSegments splits a URL path such as /owners/{id}/pets into its non-empty parts.
+func pathSegments(path string) []string {
+	segments := []string{}
+
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) > 0 {
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+// resolvePetReference finds the pet named in a URL path such as /pets/{name}/owners,
+// which may hold either the pet's ID or a name that only one pet has.
+func resolvePetReference(store dataStore.DataStore, reference string) (string, int, error) {
+	if len(store.PetByID(reference).Collection) > 0 {
+		return reference, 0, nil
+	}
 
-	return nil
+	return resolvePetID(store, url.Values{"name": []string{reference}})
+}
+
+// resolvePetID finds the pet a request refers to, either directly by its id parameter
+// or by its name parameter when exactly one pet has that name. On failure the status
+// to answer with is returned alongside the error.
+func resolvePetID(store dataStore.DataStore, query url.Values) (string, int, error) {
+	if id := query.Get("id"); len(id) > 0 {
+		if len(store.PetByID(id).Collection) == 0 {
+			return "", 404, dataStore.ErrPetNotFound
+		}
+
+		return id, 0, nil
+	}
+
+	name := query.Get("name")
+
+	if len(name) == 0 {
+		return "", 400, fmt.Errorf("id or name not found in parameters")
+	}
+
+	pets := store.OnePet(name)
+
+	switch len(pets.Collection) {
+	case 0:
+		return "", 404, dataStore.ErrPetNotFound
+	case 1:
+		for id := range pets.Collection {
+			return id, 0, nil
+		}
+	}
+
+	return "", 409, fmt.Errorf("%d pets are named %s, use id instead", len(pets.Collection), name)
 }
 
 type DeleteHandler interface {
@@ -123,24 +247,172 @@ func (handler *deleteHandler) HandleRequest(responseWriter http.ResponseWriter,
 }
 
 func (handler *deleteHandler) HandleDelete(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
-	name := httpRequest.URL.Query().Get("name")
+	id, status, err := resolvePetID(handler.dataStore, httpRequest.URL.Query())
 
-	if len(name) == 0 {
-		responseWriter.WriteHeader(400)
-		return fmt.Errorf("testPath not found in parameters")
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return err
 	}
 
-	settingsCollection := handler.dataStore.RemovePet(name)
+	petsCollection, err := actingFor(handler.dataStore, httpRequest).RemovePet(id)
 
-	result, err := json.Marshal(settingsCollection)
+	if err != nil {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
+
+	return writePets(responseWriter, httpRequest, petsCollection)
+}
+
+type PatchHandler interface {
+	HttpRequestHandler
+	HandlePatch(responseWriter http.ResponseWriter, httpRequest *http.Request) error
+}
+
+type patchHandler struct {
+	dataStore dataStore.DataStore
+}
+
+func (handler *patchHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	return handler.HandlePatch(responseWriter, httpRequest)
+}
+
+func (handler *patchHandler) HandlePatch(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	id, status, err := resolvePetID(handler.dataStore, httpRequest.URL.Query())
 
 	if err != nil {
-		responseWriter.WriteHeader(500)
+		responseWriter.WriteHeader(status)
 		return err
 	}
 
-	responseWriter.Header().Set("Content-Type", "application/json")
-	_, _ = responseWriter.Write(result)
+	contentType, _, err := mime.ParseMediaType(httpRequest.Header.Get("Content-Type"))
+
+	if err != nil || (contentType != mergePatchContentType && contentType != jsonPatchContentType) {
+		responseWriter.WriteHeader(415)
+		return fmt.Errorf("unsupported patch content type: %s", httpRequest.Header.Get("Content-Type"))
+	}
+
+	body, err := readBodyBytes(responseWriter, httpRequest)
+
+	if err != nil {
+		return err
+	}
+
+	var patch func(doc interface{}) (interface{}, error)
+
+	if contentType == mergePatchContentType {
+		var mergePatch interface{}
+
+		if err := json.Unmarshal(body, &mergePatch); err != nil {
+			responseWriter.WriteHeader(400)
+			return err
+		}
+
+		patch = func(doc interface{}) (interface{}, error) {
+			return applyMergePatch(doc, mergePatch), nil
+		}
+	} else {
+		var operations []patchOperation
+
+		if err := json.Unmarshal(body, &operations); err != nil {
+			responseWriter.WriteHeader(400)
+			return err
+		}
+
+		patch = func(doc interface{}) (interface{}, error) {
+			return applyJSONPatch(doc, operations)
+		}
+	}
+
+	petsCollection, err := actingFor(handler.dataStore, httpRequest).UpdatePet(id, func(pet dataStore.Pet) (dataStore.Pet, error) {
+		return patchPet(pet, patch)
+	})
+
+	if err != nil {
+		switch status := statusForStoreError(err); {
+		case err == errPatchTestFailed:
+			responseWriter.WriteHeader(409)
+		case status == 500:
+			// Anything else went wrong applying the patch itself.
+			responseWriter.WriteHeader(422)
+		default:
+			responseWriter.WriteHeader(status)
+		}
+		return err
+	}
+
+	return writePets(responseWriter, httpRequest, petsCollection)
+}
+
+// patchPet runs patch against the JSON form of pet and decodes the result back into
+// a Pet, refusing members that Pet does not know about.
+func patchPet(pet dataStore.Pet, patch func(doc interface{}) (interface{}, error)) (dataStore.Pet, error) {
+	serializedPet, err := json.Marshal(pet)
+
+	if err != nil {
+		return pet, err
+	}
+
+	var doc interface{}
+
+	if err := json.Unmarshal(serializedPet, &doc); err != nil {
+		return pet, err
+	}
+
+	doc, err = patch(doc)
+
+	if err != nil {
+		return pet, err
+	}
+
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return pet, fmt.Errorf("patched pet must be a JSON object")
+	}
+
+	serializedPet, err = json.Marshal(doc)
+
+	if err != nil {
+		return pet, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(serializedPet))
+	decoder.DisallowUnknownFields()
+
+	var patchedPet dataStore.Pet
+
+	if err := decoder.Decode(&patchedPet); err != nil {
+		return pet, err
+	}
+
+	return patchedPet, nil
+}
+
+type renameHandler struct {
+	dataStore dataStore.DataStore
+}
+
+// HandleRequest renames the pet given by id or name to the name in the to parameter.
+func (handler *renameHandler) HandleRequest(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "POST" {
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("rename must be a POST, not %s", httpRequest.Method)
+	}
+
+	query := httpRequest.URL.Query()
+	newName := query.Get("to")
+	id, status, err := resolvePetID(handler.dataStore, query)
+
+	if err != nil {
+		responseWriter.WriteHeader(status)
+		return err
+	}
+
+	petsCollection, err := actingFor(handler.dataStore, httpRequest).RenamePet(id, newName)
+
+	if err != nil {
+		responseWriter.WriteHeader(statusForStoreError(err))
+		return err
+	}
 
-	return nil
+	return writePets(responseWriter, httpRequest, petsCollection)
 }
@@ -2,67 +2,522 @@ package webServer
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"petServer/codecs"
 	"petServer/dataStore"
+	"petServer/health"
+	"petServer/metrics"
+	"strings"
 	"sync"
+	"time"
 )
 
-func NewPetServer(port string, dataStore dataStore.DataStore) (PetServer, error) {
-	if len(port) == 0 {
-		return nil, fmt.Errorf("port may not be empty")
+// DefaultAdminAddress is where the admin listener, which serves /close, listens unless
+// told otherwise with SetAdminAddress.
+const DefaultAdminAddress = "localhost:8081"
+
+// DefaultDrainTimeout is how long a shutdown waits for requests in progress to finish
+// unless told otherwise with SetDrainTimeout.
+const DefaultDrainTimeout = 30 * time.Second
+
+// Config says where a PetServer listens and how it treats requests. Settings left at
+// their zero value take the defaults.
+type Config struct {
+	// Address is the host and port requests are served on, such as ":8080".
+	Address string
+	// AdminAddress is where /close is served, as for SetAdminAddress;
+	// DefaultAdminAddress when empty.
+	AdminAddress string
+	// DrainTimeout is as for SetDrainTimeout; DefaultDrainTimeout when zero.
+	DrainTimeout time.Duration
+	// ShutdownDelay is how long a shutdown goes on serving, with /readyz failing, before
+	// it stops accepting requests, so that load balancers probing it stop sending them.
+	ShutdownDelay time.Duration
+	// MaxBodyBytes is as for SetMaxBodyBytes; DefaultMaxBodyBytes when zero.
+	MaxBodyBytes int64
+	// MaxImportBytes bounds requests to /pets/import; DefaultMaxImportBytes when zero.
+	MaxImportBytes int64
+	// TLS, when it has a certificate, makes the server serve HTTPS.
+	TLS TLSConfig
+}
+
+func NewPetServer(config Config, dataStore dataStore.DataStore) (PetServer, error) {
+	if len(config.Address) == 0 {
+		return nil, fmt.Errorf("address may not be empty")
 	}
 
 	if dataStore == nil {
 		return nil, fmt.Errorf("dataStore may not be nil")
 	}
 
+	if len(config.AdminAddress) == 0 {
+		config.AdminAddress = DefaultAdminAddress
+	}
+
+	if err := CheckAdminAddress(config.AdminAddress); err != nil {
+		return nil, err
+	}
+
+	if config.DrainTimeout == 0 {
+		config.DrainTimeout = DefaultDrainTimeout
+	}
+
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	if config.MaxImportBytes == 0 {
+		config.MaxImportBytes = DefaultMaxImportBytes
+	}
+
+	if err := config.TLS.Check(); err != nil {
+		return nil, err
+	}
+
+	var certificates *certificateReloader
+
+	if config.TLS.Enabled() {
+		var err error
+
+		if certificates, err = newCertificateReloader(config.TLS); err != nil {
+			return nil, err
+		}
+	}
+
 	dispatcher, err := NewDispatcher(dataStore)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &petServer{
-		port:       port,
-		httpServer: nil,
-		dispatcher: dispatcher,
-		dataStore:  dataStore,
-	}, nil
+	server := &petServer{
+		address:         config.Address,
+		certificates:    certificates,
+		redirectAddress: config.TLS.RedirectAddress,
+		httpServer:      nil,
+		dispatcher:      dispatcher,
+		dataStore:       dataStore,
+		codecs:          codecs.NewDefaultRegistry(),
+		maxBodyBytes:    config.MaxBodyBytes,
+		maxImportBytes:  config.MaxImportBytes,
+		adminAddress:    config.AdminAddress,
+		drainTimeout:    config.DrainTimeout,
+		shutdownDelay:   config.ShutdownDelay,
+		healthChecks:    health.NewRegistry(),
+		shutdownDone:    make(chan struct{}),
+	}
+
+	server.registerHealthChecks()
+
+	return server, nil
+}
+
+// Service is a background task, such as the reminder scheduler, that runs for as long
+// as the server does.
+type Service interface {
+	Start() error
+	Stop()
 }
 
 type PetServer interface {
+	AddService(service Service)
+	RegisterCodec(codec codecs.Codec)
+	SetMaxBodyBytes(limit int64)
+	Use(middlewares ...Middleware)
+	UseForRoute(pattern string, middlewares ...Middleware)
+	Dispatcher() Dispatcher
+	SetAdminAddress(address string) error
+	SetDrainTimeout(timeout time.Duration)
+	EnableMetrics(registry *metrics.Registry)
+	HealthChecks() *health.Registry
 	Start() error
-	Stop(responseWriter http.ResponseWriter, httpRequest *http.Request)
+	Shutdown(ctx context.Context) error
 	HandlePetInfo(responseWriter http.ResponseWriter, httpRequest *http.Request)
 }
 
 type petServer struct {
-	port       string
-	httpServer *http.Server
-	dispatcher Dispatcher
-	dataStore  dataStore.DataStore
-	lock       sync.Mutex
+	address          string
+	httpServer       *http.Server
+	dispatcher       Dispatcher
+	dataStore        dataStore.DataStore
+	services         []Service
+	codecs           *codecs.Registry
+	maxBodyBytes     int64
+	maxImportBytes   int64
+	middlewares      []Middleware
+	routeMiddlewares map[string][]Middleware
+	adminAddress     string
+	adminServer      *http.Server
+	certificates     *certificateReloader
+	redirectAddress  string
+	redirectServer   *http.Server
+	metrics          Middleware
+	metricsRegistry  *metrics.Registry
+	healthChecks     *health.Registry
+	listenAddress    net.Addr
+	drainTimeout     time.Duration
+	shutdownDelay    time.Duration
+	shuttingDown     bool
+	shutdownOnce     sync.Once
+	shutdownDone     chan struct{}
+	shutdownErr      error
+	lock             sync.Mutex
+}
+
+func (server *petServer) AddService(service Service) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.services = append(server.services, service)
+}
+
+// RegisterCodec adds a format responses can be negotiated into and request bodies read
+// from, replacing any codec for the same media type. It must be called before Start.
+func (server *petServer) RegisterCodec(codec codecs.Codec) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.codecs.Register(codec)
 }
 
+// SetMaxBodyBytes bounds the bodies of requests decoded by handlers, which are answered
+// with 413 when they are larger. Photo uploads and imports have their own limits. It
+// must be called before Start.
+func (server *petServer) SetMaxBodyBytes(limit int64) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.maxBodyBytes = limit
+}
+
+// Use wraps every route in middlewares, which run in the order they are added, the
+// first seeing the request first and the answer last, before those added for the route
+// with UseForRoute. Requests to /pet then go on through the dispatcher's middleware.
+// It must be called before Start.
+func (server *petServer) Use(middlewares ...Middleware) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.middlewares = append(server.middlewares, middlewares...)
+}
+
+// UseForRoute wraps the route registered for pattern, such as "/pets/", in
+// middlewares, which run in the order they are added after those added with Use. It
+// must be called before Start.
+func (server *petServer) UseForRoute(pattern string, middlewares ...Middleware) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if server.routeMiddlewares == nil {
+		server.routeMiddlewares = make(map[string][]Middleware)
+	}
+
+	server.routeMiddlewares[pattern] = append(server.routeMiddlewares[pattern], middlewares...)
+}
+
+// Dispatcher returns the dispatcher serving /pet, to add handlers and per-method
+// middleware to.
+func (server *petServer) Dispatcher() Dispatcher {
+	return server.dispatcher
+}
+
+// SetAdminAddress moves the admin listener, which serves /close, to address: a host
+// and port on the loopback interface, such as "localhost:8081", or "unix:" followed by
+// the path of a socket. It must be called before Start.
+func (server *petServer) SetAdminAddress(address string) error {
+	if err := CheckAdminAddress(address); err != nil {
+		return err
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.adminAddress = address
+
+	return nil
+}
+
+// CheckAdminAddress returns an error unless address is one the admin listener may use.
+func CheckAdminAddress(address string) error {
+	if strings.HasPrefix(address, "unix:") {
+		if len(strings.TrimPrefix(address, "unix:")) == 0 {
+			return fmt.Errorf("admin socket path may not be empty")
+		}
+
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return fmt.Errorf("admin address: %w", err)
+	}
+
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("admin address must be on localhost or a unix socket, not %q", address)
+	}
+
+	return nil
+}
+
+// EnableMetrics measures every request in registry and serves registry's metrics on
+// /metrics. It must be called before Start.
+func (server *petServer) EnableMetrics(registry *metrics.Registry) {
+	middleware := MetricsMiddleware(registry)
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.metrics, server.metricsRegistry = middleware, registry
+}
+
+// HealthChecks returns the checks /livez and /readyz run, for subsystems to register
+// theirs with. The store's and the server's own are registered already.
+func (server *petServer) HealthChecks() *health.Registry {
+	return server.healthChecks
+}
+
+// SetDrainTimeout bounds how long a shutdown waits for requests in progress before
+// closing their connections. It must be called before Start.
+func (server *petServer) SetDrainTimeout(timeout time.Duration) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.drainTimeout = timeout
+}
+
+// Start loads the data and serves until the server is shut down, then returns
+// http.ErrServerClosed once the shutdown has finished. Data that cannot be loaded is an
+// error, but a missing pets file just means starting without pets. If serving fails
+// the server is shut down before the error is returned.
 func (server *petServer) Start() error {
-	_ = server.dataStore.Load()
+	if err := server.dataStore.Load(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("loading the data: %w", err)
+	}
+
+	listeners, err := server.newServers()
+
+	if err != nil {
+		return err
+	}
+
+	if err := server.startServices(); err != nil {
+		listeners.close()
+		return err
+	}
+
+	go func() {
+		if err := server.adminServer.Serve(listeners.admin); err != http.ErrServerClosed {
+			slog.Error("admin server failed", "error", err)
+		}
+	}()
 
-	server.newServer()
+	if listeners.redirect != nil {
+		go func() {
+			if err := server.redirectServer.Serve(listeners.redirect); err != http.ErrServerClosed {
+				slog.Error("redirect server failed", "error", err)
+			}
+		}()
+	}
+
+	if server.certificates != nil {
+		err = server.httpServer.ServeTLS(listeners.main, "", "")
+	} else {
+		err = server.httpServer.Serve(listeners.main)
+	}
 
-	return server.httpServer.ListenAndServe()
+	// Serving failed on its own: the admin and redirect servers and the services are
+	// stopped, and the data stored, as on any other shutdown.
+	if err != http.ErrServerClosed {
+		if shutdownErr := server.Shutdown(context.Background()); shutdownErr != nil {
+			slog.Error("shutdown after serving failed did not finish cleanly", "error", shutdownErr)
+		}
+
+		return err
+	}
+
+	<-server.shutdownDone
+
+	return http.ErrServerClosed
+}
+
+func (server *petServer) startServices() error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	for index, service := range server.services {
+		if err := service.Start(); err != nil {
+			for _, started := range server.services[:index] {
+				started.Stop()
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newServers makes the servers and their listeners, unless the server is already
+// shutting down.
+// listeners are what a server listens on: the main listener, the admin listener and,
+// when redirecting to HTTPS, the redirect listener.
+type listeners struct {
+	main     net.Listener
+	admin    net.Listener
+	redirect net.Listener
+}
+
+func (listeners listeners) close() {
+	for _, listener := range []net.Listener{listeners.main, listeners.admin, listeners.redirect} {
+		if listener != nil {
+			_ = listener.Close()
+		}
+	}
 }
 
-func (server *petServer) newServer() {
+func (server *petServer) newServers() (listeners, error) {
 	server.lock.Lock()
 	defer server.lock.Unlock()
 
+	if server.shuttingDown {
+		return listeners{}, http.ErrServerClosed
+	}
+
+	var opened listeners
+	var err error
+
+	if opened.main, err = net.Listen("tcp", server.address); err != nil {
+		return listeners{}, err
+	}
+
+	if opened.admin, err = listenAdmin(server.adminAddress); err != nil {
+		opened.close()
+		return listeners{}, err
+	}
+
+	if len(server.redirectAddress) > 0 {
+		if opened.redirect, err = net.Listen("tcp", server.redirectAddress); err != nil {
+			opened.close()
+			return listeners{}, err
+		}
+
+		_, httpsPort, _ := net.SplitHostPort(opened.main.Addr().String())
+		server.redirectServer = &http.Server{Handler: redirectHandler(httpsPort), ReadHeaderTimeout: 10 * time.Second}
+	}
+
+	server.listenAddress = opened.main.Addr()
+	server.httpServer = &http.Server{Handler: server.newMux()}
+	server.adminServer = &http.Server{Handler: server.newAdminMux()}
+
+	if server.certificates != nil {
+		server.httpServer.TLSConfig = server.certificates.tlsConfig()
+	}
+
+	return opened, nil
+}
+
+func listenAdmin(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		return net.Listen("tcp", address)
+	}
+
+	socketPath := strings.TrimPrefix(address, "unix:")
+
+	if info, err := os.Lstat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(socketPath)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func (server *petServer) newMux() *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/close", server.Stop)
-	mux.HandleFunc("/pet", server.HandlePetInfo)
+	server.route(mux, "/pet", server.negotiated(HttpRequestHandlerFunc(server.dispatch)))
+	server.route(mux, "/pet/rename", server.negotiated(&renameHandler{dataStore: server.dataStore}))
+	server.route(mux, "/owners", server.negotiated(&ownersHandler{dataStore: server.dataStore}))
+	server.route(mux, "/owners/", server.negotiated(&ownersHandler{dataStore: server.dataStore}))
+	server.route(mux, "/pets/", server.negotiated(newPetResourcesHandler(server.dataStore)))
+	server.route(mux, "/pets/import", server.negotiated(&importHandler{dataStore: server.dataStore, maxBytes: server.maxImportBytes}))
+	server.route(mux, "/pets/export", server.negotiated(&exportHandler{dataStore: server.dataStore}))
+	server.route(mux, "/appointments", server.negotiated(&appointmentsHandler{dataStore: server.dataStore}))
+	server.route(mux, "/appointments/", server.negotiated(&appointmentsHandler{dataStore: server.dataStore}))
+	server.route(mux, "/calendar.ics", server.negotiated(newCalendarHandler(server.dataStore)))
 
-	server.httpServer = &http.Server{Addr: server.port, Handler: mux}
+	if server.metricsRegistry != nil {
+		server.route(mux, "/metrics", HttpRequestHandlerFunc(server.handleMetrics))
+	}
+
+	server.probeRoute(mux, "/healthz", server.handleHealthz)
+	server.probeRoute(mux, "/livez", server.handleLivez)
+	server.probeRoute(mux, "/readyz", server.handleReadyz)
+
+	return mux
+}
+
+// newAdminMux serves the routes only the admin listener offers.
+func (server *petServer) newAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	server.route(mux, "/close", server.negotiated(HttpRequestHandlerFunc(server.handleClose)))
+
+	return mux
+}
+
+// route serves pattern with handler wrapped in the metrics middleware, if metrics are
+// enabled, the server's middleware and then the route's.
+func (server *petServer) route(mux *http.ServeMux, pattern string, handler HttpRequestHandler) {
+	middlewares := append(append([]Middleware{}, server.middlewares...), server.routeMiddlewares[pattern]...)
+
+	if server.metrics != nil {
+		middlewares = append([]Middleware{server.metrics}, middlewares...)
+	}
+
+	server.handle(mux, pattern, chain(handler, middlewares...))
+}
+
+// probeRoute serves pattern with handler wrapped in the metrics middleware only, as
+// orchestrators probe without credentials and their probes need no logging.
+func (server *petServer) probeRoute(mux *http.ServeMux, pattern string, handler HttpRequestHandlerFunc) {
+	middlewares := []Middleware{}
+
+	if server.metrics != nil {
+		middlewares = append(middlewares, server.metrics)
+	}
+
+	server.handle(mux, pattern, chain(handler, middlewares...))
+}
+
+// handle serves pattern with handler. Every request carries its route and the server's
+// codecs and body limit from the start, so middleware can answer in a negotiated format
+// too.
+func (server *petServer) handle(mux *http.ServeMux, pattern string, handler HttpRequestHandler) {
+	mux.HandleFunc(pattern, func(responseWriter http.ResponseWriter, httpRequest *http.Request) {
+		httpRequest = httpRequest.WithContext(context.WithValue(httpRequest.Context(), routeContextKey, pattern))
+		_ = handler.HandleRequest(responseWriter, server.withSettings(httpRequest))
+	})
+}
+
+// RouteOf returns the pattern of the route serving the request, such as "/pets/".
+func RouteOf(httpRequest *http.Request) string {
+	route, _ := httpRequest.Context().Value(routeContextKey).(string)
+
+	return route
 }
 
 /*
@@ -70,31 +525,124 @@ curl --header "Content-Type: application/json" -X PUT --data '{"pets_collection"
 curl http://localhost:8080/pet
 curl http://localhost:8080/pet?name=Buttons
 curl -X DELETE http://localhost:8080/pet?name=Shastas
-curl -X PUT http://localhost:8080/close
+curl -X POST http://localhost:8081/close
 */
+// HandlePetInfo serves /pet through the dispatcher, without the server's middleware.
 func (server *petServer) HandlePetInfo(responseWriter http.ResponseWriter, httpRequest *http.Request) {
-	if err := server.dispatcher.HandleRequest(responseWriter, httpRequest); err != nil {
-		responseWriter.WriteHeader(500)
+	_ = server.negotiated(HttpRequestHandlerFunc(server.dispatch)).HandleRequest(responseWriter, server.withSettings(httpRequest))
+}
+
+func (server *petServer) dispatch(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	tracker := trackResponse(responseWriter)
+	err := server.dispatcher.HandleRequest(tracker, httpRequest)
+
+	if err != nil && !tracker.answered() {
+		tracker.WriteHeader(500)
 	}
+
+	return err
 }
 
-func (server *petServer) Stop(responseWriter http.ResponseWriter, httpRequest *http.Request) {
-	if httpRequest.Method == "PUT" {
-		server.lock.Lock()
-		defer server.lock.Unlock()
+// withSettings hands the server's codecs and body limit to the handlers.
+func (server *petServer) withSettings(httpRequest *http.Request) *http.Request {
+	return withBodyLimit(withCodecs(httpRequest, server.codecs), server.maxBodyBytes)
+}
 
-		if err := server.dataStore.Store(); err != nil {
-			log.Printf("storing failed with error: %+v\n", err)
+// negotiated refuses requests that may change something with 406 up front when their
+// answer could not be encoded, so that nothing is changed for a client that cannot read
+// the result.
+func (server *petServer) negotiated(handler HttpRequestHandler) HttpRequestHandler {
+	return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+		if httpRequest.Method != "GET" && httpRequest.Method != "HEAD" && !acceptable(responseWriter, httpRequest) {
+			return fmt.Errorf("no acceptable media type in %q", httpRequest.Header.Get("Accept"))
 		}
 
-		if err := server.httpServer.Shutdown(context.Background()); err != nil {
-			log.Printf("HTTP server Shutdown: %+v\n", err)
+		return handler.HandleRequest(responseWriter, httpRequest)
+	})
+}
+
+// handleClose starts a shutdown on a POST or PUT and answers 202 straight away, as
+// the shutdown waits for requests in progress, this one included, to finish. Asking
+// again while a shutdown is under way is answered the same way.
+func (server *petServer) handleClose(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+	if httpRequest.Method != "POST" && httpRequest.Method != "PUT" {
+		responseWriter.Header().Set("Allow", "POST, PUT")
+		responseWriter.WriteHeader(405)
+		return fmt.Errorf("close must be a POST or PUT, not %s", httpRequest.Method)
+	}
+
+	go func() {
+		if err := server.Shutdown(context.Background()); err != nil {
+			slog.Error("shutdown failed", "error", err)
 		}
+	}()
 
-		if err := server.httpServer.Close(); err != nil {
-			log.Printf("HTTP server Close: %+v\n", err)
+	return writeResponse(responseWriter, httpRequest, 202, map[string]string{"status": "shutting down"})
+}
+
+// Shutdown stops the server: it fails readiness straight away, goes on serving for the
+// shutdown delay, then stops accepting requests, waits up to the drain timeout for
+// those in progress, stops the services and stores the data. Only the first call
+// does this; every call waits for it to finish, or for ctx to be done, and returns the
+// error storing the data failed with.
+func (server *petServer) Shutdown(ctx context.Context) error {
+	server.shutdownOnce.Do(func() {
+		server.lock.Lock()
+		server.shuttingDown = true
+		server.lock.Unlock()
+
+		go server.shutdown()
+	})
+
+	select {
+	case <-server.shutdownDone:
+		return server.shutdownErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (server *petServer) shutdown() {
+	defer close(server.shutdownDone)
+
+	server.lock.Lock()
+	httpServers := []*http.Server{server.httpServer, server.adminServer, server.redirectServer}
+	services := server.services
+	drainTimeout := server.drainTimeout
+	shutdownDelay := server.shutdownDelay
+	server.lock.Unlock()
+
+	// There is nobody to tell about failing readiness when the server never started.
+	if httpServers[0] != nil {
+		time.Sleep(shutdownDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	for _, httpServer := range httpServers {
+		if httpServer == nil {
+			continue
+		}
+
+		if err := httpServer.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+			slog.Warn("requests still in progress after the drain timeout, closing them", "drain_timeout", drainTimeout.String())
+			_ = httpServer.Close()
+		} else if err != nil {
+			slog.Error("HTTP server shutdown failed", "error", err)
 		}
+	}
+
+	for _, service := range services {
+		service.Stop()
+	}
 
-		server.httpServer = nil
+	// What a store that was never loaded holds would replace the data files' contents.
+	if err := server.dataStore.CheckLoaded(); err != nil {
+		slog.Error("not storing the data, as it was never loaded", "error", err)
+		server.shutdownErr = err
+	} else if err := server.dataStore.Store(); err != nil {
+		slog.Error("storing the data failed", "error", err)
+		server.shutdownErr = err
 	}
 }
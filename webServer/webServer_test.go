@@ -1,12 +1,18 @@
 package webServer
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"petServer/dataStore"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestWritingThenReadingPetSettings(t *testing.T) {
@@ -61,7 +67,7 @@ func TestGettingUndefinedPet(t *testing.T) {
 	_ = os.Remove(settingsFilePath)
 	defer remove(settingsFilePath)
 
-	store, err := dataStore.NewDataStore(settingsFilePath)
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: settingsFilePath})
 
 	if err != nil {
 		t.Fatal(err)
@@ -80,7 +86,7 @@ func TestGettingDefinedPet(t *testing.T) {
 	_ = os.Remove(settingsFilePath)
 	defer remove(settingsFilePath)
 
-	store, err := dataStore.NewDataStore(settingsFilePath)
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: settingsFilePath})
 
 	if err != nil {
 		t.Fatal(err)
@@ -97,7 +103,7 @@ func TestGettingDefinedPet(t *testing.T) {
 		t.Fatalf("extected 1 pet but got %d", len(petsCollection.Collection))
 	}
 
-	pet := petsCollection.Collection[shasta]
+	pet := petNamed(t, petsCollection, shasta)
 
 	if pet.Breed != shastaBreed {
 		t.Fatal("got the wrong breed")
@@ -114,7 +120,7 @@ func TestAddingAndRemovingPet(t *testing.T) {
 	_ = os.Remove(settingsFilePath)
 	defer remove(settingsFilePath)
 
-	store, err := dataStore.NewDataStore(settingsFilePath)
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: settingsFilePath})
 
 	if err != nil {
 		t.Fatal(err)
@@ -131,7 +137,7 @@ func TestAddingAndRemovingPet(t *testing.T) {
 		t.Fatalf("extected 1 pet but got %d", len(petsCollection.Collection))
 	}
 
-	pet := petsCollection.Collection[shasta]
+	pet := petNamed(t, petsCollection, shasta)
 
 	if pet.Breed != shastaBreed {
 		t.Fatal("got the wrong breed")
@@ -141,7 +147,11 @@ func TestAddingAndRemovingPet(t *testing.T) {
 		t.Fatal("got the wrong age")
 	}
 
-	petsCollection = store.RemovePet(shasta)
+	petsCollection, err = store.RemovePet(pet.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(petsCollection.Collection) != 0 {
 		t.Fatal("pets collection shoe have no entries")
@@ -170,7 +180,7 @@ func TestGettingEmptyCollection(t *testing.T) {
 }
 
 func mockGetHandler(responseWriter http.ResponseWriter, httpRequest *http.Request) {
-	newStore, err := dataStore.NewDataStore("./mockGetHandler.json")
+	newStore, err := dataStore.NewDataStore(dataStore.Config{FilePath: "./mockGetHandler.json"})
 
 	if err != nil {
 		panic(err)
@@ -211,7 +221,7 @@ func TestAdding1Pet(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
 
-	store, err := dataStore.NewDataStore(filePath)
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
 
 	if err != nil {
 		t.Fatalf("making data store fail with error: %+v", err)
@@ -221,9 +231,9 @@ func TestAdding1Pet(t *testing.T) {
 
 	httpHandler := http.HandlerFunc(thePutHandler.mockPutHandlerWithDataStore)
 
-	expected := `{"pets_collection":{"Shasta":{"age":9,"breed":"Spitz"}}}`
+	const petDefinition = `{"pets_collection":{"Shasta":{"age":9,"breed":"Spitz"}}}`
 
-	request, err := http.NewRequest("PUT", "/pet", strings.NewReader(expected))
+	request, err := http.NewRequest("PUT", "/pet", strings.NewReader(petDefinition))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -234,6 +244,8 @@ func TestAdding1Pet(t *testing.T) {
 		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
+	expected := expectedPet(petNamed(t, store.AllPets(), "Shasta").ID, "Shasta", 9, "Spitz")
+
 	if recorder.Body.String() != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
 	}
@@ -291,7 +303,7 @@ func TestGettingUndefinedPetHttp(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
 
-	store, err := dataStore.NewDataStore(filePath)
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
 
 	if err != nil {
 		t.Fatalf("making data store fail with error: %+v", err)
@@ -314,8 +326,10 @@ func TestGettingUndefinedPetHttp(t *testing.T) {
 		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	if recorder.Body.String() != petDefinition {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), petDefinition)
+	expected := expectedPet(petNamed(t, store.AllPets(), "Shasta").ID, "Shasta", 9, "Spitz")
+
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
 	}
 
 	theGetHandler := &mockGetHandler2{store: store}
@@ -335,9 +349,9 @@ func TestGettingUndefinedPetHttp(t *testing.T) {
 		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	const expected = `{"pets_collection":{}}`
-	if recorder2.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder2.Body.String(), expected)
+	const emptyCollection = `{"pets_collection":{}}`
+	if recorder2.Body.String() != emptyCollection {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder2.Body.String(), emptyCollection)
 	}
 }
 
@@ -348,7 +362,7 @@ func TestDeletingPet(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
 
-	store, err := dataStore.NewDataStore(filePath)
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
 
 	if err != nil {
 		t.Fatalf("making data store fail with error: %+v", err)
@@ -358,7 +372,7 @@ func TestDeletingPet(t *testing.T) {
 
 	httpHandler := http.HandlerFunc(thePutHandler.mockPutHandlerWithDataStore)
 
-	petDefinition := `{"pets_collection":{"Shasta":{"age":9,"breed":"Spitz"}}}`
+	const petDefinition = `{"pets_collection":{"Shasta":{"age":9,"breed":"Spitz"}}}`
 
 	request, err := http.NewRequest("PUT", "/pet", strings.NewReader(petDefinition))
 	if err != nil {
@@ -371,8 +385,10 @@ func TestDeletingPet(t *testing.T) {
 		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	if recorder.Body.String() != petDefinition {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), petDefinition)
+	expected := expectedPet(petNamed(t, store.AllPets(), "Shasta").ID, "Shasta", 9, "Spitz")
+
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
 	}
 
 	theGetHandler := &mockGetHandler2{store: store}
@@ -392,8 +408,8 @@ func TestDeletingPet(t *testing.T) {
 		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	if recorder2.Body.String() != petDefinition {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder2.Body.String(), petDefinition)
+	if recorder2.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder2.Body.String(), expected)
 	}
 
 	theDeleteHandler := &mockDeleteHandler{store: store}
@@ -413,9 +429,9 @@ func TestDeletingPet(t *testing.T) {
 		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	const expected = `{"pets_collection":{}}`
-	if recorder3.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v", recorder3.Body.String(), expected)
+	const emptyCollection = `{"pets_collection":{}}`
+	if recorder3.Body.String() != emptyCollection {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder3.Body.String(), emptyCollection)
 	}
 }
 
@@ -430,3 +446,534 @@ func (mockHandler *mockDeleteHandler) mockDeleteHandlerWithDataStore(responseWri
 		panic(err)
 	}
 }
+
+func petNamed(t *testing.T, petsCollection dataStore.PetsCollection, name string) dataStore.Pet {
+	for _, pet := range petsCollection.Collection {
+		if pet.Name == name {
+			return pet
+		}
+	}
+
+	t.Fatalf("collection does not contain pet named %s", name)
+
+	return dataStore.Pet{}
+}
+
+func expectedPet(id string, name string, age int, breed string) string {
+	return fmt.Sprintf(`{"pets_collection":{"%s":{"id":"%s","name":"%s","age":%d,"breed":"%s"}}}`, id, id, name, age, breed)
+}
+
+func patchPetRequest(t *testing.T, store dataStore.DataStore, contentType string, patch string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest("PATCH", "/pet?name=Shasta", strings.NewReader(patch))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	handler := &patchHandler{store}
+	_ = handler.HandleRequest(recorder, request)
+
+	return recorder
+}
+
+func TestMergePatchingPet(t *testing.T) {
+	const filePath = "TestMergePatchingPet.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	recorder := patchPetRequest(t, store, "application/merge-patch+json", `{"age":10}`)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := expectedPet(petNamed(t, store.AllPets(), "Shasta").ID, "Shasta", 10, "Spitz")
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+
+	recorder = patchPetRequest(t, store, "application/merge-patch+json", `{"favorite_toy":"ball"}`)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	for _, patch := range []string{`{"name":null}`, `{"name":""}`} {
+		recorder = patchPetRequest(t, store, "application/merge-patch+json", patch)
+
+		if status := recorder.Code; status != http.StatusUnprocessableEntity {
+			t.Errorf("patching %s returned wrong status code: got %v want %v", patch, status, http.StatusUnprocessableEntity)
+		}
+	}
+
+	recorder = patchPetRequest(t, store, "application/json-patch+json", `[{"op":"remove","path":"/name"}]`)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("removing the name returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+
+	if pets := store.OnePet("Shasta"); len(pets.Collection) != 1 {
+		t.Errorf("expected Shasta to keep her name, got %+v", store.AllPets())
+	}
+}
+
+func TestJSONPatchingPet(t *testing.T) {
+	const filePath = "TestJSONPatchingPet.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	const patch = `[{"op":"test","path":"/age","value":9},{"op":"replace","path":"/breed","value":"Eskie"},{"op":"copy","from":"/age","path":"/age"}]`
+
+	recorder := patchPetRequest(t, store, "application/json-patch+json", patch)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := expectedPet(petNamed(t, store.AllPets(), "Shasta").ID, "Shasta", 9, "Eskie")
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+}
+
+func TestFailedJSONPatchLeavesPetUnchanged(t *testing.T) {
+	const filePath = "TestFailedJSONPatchLeavesPetUnchanged.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	const patch = `[{"op":"replace","path":"/breed","value":"Eskie"},{"op":"test","path":"/age","value":3}]`
+
+	recorder := patchPetRequest(t, store, "application/json-patch+json", patch)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	pet := petNamed(t, store.OnePet("Shasta"), "Shasta")
+
+	if pet.Breed != "Spitz" || pet.Age != 9 {
+		t.Errorf("failed patch modified the pet: %+v", pet)
+	}
+
+	recorder = patchPetRequest(t, store, "application/json", `{"age":1}`)
+
+	if status := recorder.Code; status != http.StatusUnsupportedMediaType {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestFailedPutLeavesPetsUnchanged(t *testing.T) {
+	const filePath = "TestFailedPutLeavesPetsUnchanged.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	store.AddPet("Shasta", "Spitz", 9)
+
+	const pets = `{"Shasta":{"age":10,"breed":"Eskie"},"Buddy":{"age":-1,"breed":"Labrador"}}`
+
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest("PUT", "/pets", strings.NewReader(pets))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &putHandler{store}
+	_ = handler.HandleRequest(recorder, request)
+
+	if status := recorder.Code; status != http.StatusBadRequest {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	if pet := petNamed(t, store.OnePet("Shasta"), "Shasta"); pet.Age != 9 || pet.Breed != "Spitz" {
+		t.Errorf("failed PUT replaced the pet: %+v", pet)
+	}
+
+	if all := store.AllPets(); len(all.Collection) != 1 {
+		t.Errorf("failed PUT added pets: %+v", all)
+	}
+}
+
+func postPetRequest(t *testing.T, store dataStore.DataStore, target string, pet string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest("POST", target, strings.NewReader(pet))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &postHandler{store}
+	_ = handler.HandleRequest(recorder, request)
+
+	return recorder
+}
+
+func TestPostingPetCreatesIt(t *testing.T) {
+	const filePath = "TestPostingPetCreatesIt.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	const pet = `{"name":"Shasta","age":9,"breed":"Spitz"}`
+
+	recorder := postPetRequest(t, store, "/pet", pet)
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	if location := recorder.Header().Get("Location"); location != "/pet?id="+petNamed(t, store.AllPets(), "Shasta").ID {
+		t.Errorf("handler returned unexpected Location: %s", location)
+	}
+
+	recorder = postPetRequest(t, store, "/pet", `{"name":"Shasta","age":1,"breed":"Eskie"}`)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	if pet := petNamed(t, store.OnePet("Shasta"), "Shasta"); pet.Age != 9 || pet.Breed != "Spitz" {
+		t.Errorf("conflicting POST replaced the pet: %+v", pet)
+	}
+}
+
+func TestPostingPetsWithDuplicateNames(t *testing.T) {
+	const filePath = "TestPostingPetsWithDuplicateNames.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	const pet = `{"name":"Buddy","age":3,"breed":"Labrador"}`
+
+	for index := 0; index < 2; index++ {
+		recorder := postPetRequest(t, store, "/pet?allow_duplicate_name=true", pet)
+
+		if status := recorder.Code; status != http.StatusCreated {
+			t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusCreated)
+		}
+	}
+
+	if count := len(store.AllPets().Collection); count != 2 {
+		t.Errorf("expected 2 pets, got %d", count)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest("DELETE", "/pet?name=Buddy", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &deleteHandler{store}
+	_ = handler.HandleRequest(recorder, request)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("deleting an ambiguous name returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+}
+
+func TestWrappedStoreErrorsKeepTheirStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{dataStore.ErrPetNotFound, http.StatusNotFound},
+		{dataStore.ErrPetHasOwners, http.StatusConflict},
+		{dataStore.ErrResourceFull, http.StatusConflict},
+		{dataStore.ErrImmutableID, http.StatusUnprocessableEntity},
+		{dataStore.ErrPhotoNotFound, http.StatusNotFound},
+		{dataStore.ErrUnsupportedPhoto, http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		wrapped := fmt.Errorf("pet 1: %w", test.err)
+
+		if status := statusForPhotoError(wrapped); status != test.status {
+			t.Errorf("expected %v for %v, got %v", test.status, wrapped, status)
+		}
+	}
+}
+
+func TestRenamingPet(t *testing.T) {
+	const filePath = "TestRenamingPet.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	id := petNamed(t, store.AddPet("Shasta", "Spitz", 9), "Shasta").ID
+
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest("POST", "/pet/rename?name=Shasta&to=Sasha", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &renameHandler{store}
+	_ = handler.HandleRequest(recorder, request)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	expected := expectedPet(id, "Sasha", 9, "Spitz")
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+}
+
+func TestPostingDetailedPets(t *testing.T) {
+	const filePath = "TestPostingDetailedPets.json"
+
+	defer remove(filePath)
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatalf("making data store fail with error: %+v", err)
+	}
+
+	recorder := postPetRequest(t, store, "/pet", `{"name":"Twitch","breed":"Dutch Belted","species":"rabbit","sex":"male","microchip":"123"}`)
+
+	if status := recorder.Code; status != http.StatusCreated {
+		t.Errorf("httpHandler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	recorder = postPetRequest(t, store, "/pet", `{"name":"Thumper","breed":"Rex","species":"rabbit","microchip":"123"}`)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("duplicate microchip returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	recorder = postPetRequest(t, store, "/pet", `{"name":"Thumper","breed":"Rex","birth_date":"last spring"}`)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("bad birth date returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+}
+
+// startTestServer starts server with its admin listener on a socket in directory, and
+// returns the address it serves on, a client for the admin socket and the error Start
+// returns once it does.
+func startTestServer(t *testing.T, server PetServer, directory string) (string, *http.Client, chan error) {
+	socketPath := filepath.Join(directory, "admin.sock")
+
+	if err := server.SetAdminAddress("unix:" + socketPath); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan error, 1)
+
+	go func() {
+		started <- server.Start()
+	}()
+
+	for attempt := 0; attempt < 200; attempt++ {
+		server.(*petServer).lock.Lock()
+		address := server.(*petServer).listenAddress
+		server.(*petServer).lock.Unlock()
+
+		if _, err := os.Stat(socketPath); err == nil && address != nil {
+			adminClient := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+				},
+			}}
+
+			return "http://" + address.String(), adminClient, started
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("server did not start")
+
+	return "", nil, nil
+}
+
+func TestClosingDrainsRequestsAndStoresPets(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestClosingDrainsRequestsAndStoresPets")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "pets.json")
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewPetServer(Config{Address: "127.0.0.1:0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SetAdminAddress("0.0.0.0:8081"); err == nil {
+		t.Errorf("expected an admin address open to the network to be refused")
+	}
+
+	inFlight := make(chan struct{})
+
+	server.Use(func(next HttpRequestHandler) HttpRequestHandler {
+		return HttpRequestHandlerFunc(func(responseWriter http.ResponseWriter, httpRequest *http.Request) error {
+			if httpRequest.Header.Get("X-Slow") == "true" {
+				close(inFlight)
+				time.Sleep(200 * time.Millisecond)
+			}
+
+			return next.HandleRequest(responseWriter, httpRequest)
+		})
+	})
+
+	url, adminClient, started := startTestServer(t, server, directory)
+
+	if response, err := http.Get(url + "/close"); err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected /close to be left off the public listener, got %v %v", response, err)
+	}
+
+	slowStatus := make(chan int, 1)
+
+	go func() {
+		request, _ := http.NewRequest("PUT", url+"/pet", strings.NewReader(`{"pets_collection":{"Shasta":{"age":9,"breed":"Spitz"}}}`))
+		request.Header.Set("X-Slow", "true")
+
+		response, err := http.DefaultClient.Do(request)
+
+		if err != nil {
+			slowStatus <- 0
+			return
+		}
+
+		_ = response.Body.Close()
+		slowStatus <- response.StatusCode
+	}()
+
+	<-inFlight
+
+	response, err := adminClient.Post("http://admin/close", "application/json", nil)
+
+	if err != nil || response.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected /close to answer 202, got %v %v", response, err)
+	}
+
+	// Shutting down again, even while the first shutdown is under way, waits for it.
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected a second shutdown to succeed, got %v", err)
+	}
+
+	if status := <-slowStatus; status != http.StatusOK {
+		t.Errorf("expected the request in progress to finish, got %v", status)
+	}
+
+	if err := <-started; err != http.ErrServerClosed {
+		t.Errorf("expected Start to return http.ErrServerClosed, got %v", err)
+	}
+
+	reloaded, _ := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err := reloaded.Load(); err != nil || len(reloaded.AllPets().Collection) != 1 {
+		t.Errorf("expected the pet added while draining to be stored, got %v", err)
+	}
+
+	if err := server.Start(); err != http.ErrServerClosed {
+		t.Errorf("expected a closed server to stay closed, got %v", err)
+	}
+}
+
+func TestUnreadableDataIsNeitherServedNorOverwritten(t *testing.T) {
+	directory, err := ioutil.TempDir("", "TestUnreadableDataIsNeitherServedNorOverwritten")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	filePath := filepath.Join(directory, "pets.json")
+
+	if err := ioutil.WriteFile(filePath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := dataStore.NewDataStore(dataStore.Config{FilePath: filePath})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewPetServer(Config{Address: "127.0.0.1:0"}, store)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Start(); err == nil || err == http.ErrServerClosed {
+		t.Errorf("expected Start to fail to load the data, got %v", err)
+	}
+
+	if err := server.Shutdown(context.Background()); err == nil {
+		t.Errorf("expected the shutdown to say the data was not stored")
+	}
+
+	if fileData, err := ioutil.ReadFile(filePath); err != nil || string(fileData) != "{" {
+		t.Errorf("expected the pets file to be left alone, got %q, %v", fileData, err)
+	}
+}